@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dynoinc/ratchet/internal/background/report_worker"
+	"github.com/dynoinc/ratchet/internal/secrets"
+)
+
+// Validate checks the whole configuration up front and reports every problem at once, named
+// by the environment variable to fix.
+func (c config) Validate() error {
+	var errs []error
+	errs = append(errs, prefixed("RATCHET_OPENAI_", c.OpenAI.Validate())...)
+	errs = append(errs, prefixed("RATCHET_CLASSIFIER_", c.Classifier.Validate())...)
+	errs = append(errs, prefixed("RATCHET_INCIDENT_RESOLUTION_", c.IncidentResolution.Validate())...)
+
+	// Leave room for the continuation note and reopened code fences when splitting.
+	if c.SlackMaxMessageLength < 100 {
+		errs = append(errs, fmt.Errorf("RATCHET_SLACK_MAX_MESSAGE_LENGTH must be at least 100, got %d", c.SlackMaxMessageLength))
+	}
+	if c.SlackArchiveSyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_SLACK_ARCHIVE_SYNC_INTERVAL must not be negative, got %s", c.SlackArchiveSyncInterval))
+	}
+	if c.ReportThreadMessagesLimit < 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_REPORT_THREAD_MESSAGES_LIMIT must not be negative, got %d", c.ReportThreadMessagesLimit))
+	}
+	if c.ReportMessagesLimit < 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_REPORT_MESSAGES_LIMIT must not be negative, got %d", c.ReportMessagesLimit))
+	}
+	if c.RunbookThreadMessagesLimit < 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_RUNBOOK_THREAD_MESSAGES_LIMIT must not be negative, got %d", c.RunbookThreadMessagesLimit))
+	}
+	if c.ReportDedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_REPORT_DEDUP_WINDOW must not be negative, got %s", c.ReportDedupWindow))
+	}
+	if err := report_worker.ValidateAttachmentFormat(c.ReportAttachment); err != nil {
+		errs = append(errs, fmt.Errorf("RATCHET_REPORT_ATTACHMENT: %w", err))
+	}
+	if _, err := regexp.Compile(c.RedactPattern); err != nil {
+		errs = append(errs, fmt.Errorf("RATCHET_REDACT_PATTERN: %w", err))
+	}
+	if _, _, err := net.SplitHostPort(c.HTTPAddr); err != nil {
+		errs = append(errs, fmt.Errorf("RATCHET_HTTP_ADDR: %w", err))
+	}
+	if c.ShutdownDrainTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("RATCHET_SHUTDOWN_DRAIN_TIMEOUT must be positive, got %s", c.ShutdownDrainTimeout))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResolveSecrets replaces secret settings given as references, like
+// RATCHET_SLACK_BOT_TOKEN=file:///run/secrets/slack-bot-token, with the secrets they point to.
+func (c *config) ResolveSecrets(ctx context.Context, r *secrets.Resolver) error {
+	settings := []struct {
+		name  string
+		value *string
+	}{
+		{"RATCHET_DATABASE_PASS", &c.Database.Pass},
+		{"RATCHET_OPENAI_API_KEY", &c.OpenAI.APIKey},
+		{"RATCHET_SLACK_BOT_TOKEN", &c.SlackBotToken},
+		{"RATCHET_SLACK_APP_TOKEN", &c.SlackAppToken},
+		{"RATCHET_INGEST_SECRET", &c.IngestSecret},
+	}
+
+	var errs []error
+	for _, setting := range settings {
+		value, err := r.Resolve(ctx, *setting.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", setting.name, err))
+			continue
+		}
+		*setting.value = value
+	}
+
+	return errors.Join(errs...)
+}
+
+// profiles is a file of named configuration profiles, each a set of environment variables layered
+// on top of those shared by every profile:
+//
+//	shared:
+//	  RATCHET_OPENAI_MODEL: gpt-4o
+//	profiles:
+//	  dev:
+//	    RATCHET_SLACK_ALLOWED_CHANNELS: ratchet-test
+//	  prod:
+//	    RATCHET_HTTP_ADDR: 0.0.0.0:5001
+type profiles struct {
+	Shared   map[string]string            `yaml:"shared"`
+	Profiles map[string]map[string]string `yaml:"profiles"`
+}
+
+// applyProfile sets the variables of the named profile, and those shared by every profile, read
+// from the profiles file at path. Variables already set in the environment are left alone, so they
+// still override the profile when envconfig processes them.
+func applyProfile(path, name string) error {
+	if path == "" {
+		if name != "" {
+			return fmt.Errorf("ENV is %q but RATCHET_PROFILES_FILE is not set", name)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading profiles file: %w", err)
+	}
+
+	var p profiles
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("parsing profiles file %s: %w", path, err)
+	}
+
+	vars := maps.Clone(p.Shared)
+	if name != "" {
+		profile, ok := p.Profiles[name]
+		if !ok {
+			return fmt.Errorf("profile %q not found in %s", name, path)
+		}
+		if vars == nil {
+			vars = map[string]string{}
+		}
+		maps.Copy(vars, profile)
+	}
+
+	for key, value := range vars {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// prefixed splits a joined error and prefixes each one with the env var prefix of its config.
+func prefixed(prefix string, err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{fmt.Errorf("%s%w", prefix, err)}
+	}
+
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, fmt.Errorf("%s%w", prefix, err))
+	}
+	return errs
+}
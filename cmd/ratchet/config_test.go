@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/background/classifier_worker"
+	"github.com/dynoinc/ratchet/internal/background/incident_resolution_worker"
+	"github.com/dynoinc/ratchet/internal/llm"
+)
+
+func validConfig() config {
+	return config{
+		OpenAI: llm.Config{
+			URL:           "http://localhost:11434/v1/",
+			Model:         "qwen2.5:7b",
+			Timeout:       2 * time.Minute,
+			MessageFormat: llm.MessageFormatPlain,
+		},
+		Classifier: classifier_worker.Config{
+			IncidentClassificationBinary: "true",
+		},
+		SlackMaxMessageLength: 3000,
+		HTTPAddr:              "127.0.0.1:5001",
+		ShutdownDrainTimeout:  30 * time.Second,
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, validConfig().Validate())
+
+	c := validConfig()
+	c.OpenAI.URL = "localhost:11434"
+	c.OpenAI.Models = llm.TaskModels{"summarise": "gpt-4o"}
+	c.IncidentResolution = incident_resolution_worker.Config{Enabled: true, Interval: time.Hour, MinAge: 2 * time.Hour, Lookback: time.Hour, Timeout: time.Hour}
+	c.ReportAttachment = "pdf"
+	c.RedactPattern = "token=("
+
+	err := c.Validate()
+	require.Error(t, err)
+	require.Equal(t, `RATCHET_OPENAI_URL must be an http or https URL, got "localhost:11434"
+RATCHET_OPENAI_MODELS has unknown task "summarise", expected one of classify, runbook, summarize
+RATCHET_INCIDENT_RESOLUTION_LOOKBACK (1h0m0s) must be longer than MIN_AGE (2h0m0s)
+RATCHET_REPORT_ATTACHMENT: unknown report attachment format "pdf", expected "markdown" or "csv"
+RATCHET_REDACT_PATTERN: error parsing regexp: missing closing ): `+"`token=(`", err.Error())
+}
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+shared:
+  RATCHET_CLASSIFIER_INCIDENT_CLASSIFICATION_BINARY: "true"
+  RATCHET_SLACK_MAX_MESSAGE_LENGTH: 2000
+  RATCHET_REPORT_MESSAGES_LIMIT: 50
+  RATCHET_HTTP_ADDR: 0.0.0.0:5001
+profiles:
+  prod:
+    RATCHET_REPORT_MESSAGES_LIMIT: 500
+    RATCHET_HTTP_ADDR: 0.0.0.0:8080
+`), 0o600))
+
+	// Restore whatever applyProfile sets once the test is done.
+	for _, key := range []string{"RATCHET_CLASSIFIER_INCIDENT_CLASSIFICATION_BINARY", "RATCHET_SLACK_MAX_MESSAGE_LENGTH", "RATCHET_REPORT_MESSAGES_LIMIT"} {
+		t.Setenv(key, "")
+		require.NoError(t, os.Unsetenv(key))
+	}
+	t.Setenv("RATCHET_SLACK_BOT_TOKEN", "xoxb-test")
+	t.Setenv("RATCHET_SLACK_APP_TOKEN", "xapp-test")
+	t.Setenv("RATCHET_HTTP_ADDR", "127.0.0.1:9000")
+
+	require.NoError(t, applyProfile(path, "prod"))
+
+	var c config
+	require.NoError(t, envconfig.Process("ratchet", &c))
+	require.Equal(t, 2000, c.SlackMaxMessageLength) // shared
+	require.Equal(t, 500, c.ReportMessagesLimit)    // profile over shared
+	require.Equal(t, "127.0.0.1:9000", c.HTTPAddr)  // environment over profile
+	require.Equal(t, 30*time.Second, c.ShutdownDrainTimeout)
+
+	require.ErrorContains(t, applyProfile(path, "staging"), `profile "staging" not found`)
+	require.ErrorContains(t, applyProfile("", "prod"), "RATCHET_PROFILES_FILE is not set")
+}
@@ -26,12 +26,20 @@ import (
 
 	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/background/backfill_repair_worker"
 	"github.com/dynoinc/ratchet/internal/background/backfill_thread_worker"
+	"github.com/dynoinc/ratchet/internal/background/channel_archive_worker"
 	"github.com/dynoinc/ratchet/internal/background/channel_onboard_worker"
 	"github.com/dynoinc/ratchet/internal/background/classifier_worker"
+	"github.com/dynoinc/ratchet/internal/background/incident_duration_worker"
+	"github.com/dynoinc/ratchet/internal/background/incident_owner_worker"
+	"github.com/dynoinc/ratchet/internal/background/incident_resolution_worker"
 	"github.com/dynoinc/ratchet/internal/background/report_worker"
 	"github.com/dynoinc/ratchet/internal/background/runbook_worker"
+	"github.com/dynoinc/ratchet/internal/background/status_update_worker"
 	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/oncall"
+	"github.com/dynoinc/ratchet/internal/secrets"
 	"github.com/dynoinc/ratchet/internal/slack_integration"
 	"github.com/dynoinc/ratchet/internal/storage"
 	"github.com/dynoinc/ratchet/internal/web"
@@ -46,16 +54,80 @@ type config struct {
 	// Classifier configuration
 	Classifier classifier_worker.Config
 
+	// Automatic detection of resolved incidents
+	IncidentResolution incident_resolution_worker.Config `split_words:"true"`
+
 	// OpenAI configuration
 	OpenAI llm.Config `envconfig:"OPENAI"`
 
-	// Slack configuration
+	// Slack configuration. Tokens, like the other secrets, may also be given as env://NAME,
+	// file:///path or vault://path#key references.
 	SlackBotToken   string `split_words:"true" required:"true"`
 	SlackAppToken   string `split_words:"true" required:"true"`
 	SlackDevChannel string `split_words:"true" default:"ratchet-test"`
+	// Channel IDs or names the bot posts in. Other channels are only ingested. Empty means all.
+	SlackAllowedChannels []string `split_words:"true"`
+	// Longer bot messages are split into a root message and threaded continuations.
+	SlackMaxMessageLength int `split_words:"true" default:"3000"`
+	// Also show runbook replies in the channel, not just in the incident thread.
+	SlackBroadcastRunbook bool `split_words:"true" default:"false"`
+	// Post reports and runbooks as Block Kit blocks, with headings, dividers, lists and code
+	// blocks in blocks of their own, instead of a single block of text.
+	SlackBlocks bool `split_words:"true" default:"false"`
+	// Events Slack redelivers within this long of the first delivery are dropped. 0 disables.
+	SlackEventDedupTTL time.Duration `split_words:"true" default:"10m"`
+	// Onboard allowed channels whenever the bot is added to them, to backfill history it missed.
+	SlackAutoOnboard bool `split_words:"true" default:"false"`
+	// Channel to alert in when a background job fails for the last time. Empty disables.
+	SlackFailedJobsChannel string `split_words:"true"`
+	// How often to check Slack for archived channels, on top of archive events. 0 disables.
+	SlackArchiveSyncInterval time.Duration `split_words:"true" default:"24h"`
+
+	// On-call to mention in new incident threads, per service: "payments:U123,search:bob@example.com".
+	OnCallStatic oncall.Static `split_words:"true"`
+
+	// Maximum number of thread messages used as LLM context per use case (0 means no limit). Longer
+	// threads keep their most recent messages.
+	ReportThreadMessagesLimit  int `split_words:"true" default:"0"`
+	RunbookThreadMessagesLimit int `split_words:"true" default:"0"`
+	// Most channel messages (with their threads) a report's suggestions are generated from.
+	// Busy channels keep their incidents and a sample of the rest. 0 means no limit.
+	ReportMessagesLimit int `split_words:"true" default:"200"`
+
+	// Also upload weekly reports as a file in the report's thread: "markdown", "csv" (top
+	// alerts table) or empty for none.
+	ReportAttachment string `split_words:"true"`
+	// A channel's report is not posted again within this long, even if requested. 0 disables.
+	ReportDedupWindow time.Duration `split_words:"true" default:"1h"`
+
+	// Extra regular expression for secrets to redact from stored messages, on top of common
+	// formats like API keys and private keys. Use | to match several.
+	RedactPattern string `split_words:"true"`
+
+	// When Slack delivers a message that is already stored, replace its text instead of keeping
+	// the first version. Classifications and other enrichments are kept either way.
+	UpsertMessages bool `split_words:"true" default:"true"`
+	// When a reply arrives for a thread whose parent message isn't stored, e.g. a thread started
+	// before the channel was onboarded, backfill that thread from Slack.
+	BackfillUnknownThreads bool `split_words:"true" default:"true"`
 
 	// HTTP configuration
 	HTTPAddr string `split_words:"true" default:"127.0.0.1:5001"`
+	// URL River UI is reachable at from Slack, e.g. https://ratchet.example.com/riverui, to link
+	// failed job alerts to the job.
+	RiverUIURL string `envconfig:"RIVER_UI_URL"`
+
+	// JSON file listing extra periodic jobs, e.g. [{"kind": "report", "schedule": "0 9 * * MON",
+	// "args": {"channel_id": "C123"}}]. Schedules use cron syntax.
+	PeriodicJobsFile string `split_words:"true"`
+
+	// How long running jobs and HTTP requests get, together, to finish on shutdown before being
+	// cancelled.
+	ShutdownDrainTimeout time.Duration `split_words:"true" default:"30s"`
+
+	// Shared secret used to verify signatures on /api/ingest/alert. Requests carry their Unix time
+	// in X-Ratchet-Timestamp and sign "<timestamp>.<body>". Ingestion is disabled when empty.
+	IngestSecret string `split_words:"true"`
 }
 
 func main() {
@@ -75,11 +147,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := applyProfile(os.Getenv("RATCHET_PROFILES_FILE"), os.Getenv("ENV")); err != nil {
+		slog.ErrorContext(ctx, "error applying configuration profile", "error", err)
+		os.Exit(1)
+	}
+
 	var c config
 	if err := envconfig.Process("ratchet", &c); err != nil {
 		slog.ErrorContext(ctx, "error processing environment variables", "error", err)
 		os.Exit(1)
 	}
+	if err := c.ResolveSecrets(ctx, secrets.NewResolver()); err != nil {
+		fmt.Fprintf(os.Stderr, "resolving secrets:\n%s\n", err)
+		os.Exit(1)
+	}
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(1)
+	}
 
 	// Logging setup
 	shortfile := func(groups []string, a slog.Attr) slog.Attr {
@@ -135,10 +220,16 @@ func main() {
 	}
 
 	// Bot setup
-	bot := internal.New(db)
+	redactor, err := internal.NewRedactor(c.RedactPattern)
+	if err != nil {
+		slog.ErrorContext(ctx, "error setting up redaction", "error", err)
+		os.Exit(1)
+	}
+
+	bot := internal.New(db, c.SlackAllowedChannels, redactor, c.UpsertMessages, c.BackfillUnknownThreads)
 
 	// Slack integration setup
-	slackIntegration, err := slack_integration.New(ctx, c.SlackAppToken, c.SlackBotToken, bot)
+	slackIntegration, err := slack_integration.New(ctx, c.SlackAppToken, c.SlackBotToken, bot, c.SlackEventDedupTTL, c.SlackAutoOnboard)
 	if err != nil {
 		slog.ErrorContext(ctx, "error setting up Slack", "error", err)
 		os.Exit(1)
@@ -153,26 +244,59 @@ func main() {
 
 	// Channel onboarding worker setup
 	channelOnboardWorker := channel_onboard_worker.New(bot, slackIntegration.Client())
+	channelArchiveWorker := channel_archive_worker.New(bot, slackIntegration.Client())
 
 	// Backfill thread worker setup
 	backfillThreadWorker := backfill_thread_worker.New(bot, slackIntegration.Client())
+	backfillRepairWorker := backfill_repair_worker.New(bot, slackIntegration.Client())
 
 	// Report worker setup
-	reportWorker := report_worker.New(bot, slackIntegration.Client(), llmClient, c.SlackDevChannel)
+	reportWorker, err := report_worker.New(bot, slackIntegration.Client(), llmClient, c.SlackDevChannel, c.SlackMaxMessageLength, c.ReportMessagesLimit, c.ReportThreadMessagesLimit, c.ReportAttachment, c.ReportDedupWindow, c.SlackBlocks)
+	if err != nil {
+		slog.ErrorContext(ctx, "error setting up report worker", "error", err)
+		os.Exit(1)
+	}
 
 	// Runbook worker setup
-	postRunbookWorker := runbook_worker.NewPostRunbookWorker(bot, slackIntegration.Client(), c.SlackDevChannel)
-	updateRunbookWorker := runbook_worker.NewUpdateRunbookWorker(bot, llmClient)
+	var onCall oncall.Provider
+	if len(c.OnCallStatic) > 0 {
+		onCall = c.OnCallStatic
+	}
+	postRunbookWorker := runbook_worker.NewPostRunbookWorker(bot, slackIntegration.Client(), c.SlackDevChannel, c.SlackMaxMessageLength, c.SlackBroadcastRunbook, c.SlackBlocks, onCall)
+	updateRunbookWorker := runbook_worker.NewUpdateRunbookWorker(bot, llmClient, c.RunbookThreadMessagesLimit)
+
+	// Incident resolution worker setup
+	incidentResolutionWorker := incident_resolution_worker.New(c.IncidentResolution, bot, llmClient)
+	incidentDurationWorker := incident_duration_worker.New(bot)
+	statusUpdateWorker := status_update_worker.New(bot, slackIntegration.Client(), c.SlackDevChannel)
+	incidentOwnerWorker := incident_owner_worker.New(bot, slackIntegration.Client(), c.SlackDevChannel)
+	periodicJobs, err := background.LoadPeriodicJobs(c.PeriodicJobsFile)
+	if err != nil {
+		slog.ErrorContext(ctx, "error loading periodic jobs", "error", err)
+		os.Exit(1)
+	}
+	if job := incident_resolution_worker.PeriodicJob(c.IncidentResolution); job != nil {
+		periodicJobs = append(periodicJobs, job)
+	}
+	if job := channel_archive_worker.PeriodicJob(c.SlackArchiveSyncInterval); job != nil {
+		periodicJobs = append(periodicJobs, job)
+	}
 
 	// Background job setup
 	workers := river.NewWorkers()
 	river.AddWorker(workers, classifier)
 	river.AddWorker(workers, channelOnboardWorker)
+	river.AddWorker(workers, channelArchiveWorker)
 	river.AddWorker(workers, reportWorker)
 	river.AddWorker(workers, postRunbookWorker)
 	river.AddWorker(workers, updateRunbookWorker)
 	river.AddWorker(workers, backfillThreadWorker)
-	riverClient, err := background.New(db, workers)
+	river.AddWorker(workers, backfillRepairWorker)
+	river.AddWorker(workers, incidentResolutionWorker)
+	river.AddWorker(workers, incidentDurationWorker)
+	river.AddWorker(workers, statusUpdateWorker)
+	river.AddWorker(workers, incidentOwnerWorker)
+	riverClient, err := background.New(db, workers, periodicJobs)
 	if err != nil {
 		slog.ErrorContext(ctx, "error setting up background worker", "error", err)
 		os.Exit(1)
@@ -184,7 +308,16 @@ func main() {
 	}
 
 	// HTTP server setup
-	handler, err := web.New(ctx, db, riverClient)
+	handler, err := web.New(ctx, db, riverClient, bot, reportWorker, llmClient, slackIntegration, slackIntegration.Permalink, web.ChannelSettings{
+		SlackMaxMessageLength:      c.SlackMaxMessageLength,
+		SlackBroadcastRunbook:      c.SlackBroadcastRunbook,
+		SlackBlocks:                c.SlackBlocks,
+		ReportAttachment:           c.ReportAttachment,
+		ReportDedupWindow:          c.ReportDedupWindow.String(),
+		ReportMessagesLimit:        c.ReportMessagesLimit,
+		ReportThreadMessagesLimit:  c.ReportThreadMessagesLimit,
+		RunbookThreadMessagesLimit: c.RunbookThreadMessagesLimit,
+	}, c.IngestSecret)
 	if err != nil {
 		slog.ErrorContext(ctx, "error setting up HTTP server", "error", err)
 		os.Exit(1)
@@ -197,9 +330,13 @@ func main() {
 	}
 
 	wg, ctx := errgroup.WithContext(ctx)
+	// Slack events stop being taken in as soon as shutdown starts, before anything is drained.
+	intakeCtx, stopIntake := context.WithCancel(ctx)
+	defer stopIntake()
 	wg.Go(func() error {
 		slog.InfoContext(ctx, "Starting river client")
-		return riverClient.Start(ctx)
+		// Jobs must outlive ctx so shutdown can drain them instead of cancelling them.
+		return riverClient.Start(context.WithoutCancel(ctx))
 	})
 	wg.Go(func() error {
 		slog.InfoContext(ctx, "Starting HTTP server", "addr", c.HTTPAddr)
@@ -211,23 +348,49 @@ func main() {
 	})
 	wg.Go(func() error {
 		slog.InfoContext(ctx, "Starting Slack integration", "bot_user_id", slackIntegration.BotUserID)
-		return slackIntegration.Run(ctx)
+		err := slackIntegration.Run(intakeCtx)
+		if intakeCtx.Err() != nil {
+			return nil
+		}
+		return err
 	})
+	if c.SlackFailedJobsChannel != "" {
+		notifier := slack_integration.NewFailedJobNotifier(slackIntegration.Client(), c.SlackFailedJobsChannel, c.RiverUIURL)
+		wg.Go(func() error {
+			return notifier.Run(ctx, riverClient)
+		})
+	}
 	wg.Go(func() error {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 		select {
 		case <-ctx.Done():
-		case <-c:
-			slog.InfoContext(ctx, "Shutting down")
-			cancel()
+		case <-sigs:
+			slog.InfoContext(ctx, "Shutting down", "drain_timeout", c.ShutdownDrainTimeout)
+		}
 
-			if err := server.Shutdown(ctx); err != nil {
-				return fmt.Errorf("error shutting down http server: %w", err)
+		stopIntake()
+
+		// HTTP requests and running jobs drain at the same time, against one deadline.
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.WithoutCancel(ctx), c.ShutdownDrainTimeout)
+		defer shutdownCancel()
+		var drain errgroup.Group
+		drain.Go(func() error {
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				slog.WarnContext(ctx, "error shutting down http server", "error", err)
 			}
-		}
+			return nil
+		})
+		drain.Go(func() error {
+			if err := background.Drain(shutdownCtx, riverClient); err != nil {
+				slog.WarnContext(ctx, "error draining background jobs", "error", err)
+			}
+			return nil
+		})
+		_ = drain.Wait()
 
+		cancel()
 		return nil
 	})
 
@@ -1,8 +1,24 @@
 package background
 
+import (
+	"time"
+
+	"github.com/riverqueue/river"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// duplicateJobWindow is how long identical onboarding and report jobs are deduplicated for, so
+// retries and impatient double-submits don't queue the same work twice.
+const duplicateJobWindow = 10 * time.Minute
+
 type ClassifierArgs struct {
 	ChannelID string `json:"channel_id"`
 	SlackTS   string `json:"slack_ts"`
+
+	// Reclassify re-runs incident classification on an already classified message, replacing
+	// its incident action without scheduling runbooks again.
+	Reclassify bool `json:"reclassify,omitzero"`
 }
 
 func (c ClassifierArgs) Kind() string {
@@ -17,6 +33,12 @@ func (c ChannelOnboardWorkerArgs) Kind() string {
 	return "channel_board"
 }
 
+func (c ChannelOnboardWorkerArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: duplicateJobWindow},
+	}
+}
+
 type BackfillThreadWorkerArgs struct {
 	ChannelID string `json:"channel_id"`
 	SlackTS   string `json:"slack_ts"`
@@ -26,14 +48,29 @@ func (b BackfillThreadWorkerArgs) Kind() string {
 	return "backfill_thread"
 }
 
+func (b BackfillThreadWorkerArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: duplicateJobWindow},
+	}
+}
+
 type ReportWorkerArgs struct {
 	ChannelID string `json:"channel_id"`
+
+	// Additional channels the report is cross-posted to.
+	Destinations []string `json:"destinations,omitzero"`
 }
 
 func (r ReportWorkerArgs) Kind() string {
 	return "report"
 }
 
+func (r ReportWorkerArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: duplicateJobWindow},
+	}
+}
+
 type PostRunbookWorkerArgs struct {
 	ChannelID string `json:"channel_id"`
 	SlackTS   string `json:"slack_ts"`
@@ -51,3 +88,70 @@ type UpdateRunbookWorkerArgs struct {
 func (u UpdateRunbookWorkerArgs) Kind() string {
 	return "update_runbook"
 }
+
+type IncidentResolutionWorkerArgs struct{}
+
+func (i IncidentResolutionWorkerArgs) Kind() string {
+	return "incident_resolution"
+}
+
+// BackfillWindow is an inclusive [Oldest, Latest] range of Slack timestamps.
+type BackfillWindow struct {
+	Oldest string `json:"oldest"`
+	Latest string `json:"latest"`
+}
+
+type BackfillRepairWorkerArgs struct {
+	ChannelID string           `json:"channel_id"`
+	Windows   []BackfillWindow `json:"windows"`
+}
+
+func (b BackfillRepairWorkerArgs) Kind() string {
+	return "backfill_repair"
+}
+
+func (b BackfillRepairWorkerArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: duplicateJobWindow},
+	}
+}
+
+type IncidentDurationWorkerArgs struct {
+	ChannelID string `json:"channel_id"`
+}
+
+func (i IncidentDurationWorkerArgs) Kind() string {
+	return "incident_duration"
+}
+
+func (i IncidentDurationWorkerArgs) InsertOpts() river.InsertOpts {
+	return river.InsertOpts{
+		UniqueOpts: river.UniqueOpts{ByArgs: true, ByPeriod: duplicateJobWindow},
+	}
+}
+
+type StatusUpdateWorkerArgs struct {
+	ChannelID string           `json:"channel_id"`
+	SlackTS   string           `json:"slack_ts"`
+	Update    dto.StatusUpdate `json:"update"`
+}
+
+func (s StatusUpdateWorkerArgs) Kind() string {
+	return "status_update"
+}
+
+type IncidentOwnerWorkerArgs struct {
+	ChannelID string `json:"channel_id"`
+	SlackTS   string `json:"slack_ts"`
+	OwnerID   string `json:"owner_id"`
+}
+
+func (i IncidentOwnerWorkerArgs) Kind() string {
+	return "incident_owner"
+}
+
+type ChannelArchiveWorkerArgs struct{}
+
+func (c ChannelArchiveWorkerArgs) Kind() string {
+	return "channel_archive"
+}
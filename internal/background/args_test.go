@@ -0,0 +1,38 @@
+package background
+
+import (
+	"context"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestDuplicateJobsAreSkipped(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	client, err := river.NewClient(riverpgxv5.New(db), &river.Config{})
+	require.NoError(t, err)
+
+	for _, args := range []river.JobArgs{
+		ChannelOnboardWorkerArgs{ChannelID: "C1"},
+		ReportWorkerArgs{ChannelID: "C1"},
+	} {
+		first, err := client.Insert(ctx, args, nil)
+		require.NoError(t, err)
+		require.False(t, first.UniqueSkippedAsDuplicate)
+
+		second, err := client.Insert(ctx, args, nil)
+		require.NoError(t, err)
+		require.True(t, second.UniqueSkippedAsDuplicate, args.Kind())
+		require.Equal(t, first.Job.ID, second.Job.ID)
+
+		res, err := client.JobList(ctx, river.NewJobListParams().Kinds(args.Kind()))
+		require.NoError(t, err)
+		require.Len(t, res.Jobs, 1, args.Kind())
+	}
+}
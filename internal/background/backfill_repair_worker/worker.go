@@ -0,0 +1,151 @@
+package backfill_repair_worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/slack-go/slack"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+type backfillRepairWorker struct {
+	river.WorkerDefaults[background.BackfillRepairWorkerArgs]
+
+	bot         *internal.Bot
+	slackClient *slack.Client
+}
+
+func New(bot *internal.Bot, slackClient *slack.Client) *backfillRepairWorker {
+	return &backfillRepairWorker{
+		bot:         bot,
+		slackClient: slackClient,
+	}
+}
+
+// Work compares Slack's history for each window with the stored messages and adds whatever was
+// missed during the original backfill.
+func (w *backfillRepairWorker) Work(ctx context.Context, job *river.Job[background.BackfillRepairWorkerArgs]) error {
+	var addMessageParams []schema.AddMessageParams
+	var backfillThreadInsertParams []river.InsertManyParams
+	seen := map[string]bool{}
+	for _, window := range job.Args.Windows {
+		messages, err := w.history(job.Args.ChannelID, window)
+		if err != nil {
+			return err
+		}
+
+		stored, err := schema.New(w.bot.DB).GetMessagesWithinTS(ctx, schema.GetMessagesWithinTSParams{
+			ChannelID: job.Args.ChannelID,
+			StartTs:   window.Oldest,
+			EndTs:     window.Latest,
+		})
+		if err != nil {
+			return fmt.Errorf("getting stored messages for channel %s: %w", job.Args.ChannelID, err)
+		}
+		for _, msg := range stored {
+			seen[msg.Ts] = true
+		}
+
+		missing := slices.DeleteFunc(messages, func(message slack.Message) bool {
+			return seen[message.Timestamp]
+		})
+		if len(missing) > 0 {
+			slog.InfoContext(ctx, "repairing backfill gap",
+				"channel_id", job.Args.ChannelID,
+				"oldest", window.Oldest,
+				"latest", window.Latest,
+				"stored", len(stored),
+				"missing", len(missing),
+			)
+		}
+
+		for _, message := range missing {
+			seen[message.Timestamp] = true
+			addMessageParams = append(addMessageParams, schema.AddMessageParams{
+				ChannelID: job.Args.ChannelID,
+				Ts:        message.Timestamp,
+				Attrs: dto.MessageAttrs{
+					Message: dto.SlackMessage{
+						SubType:     message.SubType,
+						Text:        message.Text,
+						User:        message.User,
+						BotID:       message.BotID,
+						BotUsername: message.Username,
+					},
+				},
+			})
+
+			if message.ReplyCount > 0 {
+				backfillThreadInsertParams = append(backfillThreadInsertParams, river.InsertManyParams{
+					Args: background.BackfillThreadWorkerArgs{
+						ChannelID: job.Args.ChannelID,
+						SlackTS:   message.Timestamp,
+					},
+				})
+			}
+		}
+	}
+
+	tx, err := w.bot.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if len(addMessageParams) > 0 {
+		if err := w.bot.AddMessage(ctx, tx, addMessageParams, &river.InsertOpts{
+			Priority: 4,
+		}); err != nil {
+			return fmt.Errorf("adding messages to channel %s: %w", job.Args.ChannelID, err)
+		}
+	}
+
+	if len(backfillThreadInsertParams) > 0 {
+		client := river.ClientFromContext[pgx.Tx](ctx)
+		if _, err := client.InsertManyTx(ctx, tx, backfillThreadInsertParams); err != nil {
+			return fmt.Errorf("inserting backfill thread insert params: %w", err)
+		}
+	}
+
+	if _, err = river.JobCompleteTx[*riverpgxv5.Driver](ctx, tx, job); err != nil {
+		return fmt.Errorf("completing job: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (w *backfillRepairWorker) history(channelID string, window background.BackfillWindow) ([]slack.Message, error) {
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Oldest:    window.Oldest,
+		Latest:    window.Latest,
+		Inclusive: true,
+		Limit:     1000,
+	}
+
+	var messages []slack.Message
+	for {
+		history, err := w.slackClient.GetConversationHistory(params)
+		if err != nil {
+			return nil, fmt.Errorf("getting conversation history for channel ID %s (%s-%s): %w", channelID, window.Oldest, window.Latest, err)
+		}
+
+		messages = append(messages, history.Messages...)
+		if !history.HasMore {
+			break
+		}
+
+		params.Cursor = history.ResponseMetadata.Cursor
+	}
+
+	return messages, nil
+}
@@ -2,12 +2,14 @@ package backfill_thread_worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/background"
 	"github.com/dynoinc/ratchet/internal/storage/schema"
 	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
 	"github.com/slack-go/slack"
@@ -33,6 +35,7 @@ func (w *backfillThreadWorker) Work(ctx context.Context, job *river.Job[backgrou
 		Timestamp: job.Args.SlackTS,
 	}
 
+	var parent *slack.Message
 	var addThreadMessageParams []schema.AddThreadMessageParams
 	for {
 		threadMessages, hasMore, nextCursor, err := w.slackClient.GetConversationReplies(params)
@@ -41,6 +44,10 @@ func (w *backfillThreadWorker) Work(ctx context.Context, job *river.Job[backgrou
 		}
 
 		for _, threadMessage := range threadMessages {
+			if threadMessage.Timestamp == job.Args.SlackTS {
+				parent = &threadMessage
+			}
+
 			addThreadMessageParams = append(addThreadMessageParams, schema.AddThreadMessageParams{
 				ChannelID: job.Args.ChannelID,
 				ParentTs:  job.Args.SlackTS,
@@ -70,6 +77,13 @@ func (w *backfillThreadWorker) Work(ctx context.Context, job *river.Job[backgrou
 	}
 	defer tx.Rollback(ctx)
 
+	// Threads scheduled because a reply arrived for an unknown parent need the parent stored first.
+	if parent != nil {
+		if err := w.addParentIfMissing(ctx, tx, job.Args.ChannelID, parent); err != nil {
+			return err
+		}
+	}
+
 	if len(addThreadMessageParams) > 0 {
 		if err = w.bot.AddThreadMessages(ctx, tx, addThreadMessageParams); err != nil {
 			return fmt.Errorf("adding thread messages to channel %s: %w", job.Args.ChannelID, err)
@@ -82,3 +96,31 @@ func (w *backfillThreadWorker) Work(ctx context.Context, job *river.Job[backgrou
 
 	return tx.Commit(ctx)
 }
+
+func (w *backfillThreadWorker) addParentIfMissing(ctx context.Context, tx pgx.Tx, channelID string, parent *slack.Message) error {
+	if _, err := w.bot.GetMessage(ctx, channelID, parent.Timestamp); err == nil {
+		return nil
+	} else if !errors.Is(err, internal.ErrMessageNotFound) {
+		return err
+	}
+
+	if err := w.bot.AddMessage(ctx, tx, []schema.AddMessageParams{
+		{
+			ChannelID: channelID,
+			Ts:        parent.Timestamp,
+			Attrs: dto.MessageAttrs{
+				Message: dto.SlackMessage{
+					Text:        parent.Text,
+					User:        parent.User,
+					BotID:       parent.BotID,
+					SubType:     parent.SubType,
+					BotUsername: parent.Username,
+				},
+			},
+		},
+	}, nil); err != nil {
+		return fmt.Errorf("adding parent message (ts=%s) to channel %s: %w", parent.Timestamp, channelID, err)
+	}
+
+	return nil
+}
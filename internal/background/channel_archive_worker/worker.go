@@ -0,0 +1,74 @@
+package channel_archive_worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/slack-go/slack"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+)
+
+type channelArchiveWorker struct {
+	river.WorkerDefaults[background.ChannelArchiveWorkerArgs]
+
+	bot         *internal.Bot
+	slackClient *slack.Client
+}
+
+func New(bot *internal.Bot, slackClient *slack.Client) *channelArchiveWorker {
+	return &channelArchiveWorker{
+		bot:         bot,
+		slackClient: slackClient,
+	}
+}
+
+// PeriodicJob returns the periodic job that reconciles archived channels, or nil if interval is 0.
+func PeriodicJob(interval time.Duration) *river.PeriodicJob {
+	if interval <= 0 {
+		return nil
+	}
+
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(interval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return background.ChannelArchiveWorkerArgs{}, nil
+		},
+		nil,
+	)
+}
+
+// Work syncs every channel's archived state with Slack, catching archive events that were
+// missed while the bot was down. A channel that fails to sync doesn't hold up the rest.
+func (w *channelArchiveWorker) Work(ctx context.Context, job *river.Job[background.ChannelArchiveWorkerArgs]) error {
+	channels, err := schema.New(w.bot.DB).GetAllChannels(ctx)
+	if err != nil {
+		return fmt.Errorf("getting channels: %w", err)
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		info, err := w.slackClient.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channel.ID})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("getting conversation info for channel %s: %w", channel.ID, err))
+			continue
+		}
+		if info.IsArchived == channel.Attrs.Archived {
+			continue
+		}
+
+		if err := w.bot.SetChannelArchived(ctx, channel.ID, info.IsArchived); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.InfoContext(ctx, "reconciled channel archive state", "channel_id", channel.ID, "archived", info.IsArchived)
+	}
+
+	return errors.Join(errs...)
+}
@@ -76,6 +76,9 @@ func (w *ChannelOnboardWorker) Work(ctx context.Context, job *river.Job[backgrou
 				},
 			},
 		}
+		if message.Edited != nil {
+			addMessageParams[i].Attrs.Message.EditedTs = message.Edited.Timestamp
+		}
 
 		if message.ReplyCount > 0 {
 			backfillThreadInsertParams = append(backfillThreadInsertParams, river.InsertManyParams{
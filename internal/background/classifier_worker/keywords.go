@@ -0,0 +1,91 @@
+package classifier_worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// keywordRule classifies messages matching Pattern as the embedded incident action without
+// running the classification binary. Named groups "service" and "alert" in Pattern override
+// the rule's Service and Alert. close_incident rules must set both, statically or through a
+// group, since closes are matched to open incidents by service and alert.
+//
+//	[{"pattern": "^\\[FIRING\\] (?P<service>\\S+)/(?P<alert>\\S+)", "action": "open_incident", "priority": "HIGH"}]
+type keywordRule struct {
+	Pattern string `json:"pattern"`
+	// Only match messages from this bot, if set.
+	BotUsername string `json:"bot_username"`
+	dto.IncidentAction
+
+	re *regexp.Regexp
+}
+
+func loadKeywordRules(path string) ([]keywordRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyword rules: %w", err)
+	}
+
+	var rules []keywordRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing keyword rules %s: %w", path, err)
+	}
+
+	for i := range rules {
+		if rules[i].Action != dto.ActionOpenIncident && rules[i].Action != dto.ActionCloseIncident {
+			return nil, fmt.Errorf("keyword rule %d: action must be open_incident or close_incident, got %q", i, rules[i].Action)
+		}
+
+		rules[i].re, err = regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("keyword rule %d: %w", i, err)
+		}
+
+		if rules[i].Action == dto.ActionCloseIncident {
+			if rules[i].Service == "" && rules[i].re.SubexpIndex("service") < 0 {
+				return nil, fmt.Errorf("keyword rule %d: close_incident rule must set a service or capture one", i)
+			}
+			if rules[i].Alert == "" && rules[i].re.SubexpIndex("alert") < 0 {
+				return nil, fmt.Errorf("keyword rule %d: close_incident rule must set an alert or capture one", i)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// matchKeywords returns the incident action of the first rule matching msg.
+func matchKeywords(rules []keywordRule, msg dto.SlackMessage) (dto.IncidentAction, bool) {
+	for _, rule := range rules {
+		if rule.BotUsername != "" && rule.BotUsername != msg.BotUsername {
+			continue
+		}
+
+		match := rule.re.FindStringSubmatch(msg.Text)
+		if match == nil {
+			continue
+		}
+
+		action := rule.IncidentAction
+		if i := rule.re.SubexpIndex("service"); i > 0 && match[i] != "" {
+			action.Service = match[i]
+		}
+		if i := rule.re.SubexpIndex("alert"); i > 0 && match[i] != "" {
+			action.Alert = match[i]
+		}
+		if action.Action == dto.ActionCloseIncident && (action.Service == "" || action.Alert == "") {
+			continue
+		}
+		return action, true
+	}
+
+	return dto.IncidentAction{}, false
+}
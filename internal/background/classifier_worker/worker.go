@@ -21,12 +21,38 @@ import (
 
 type Config struct {
 	IncidentClassificationBinary string `split_words:"true" required:"true"`
+	// Incident actions the binary reports with a confidence below this are stored as
+	// unclassified. Actions reported without a confidence are always kept.
+	MinConfidence float64 `split_words:"true" default:"0"`
+	// JSON file of keyword rules that classify well-structured alert messages without running
+	// the binary. See keywordRule.
+	KeywordRulesFile string `split_words:"true"`
+}
+
+// Validate reports every problem with the configuration.
+func (c Config) Validate() error {
+	var errs []error
+	if c.IncidentClassificationBinary == "" {
+		errs = append(errs, fmt.Errorf("INCIDENT_CLASSIFICATION_BINARY must be set"))
+	} else if _, err := exec.LookPath(c.IncidentClassificationBinary); err != nil {
+		errs = append(errs, fmt.Errorf("INCIDENT_CLASSIFICATION_BINARY %q not found: %w", c.IncidentClassificationBinary, err))
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		errs = append(errs, fmt.Errorf("MIN_CONFIDENCE must be between 0 and 1, got %v", c.MinConfidence))
+	}
+	if _, err := loadKeywordRules(c.KeywordRulesFile); err != nil {
+		errs = append(errs, fmt.Errorf("KEYWORD_RULES_FILE: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
 type classifierWorker struct {
 	river.WorkerDefaults[background.ClassifierArgs]
 
 	incidentBinary string
+	minConfidence  float64
+	keywordRules   []keywordRule
 	bot            *internal.Bot
 	llmClient      *llm.Client
 }
@@ -36,8 +62,15 @@ func New(c Config, bot *internal.Bot, llmClient *llm.Client) (river.Worker[backg
 		return nil, fmt.Errorf("looking up incident classification binary: %w", err)
 	}
 
+	keywordRules, err := loadKeywordRules(c.KeywordRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
 	return &classifierWorker{
 		incidentBinary: c.IncidentClassificationBinary,
+		minConfidence:  c.MinConfidence,
+		keywordRules:   keywordRules,
 		bot:            bot,
 		llmClient:      llmClient,
 	}, nil
@@ -54,24 +87,33 @@ func (w *classifierWorker) Work(ctx context.Context, job *river.Job[background.C
 		return fmt.Errorf("getting message: %w", err)
 	}
 
-	action, err := runIncidentBinary(w.incidentBinary, msg.Message.BotUsername, msg.Message.Text)
+	output, err := w.classify(msg.Message)
 	if err != nil {
-		return fmt.Errorf("classifying incident with binary: %w", err)
+		return err
 	}
 
+	if job.Args.Reclassify {
+		return w.reclassify(ctx, job, msg, output)
+	}
+
+	action, confident := output.classification(w.minConfidence)
 	slog.InfoContext(
 		ctx, "classified incident",
 		"text", msg.Message.Text,
 		"channel_id", job.Args.ChannelID,
 		"slack_ts", job.Args.SlackTS,
 		"action", action,
+		"confident", confident,
 	)
 
 	params := schema.UpdateMessageAttrsParams{
 		ChannelID: job.Args.ChannelID,
 		Ts:        job.Args.SlackTS,
 	}
-	if action.Action != dto.ActionNone {
+	if !confident {
+		// Store as unclassified rather than guessing a service for the LLM to build on.
+		params.Attrs = dto.MessageAttrs{IncidentAction: action}
+	} else if action.Action != dto.ActionNone {
 		params.Attrs = dto.MessageAttrs{IncidentAction: action}
 	} else {
 		services, err := schema.New(w.bot.DB).GetServices(ctx)
@@ -109,12 +151,102 @@ func (w *classifierWorker) Work(ctx context.Context, job *river.Job[background.C
 	return tx.Commit(ctx)
 }
 
+// classify matches msg against the keyword rules, falling back to the classification binary.
+func (w *classifierWorker) classify(msg dto.SlackMessage) (binaryOutput, error) {
+	if action, ok := matchKeywords(w.keywordRules, msg); ok {
+		return binaryOutput{IncidentAction: action}, nil
+	}
+
+	output, err := runIncidentBinary(w.incidentBinary, msg.BotUsername, msg.Text)
+	if err != nil {
+		return binaryOutput{}, fmt.Errorf("classifying incident with binary: %w", err)
+	}
+
+	return output, nil
+}
+
+// reclassify replaces the stored incident action with the binary's current answer. It writes
+// the attrs directly so that reopened incidents don't post or schedule runbooks again.
+func (w *classifierWorker) reclassify(ctx context.Context, job *river.Job[background.ClassifierArgs], msg dto.MessageAttrs, output binaryOutput) error {
+	attrs, changed := reclassifiedAttrs(msg, output, w.minConfidence)
+	if changed {
+		slog.InfoContext(ctx, "reclassified incident",
+			"channel_id", job.Args.ChannelID,
+			"slack_ts", job.Args.SlackTS,
+			"old_action", msg.IncidentAction,
+			"new_action", attrs.IncidentAction,
+		)
+	}
+
+	tx, err := w.bot.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if changed {
+		qtx := schema.New(w.bot.DB).WithTx(tx)
+		if err := qtx.UpdateMessageAttrs(ctx, schema.UpdateMessageAttrsParams{
+			ChannelID: job.Args.ChannelID,
+			Ts:        job.Args.SlackTS,
+			Attrs:     attrs,
+		}); err != nil {
+			return fmt.Errorf("updating message attrs: %w", err)
+		}
+
+		if err := qtx.AcknowledgeIncidentFromThread(ctx, schema.AcknowledgeIncidentFromThreadParams{
+			ChannelID: job.Args.ChannelID,
+			Ts:        job.Args.SlackTS,
+		}); err != nil {
+			return fmt.Errorf("acknowledging incident: %w", err)
+		}
+	}
+
+	if _, err = river.JobCompleteTx[*riverpgxv5.Driver](ctx, tx, job); err != nil {
+		return fmt.Errorf("completing job: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// reclassifiedAttrs returns the attrs to merge into msg for the binary's new output, and
+// whether anything changed. Synthetic messages are left alone.
+func reclassifiedAttrs(msg dto.MessageAttrs, output binaryOutput, minConfidence float64) (dto.MessageAttrs, bool) {
+	if msg.Synthetic {
+		return dto.MessageAttrs{}, false
+	}
+
+	action, _ := output.classification(minConfidence)
+	if action == msg.IncidentAction || (action.Action == dto.ActionNone && msg.IncidentAction.Action == "") {
+		return dto.MessageAttrs{}, false
+	}
+
+	return dto.MessageAttrs{IncidentAction: action}, true
+}
+
+// binaryOutput is what the classification binary prints: an incident action, optionally with
+// a confidence between 0 and 1.
+type binaryOutput struct {
+	dto.IncidentAction
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// classification returns the incident action to store and whether the binary was confident
+// enough in it. Low confidence actions are replaced with ActionNone.
+func (o binaryOutput) classification(minConfidence float64) (dto.IncidentAction, bool) {
+	if o.Action == dto.ActionNone || o.Confidence == nil || *o.Confidence >= minConfidence {
+		return o.IncidentAction, true
+	}
+
+	return dto.IncidentAction{Action: dto.ActionNone}, false
+}
+
 type binaryInput struct {
 	Username string `json:"username"`
 	Text     string `json:"text"`
 }
 
-func runIncidentBinary(binaryPath string, username, text string) (dto.IncidentAction, error) {
+func runIncidentBinary(binaryPath string, username, text string) (binaryOutput, error) {
 	input := binaryInput{
 		Username: username,
 		Text:     text,
@@ -122,7 +254,7 @@ func runIncidentBinary(binaryPath string, username, text string) (dto.IncidentAc
 
 	inputJSON, err := json.Marshal(input)
 	if err != nil {
-		return dto.IncidentAction{}, fmt.Errorf("failed to marshal input: %w", err)
+		return binaryOutput{}, fmt.Errorf("failed to marshal input: %w", err)
 	}
 
 	var stdout bytes.Buffer
@@ -131,12 +263,12 @@ func runIncidentBinary(binaryPath string, username, text string) (dto.IncidentAc
 	cmd.Stdout = &stdout
 
 	if err := cmd.Run(); err != nil {
-		return dto.IncidentAction{}, fmt.Errorf("failed to run binary %s: %w", binaryPath, err)
+		return binaryOutput{}, fmt.Errorf("failed to run binary %s: %w", binaryPath, err)
 	}
 
-	var output dto.IncidentAction
+	var output binaryOutput
 	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
-		return dto.IncidentAction{}, fmt.Errorf("failed to parse output from binary: %w", err)
+		return binaryOutput{}, fmt.Errorf("failed to parse output from binary: %w", err)
 	}
 
 	return output, nil
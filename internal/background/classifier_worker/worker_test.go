@@ -1,36 +1,56 @@
 package classifier_worker
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
 	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
 )
 
 func TestClassifierWorker(t *testing.T) {
-	outputs := map[string]dto.IncidentAction{
-		"OPEN_HIGH": {
+	outputs := map[string]binaryOutput{
+		"OPEN_HIGH": {IncidentAction: dto.IncidentAction{
 			Action:   dto.ActionOpenIncident,
 			Alert:    "fake-alert",
 			Service:  "fake-service",
 			Priority: dto.PriorityHigh,
-		},
-		"OPEN_LOW": {
+		}},
+		"OPEN_LOW": {IncidentAction: dto.IncidentAction{
 			Action:   dto.ActionOpenIncident,
 			Alert:    "fake-alert",
 			Service:  "fake-service",
 			Priority: dto.PriorityLow,
-		},
-		"CLOSE": {
+		}},
+		"CLOSE": {IncidentAction: dto.IncidentAction{
 			Action:  dto.ActionCloseIncident,
 			Alert:   "fake-alert",
 			Service: "fake-service",
-		},
-		"NONE": {
+		}},
+		"NONE": {IncidentAction: dto.IncidentAction{
 			Action: dto.ActionNone,
+		}},
+		"OPEN_UNSURE": {
+			IncidentAction: dto.IncidentAction{
+				Action:   dto.ActionOpenIncident,
+				Alert:    "fake-alert",
+				Service:  "fake-service",
+				Priority: dto.PriorityHigh,
+			},
+			Confidence: confidence(0.4),
 		},
 	}
 
@@ -57,3 +77,233 @@ func TestClassifierWorker(t *testing.T) {
 		})
 	}
 }
+
+func TestClassificationConfidence(t *testing.T) {
+	open := dto.IncidentAction{
+		Action:   dto.ActionOpenIncident,
+		Alert:    "fake-alert",
+		Service:  "fake-service",
+		Priority: dto.PriorityHigh,
+	}
+
+	action, confident := binaryOutput{IncidentAction: open, Confidence: confidence(0.4)}.classification(0.7)
+	require.False(t, confident)
+	require.Equal(t, dto.IncidentAction{Action: dto.ActionNone}, action)
+
+	action, confident = binaryOutput{IncidentAction: open, Confidence: confidence(0.9)}.classification(0.7)
+	require.True(t, confident)
+	require.Equal(t, open, action)
+
+	action, confident = binaryOutput{IncidentAction: open}.classification(0.7)
+	require.True(t, confident)
+	require.Equal(t, open, action)
+}
+
+func confidence(c float64) *float64 {
+	return &c
+}
+
+func TestReclassifiedAttrs(t *testing.T) {
+	open := dto.IncidentAction{
+		Action:   dto.ActionOpenIncident,
+		Alert:    "fake-alert",
+		Service:  "fake-service",
+		Priority: dto.PriorityHigh,
+	}
+
+	attrs, changed := reclassifiedAttrs(dto.MessageAttrs{IncidentAction: open}, binaryOutput{IncidentAction: dto.IncidentAction{Action: dto.ActionNone}}, 0)
+	require.True(t, changed)
+	require.Equal(t, dto.MessageAttrs{IncidentAction: dto.IncidentAction{Action: dto.ActionNone}}, attrs)
+
+	attrs, changed = reclassifiedAttrs(dto.MessageAttrs{}, binaryOutput{IncidentAction: open}, 0)
+	require.True(t, changed)
+	require.Equal(t, dto.MessageAttrs{IncidentAction: open}, attrs)
+
+	_, changed = reclassifiedAttrs(dto.MessageAttrs{IncidentAction: open}, binaryOutput{IncidentAction: open}, 0)
+	require.False(t, changed)
+
+	_, changed = reclassifiedAttrs(dto.MessageAttrs{}, binaryOutput{IncidentAction: dto.IncidentAction{Action: dto.ActionNone}}, 0)
+	require.False(t, changed)
+
+	_, changed = reclassifiedAttrs(dto.MessageAttrs{IncidentAction: open, Synthetic: true}, binaryOutput{IncidentAction: dto.IncidentAction{Action: dto.ActionNone}}, 0)
+	require.False(t, changed)
+}
+
+func TestKeywordRulesSkipBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"pattern": "^\\[FIRING\\] (?P<service>\\S+)/(?P<alert>\\S+)", "bot_username": "alertmanager", "action": "open_incident", "priority": "HIGH"},
+		{"pattern": "(?i)\\b(resolved|mitigated|stand down)\\b:? (?P<service>\\S+)/(?P<alert>\\S+)", "bot_username": "alertmanager", "action": "close_incident"}
+	]`), 0o600))
+
+	rules, err := loadKeywordRules(path)
+	require.NoError(t, err)
+
+	// The binary does not exist, so only keyword matches can succeed.
+	w := &classifierWorker{incidentBinary: filepath.Join(t.TempDir(), "missing"), keywordRules: rules}
+
+	output, err := w.classify(dto.SlackMessage{BotUsername: "alertmanager", Text: "[FIRING] payments/HighLatency p99 > 2s"})
+	require.NoError(t, err)
+	require.Equal(t, binaryOutput{IncidentAction: dto.IncidentAction{
+		Action:   dto.ActionOpenIncident,
+		Service:  "payments",
+		Alert:    "HighLatency",
+		Priority: dto.PriorityHigh,
+	}}, output)
+
+	output, err = w.classify(dto.SlackMessage{BotUsername: "alertmanager", Text: "Mitigated: payments/HighLatency"})
+	require.NoError(t, err)
+	require.Equal(t, binaryOutput{IncidentAction: dto.IncidentAction{
+		Action:  dto.ActionCloseIncident,
+		Service: "payments",
+		Alert:   "HighLatency",
+	}}, output)
+
+	_, err = w.classify(dto.SlackMessage{BotUsername: "someone-else", Text: "[FIRING] payments/HighLatency"})
+	require.Error(t, err)
+}
+
+func TestKeywordRulesRejectUnscopedClose(t *testing.T) {
+	for _, rule := range []string{
+		`{"pattern": "(?i)\\bresolved\\b", "action": "close_incident"}`,
+		`{"pattern": "(?i)\\bresolved\\b (?P<service>\\S+)", "action": "close_incident"}`,
+	} {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		require.NoError(t, os.WriteFile(path, []byte("["+rule+"]"), 0o600))
+
+		_, err := loadKeywordRules(path)
+		require.Error(t, err, rule)
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"pattern": "(?i)\\bresolved\\b (?P<service>\\S+)", "alert": "HighLatency", "action": "close_incident"}
+	]`), 0o600))
+	_, err := loadKeywordRules(path)
+	require.NoError(t, err)
+}
+
+func setupTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	_, err := schema.New(db).AddChannel(ctx, "C1")
+	require.NoError(t, err)
+
+	return db
+}
+
+// runClassifier runs a classifier job for args through River, classifying with keyword rules
+// only, and waits for it to complete.
+func runClassifier(t *testing.T, db *pgxpool.Pool, rules string, args background.ClassifierArgs) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0o600))
+
+	bot := internal.New(db, nil, nil, false, false)
+	w, err := New(Config{IncidentClassificationBinary: "true", KeywordRulesFile: path}, bot, nil)
+	require.NoError(t, err)
+
+	workers := river.NewWorkers()
+	river.AddWorker(workers, w)
+	riverClient, err := river.NewClient(riverpgxv5.New(db), &river.Config{
+		Queues:  map[string]river.QueueConfig{river.QueueDefault: {MaxWorkers: 1}},
+		Workers: workers,
+	})
+	require.NoError(t, err)
+	require.NoError(t, bot.Init(riverClient))
+
+	events, cancel := riverClient.Subscribe(river.EventKindJobCompleted, river.EventKindJobFailed)
+	t.Cleanup(cancel)
+
+	ctx := context.Background()
+	require.NoError(t, riverClient.Start(ctx))
+	t.Cleanup(func() { _ = riverClient.Stop(ctx) })
+
+	_, err = riverClient.Insert(ctx, args, nil)
+	require.NoError(t, err)
+
+	for {
+		select {
+		case event := <-events:
+			if event.Job.Kind != args.Kind() {
+				continue
+			}
+			require.Equal(t, river.EventKindJobCompleted, event.Kind, "classifier job failed: %v", event.Job.Errors)
+			return
+		case <-time.After(30 * time.Second):
+			t.Fatal("timed out waiting for classifier job")
+		}
+	}
+}
+
+func TestClassificationAcknowledgesEarlierReply(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddMessage(t.Context(), schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "1700000000.000000",
+		Attrs: dto.MessageAttrs{Message: dto.SlackMessage{
+			BotUsername: "alertmanager",
+			Text:        "[FIRING] payments/HighLatency p99 > 2s",
+		}},
+	})
+	require.NoError(t, err)
+
+	// Replies are stored before the classifier gets to the alert.
+	for ts, msg := range map[string]dto.SlackMessage{
+		"1700000030.000000": {BotID: "B1", Text: "runbook: ..."},
+		"1700000060.000000": {User: "U1", Text: "looking"},
+		"1700000090.000000": {User: "U2", Text: "me too"},
+	} {
+		require.NoError(t, q.AddThreadMessage(t.Context(), schema.AddThreadMessageParams{
+			ChannelID: "C1",
+			ParentTs:  "1700000000.000000",
+			Ts:        ts,
+			Attrs:     dto.ThreadMessageAttrs{Message: msg},
+		}))
+	}
+
+	runClassifier(t, db, `[{"pattern": "^\\[FIRING\\] (?P<service>\\S+)/(?P<alert>\\S+)", "action": "open_incident", "priority": "HIGH"}]`,
+		background.ClassifierArgs{ChannelID: "C1", SlackTS: "1700000000.000000"})
+
+	msg, err := q.GetMessage(t.Context(), schema.GetMessageParams{ChannelID: "C1", Ts: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Equal(t, dto.ActionOpenIncident, msg.Attrs.IncidentAction.Action)
+	require.Equal(t, "1700000060.000000", msg.Attrs.AcknowledgedTs)
+}
+
+func TestReclassificationKeepsEnrichments(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	impact := dto.IncidentImpact{DowntimeMinutes: 30, AffectedUsers: 100}
+	_, err := q.AddMessage(t.Context(), schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "1700000000.000000",
+		Attrs: dto.MessageAttrs{
+			Message: dto.SlackMessage{BotUsername: "alertmanager", Text: "[FIRING] search/IndexLag lag > 5m"},
+			// Classified by an older prompt that got the service wrong.
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "IndexLag", Priority: dto.PriorityLow},
+			AcknowledgedTs: "1700000060.000000",
+			OwnerID:        "U1",
+			Impact:         impact,
+		},
+	})
+	require.NoError(t, err)
+
+	runClassifier(t, db, `[{"pattern": "^\\[FIRING\\] (?P<service>\\S+)/(?P<alert>\\S+)", "action": "open_incident", "priority": "HIGH"}]`,
+		background.ClassifierArgs{ChannelID: "C1", SlackTS: "1700000000.000000", Reclassify: true})
+
+	msg, err := q.GetMessage(t.Context(), schema.GetMessageParams{ChannelID: "C1", Ts: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Equal(t, dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "search", Alert: "IndexLag", Priority: dto.PriorityHigh}, msg.Attrs.IncidentAction)
+	require.Equal(t, "1700000060.000000", msg.Attrs.AcknowledgedTs)
+	require.Equal(t, "U1", msg.Attrs.OwnerID)
+	require.Equal(t, impact, msg.Attrs.Impact)
+	require.Equal(t, "[FIRING] search/IndexLag lag > 5m", msg.Attrs.Message.Text)
+}
@@ -1,14 +1,21 @@
 package background
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
 )
 
-func New(db *pgxpool.Pool, workers *river.Workers) (*river.Client[pgx.Tx], error) {
+func New(db *pgxpool.Pool, workers *river.Workers, periodicJobs []*river.PeriodicJob) (*river.Client[pgx.Tx], error) {
 	return river.NewClient(riverpgxv5.New(db), &river.Config{
+		PeriodicJobs: periodicJobs,
 		Queues: map[string]river.QueueConfig{
 			river.QueueDefault: {
 				MaxWorkers: 10,
@@ -16,7 +23,32 @@ func New(db *pgxpool.Pool, workers *river.Workers) (*river.Client[pgx.Tx], error
 			"update_runbook": {
 				MaxWorkers: 1,
 			},
+			"reclassify": {
+				MaxWorkers: 1,
+			},
 		},
 		Workers: workers,
 	})
 }
+
+// cancelTimeout bounds how long Drain waits for cancelled jobs to return, so a job that ignores
+// cancellation can't hold up shutdown.
+const cancelTimeout = 5 * time.Second
+
+// Drain stops fetching new jobs and gives running jobs until ctx is done to finish. Jobs still
+// running after that have their contexts cancelled and are retried later.
+func Drain(ctx context.Context, client *river.Client[pgx.Tx]) error {
+	err := client.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	slog.Warn("jobs still running after drain deadline, cancelling them")
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTimeout)
+	defer cancel()
+	if err := client.StopAndCancel(cancelCtx); err != nil {
+		return fmt.Errorf("cancelling running jobs: %w", err)
+	}
+
+	return nil
+}
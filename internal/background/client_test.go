@@ -0,0 +1,99 @@
+package background
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+type slowJobArgs struct{}
+
+func (slowJobArgs) Kind() string { return "slow_job" }
+
+type slowJobWorker struct {
+	river.WorkerDefaults[slowJobArgs]
+
+	started  chan struct{}
+	finished atomic.Bool
+}
+
+func (w *slowJobWorker) Work(ctx context.Context, job *river.Job[slowJobArgs]) error {
+	close(w.started)
+	select {
+	case <-time.After(500 * time.Millisecond):
+		w.finished.Store(true)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestDrainLetsRunningJobFinish(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	worker := &slowJobWorker{started: make(chan struct{})}
+	workers := river.NewWorkers()
+	river.AddWorker(workers, worker)
+
+	client, err := New(db, workers, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+
+	_, err = client.Insert(ctx, slowJobArgs{}, nil)
+	require.NoError(t, err)
+	<-worker.started
+
+	drainCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, Drain(drainCtx, client))
+	require.True(t, worker.finished.Load())
+}
+
+type stuckJobArgs struct{}
+
+func (stuckJobArgs) Kind() string { return "stuck_job" }
+
+// stuckJobWorker ignores cancellation until released.
+type stuckJobWorker struct {
+	river.WorkerDefaults[stuckJobArgs]
+
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (w *stuckJobWorker) Work(ctx context.Context, job *river.Job[stuckJobArgs]) error {
+	close(w.started)
+	<-w.released
+	return nil
+}
+
+func TestDrainGivesUpOnJobIgnoringCancellation(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	worker := &stuckJobWorker{started: make(chan struct{}), released: make(chan struct{})}
+	t.Cleanup(func() { close(worker.released) })
+	workers := river.NewWorkers()
+	river.AddWorker(workers, worker)
+
+	client, err := New(db, workers, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+
+	_, err = client.Insert(ctx, stuckJobArgs{}, nil)
+	require.NoError(t, err)
+	<-worker.started
+
+	drainCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.Error(t, Drain(drainCtx, client))
+	require.Less(t, time.Since(start), cancelTimeout+time.Second)
+}
@@ -0,0 +1,122 @@
+package incident_duration_worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/riverqueue/river"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+type incidentDurationWorker struct {
+	river.WorkerDefaults[background.IncidentDurationWorkerArgs]
+
+	bot *internal.Bot
+}
+
+func New(bot *internal.Bot) *incidentDurationWorker {
+	return &incidentDurationWorker{bot: bot}
+}
+
+// Work fills in the duration of close_incident messages that were stored without one, by
+// pairing them with the open_incident they resolved.
+func (w *incidentDurationWorker) Work(ctx context.Context, job *river.Job[background.IncidentDurationWorkerArgs]) error {
+	messages, err := schema.New(w.bot.DB).GetMessagesWithinTS(ctx, schema.GetMessagesWithinTSParams{
+		ChannelID: job.Args.ChannelID,
+		StartTs:   "0",
+		EndTs:     internal.TimeToTs(time.Now()),
+	})
+	if err != nil {
+		return fmt.Errorf("getting messages for channel %s: %w", job.Args.ChannelID, err)
+	}
+
+	updates, unmatched, err := pairDurations(messages)
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "backfilling incident durations",
+		"channel_id", job.Args.ChannelID,
+		"updated", len(updates),
+		"unmatched_closes", unmatched,
+	)
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx, err := w.bot.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, update := range updates {
+		if err := w.bot.UpdateMessage(ctx, tx, update); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// pairDurations pairs each close_incident that has no duration with the open_incidents of the
+// same service and alert before it. A close resolves every open since the previous close, and
+// its duration is measured from the earliest of them. It returns the updates to apply and the
+// number of closes that had no open to pair with.
+func pairDurations(messages []schema.MessagesV2) ([]schema.UpdateMessageAttrsParams, int, error) {
+	messages = slices.Clone(messages)
+	slices.SortFunc(messages, func(a, b schema.MessagesV2) int { return strings.Compare(a.Ts, b.Ts) })
+
+	type incidentKey struct{ service, alert string }
+	opened := make(map[incidentKey]string) // earliest unresolved open_incident ts
+	var updates []schema.UpdateMessageAttrsParams
+	unmatched := 0
+	for _, msg := range messages {
+		action := msg.Attrs.IncidentAction
+		key := incidentKey{action.Service, action.Alert}
+
+		switch action.Action {
+		case dto.ActionOpenIncident:
+			if _, ok := opened[key]; !ok {
+				opened[key] = msg.Ts
+			}
+		case dto.ActionCloseIncident:
+			openTs, ok := opened[key]
+			delete(opened, key)
+			if action.Duration.Duration != 0 {
+				continue
+			}
+			if !ok {
+				unmatched++
+				continue
+			}
+
+			openedAt, err := internal.TsToTime(openTs)
+			if err != nil {
+				return nil, 0, fmt.Errorf("parsing open incident ts: %w", err)
+			}
+			closedAt, err := internal.TsToTime(msg.Ts)
+			if err != nil {
+				return nil, 0, fmt.Errorf("parsing close incident ts: %w", err)
+			}
+
+			action.Duration.Duration = closedAt.Sub(openedAt)
+			updates = append(updates, schema.UpdateMessageAttrsParams{
+				ChannelID: msg.ChannelID,
+				Ts:        msg.Ts,
+				Attrs:     dto.MessageAttrs{IncidentAction: action},
+			})
+		}
+	}
+
+	return updates, unmatched, nil
+}
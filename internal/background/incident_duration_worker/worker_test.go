@@ -0,0 +1,43 @@
+package incident_duration_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+func TestPairDurations(t *testing.T) {
+	incident := func(ts string, action dto.IncidentAction) schema.MessagesV2 {
+		action.Service = "payments"
+		return schema.MessagesV2{ChannelID: "C1", Ts: ts, Attrs: dto.MessageAttrs{IncidentAction: action}}
+	}
+	open := func(alert string) dto.IncidentAction {
+		return dto.IncidentAction{Action: dto.ActionOpenIncident, Alert: alert}
+	}
+	closed := func(alert string) dto.IncidentAction {
+		return dto.IncidentAction{Action: dto.ActionCloseIncident, Alert: alert}
+	}
+
+	alreadySet := incident("1900.000000", closed("DiskFull"))
+	alreadySet.Attrs.IncidentAction.Duration.Duration = time.Minute
+
+	updates, unmatched, err := pairDurations([]schema.MessagesV2{
+		incident("1600.000000", closed("HighLatency")),
+		incident("1000.000000", open("HighLatency")),
+		incident("1300.000000", open("HighLatency")),
+		incident("1200.000000", closed("ErrorRate")),
+		incident("1800.000000", open("DiskFull")),
+		alreadySet,
+		incident("2000.000000", open("ErrorRate")),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, unmatched)
+	require.Len(t, updates, 1)
+	require.Equal(t, "1600.000000", updates[0].Ts)
+	require.Equal(t, dto.ActionCloseIncident, updates[0].Attrs.IncidentAction.Action)
+	require.Equal(t, 10*time.Minute, updates[0].Attrs.IncidentAction.Duration.Duration)
+}
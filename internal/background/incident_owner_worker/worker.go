@@ -0,0 +1,74 @@
+package incident_owner_worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/riverqueue/river"
+	"github.com/slack-go/slack"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+)
+
+type incidentOwnerWorker struct {
+	river.WorkerDefaults[background.IncidentOwnerWorkerArgs]
+
+	bot          *internal.Bot
+	slackClient  *slack.Client
+	devChannelID string
+}
+
+func New(bot *internal.Bot, slackClient *slack.Client, devChannelID string) *incidentOwnerWorker {
+	return &incidentOwnerWorker{
+		bot:          bot,
+		slackClient:  slackClient,
+		devChannelID: devChannelID,
+	}
+}
+
+// Work announces an incident's new owner in its thread. The owner itself is already recorded on
+// the incident when the job is queued.
+func (w *incidentOwnerWorker) Work(ctx context.Context, job *river.Job[background.IncidentOwnerWorkerArgs]) error {
+	msg, err := w.bot.GetMessage(ctx, job.Args.ChannelID, job.Args.SlackTS)
+	if err != nil {
+		if errors.Is(err, internal.ErrMessageNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("getting incident message: %w", err)
+	}
+
+	// Reassigned again before this job ran; that assignment announces itself.
+	if msg.OwnerID != job.Args.OwnerID {
+		return nil
+	}
+
+	allowed, err := w.bot.IsChannelAllowed(ctx, job.Args.ChannelID)
+	if err != nil {
+		return fmt.Errorf("checking channel allowlist: %w", err)
+	}
+	if !allowed {
+		return nil
+	}
+
+	// A synthetic incident's ts isn't a Slack message, so there is no thread to announce in.
+	channelID, threadTS := job.Args.ChannelID, job.Args.SlackTS
+	if msg.Synthetic {
+		threadTS = ""
+	}
+	if w.devChannelID != "" {
+		channelID, threadTS = w.devChannelID, ""
+	}
+
+	opts := []slack.MsgOption{slack.MsgOptionText(fmt.Sprintf("*Owner:* <@%s>", job.Args.OwnerID), false)}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := w.slackClient.PostMessageContext(ctx, channelID, opts...); err != nil {
+		return fmt.Errorf("posting incident owner: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package incident_resolution_worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+type Config struct {
+	Enabled bool `default:"false"`
+
+	// How often to scan for unresolved incidents.
+	Interval time.Duration `default:"1h"`
+	// Incidents younger than MinAge are left alone to give responders a chance to close them.
+	MinAge time.Duration `split_words:"true" default:"1h"`
+	// Incidents older than Lookback are not scanned.
+	Lookback time.Duration `default:"168h"`
+	// How long one scan may take. Every incident with new replies costs an LLM call.
+	Timeout time.Duration `default:"30m"`
+}
+
+// Validate reports every problem with the configuration. Nothing is checked when disabled.
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("INTERVAL must be positive, got %s", c.Interval))
+	}
+	if c.MinAge < 0 {
+		errs = append(errs, fmt.Errorf("MIN_AGE must not be negative, got %s", c.MinAge))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("TIMEOUT must be positive, got %s", c.Timeout))
+	}
+	if c.Lookback <= c.MinAge {
+		errs = append(errs, fmt.Errorf("LOOKBACK (%s) must be longer than MIN_AGE (%s)", c.Lookback, c.MinAge))
+	}
+
+	return errors.Join(errs...)
+}
+
+type incidentResolutionWorker struct {
+	river.WorkerDefaults[background.IncidentResolutionWorkerArgs]
+
+	bot       *internal.Bot
+	llmClient *llm.Client
+	minAge    time.Duration
+	lookback  time.Duration
+	timeout   time.Duration
+}
+
+func New(c Config, bot *internal.Bot, llmClient *llm.Client) *incidentResolutionWorker {
+	return &incidentResolutionWorker{
+		bot:       bot,
+		llmClient: llmClient,
+		minAge:    c.MinAge,
+		lookback:  c.Lookback,
+		timeout:   c.Timeout,
+	}
+}
+
+// PeriodicJob returns the periodic job that scans for unresolved incidents, or nil if disabled.
+func PeriodicJob(c Config) *river.PeriodicJob {
+	if !c.Enabled {
+		return nil
+	}
+
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(c.Interval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return background.IncidentResolutionWorkerArgs{}, nil
+		},
+		nil,
+	)
+}
+
+func (w *incidentResolutionWorker) Timeout(*river.Job[background.IncidentResolutionWorkerArgs]) time.Duration {
+	return w.timeout
+}
+
+// Work checks every unresolved incident in the lookback window. A failure on one incident
+// doesn't stop the others from being checked.
+func (w *incidentResolutionWorker) Work(ctx context.Context, job *river.Job[background.IncidentResolutionWorkerArgs]) error {
+	now := time.Now()
+	incidents, err := schema.New(w.bot.DB).GetUnresolvedIncidents(ctx, schema.GetUnresolvedIncidentsParams{
+		StartTs: internal.TimeToTs(now.Add(-w.lookback)),
+		EndTs:   internal.TimeToTs(now.Add(-w.minAge)),
+	})
+	if err != nil {
+		return fmt.Errorf("getting unresolved incidents: %w", err)
+	}
+
+	var errs []error
+	for _, incident := range incidents {
+		if err := w.checkIncident(ctx, incident); err != nil {
+			errs = append(errs, fmt.Errorf("checking incident (ts=%s) in channel %s: %w", incident.Ts, incident.ChannelID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *incidentResolutionWorker) checkIncident(ctx context.Context, incident schema.MessagesV2) error {
+	threadMsgs, err := schema.New(w.bot.DB).GetThreadMessages(ctx, schema.GetThreadMessagesParams{
+		ChannelID: incident.ChannelID,
+		ParentTs:  incident.Ts,
+	})
+	if err != nil {
+		return fmt.Errorf("getting thread messages: %w", err)
+	}
+
+	if len(threadMsgs) == 0 || threadMsgs[len(threadMsgs)-1].Ts == incident.Attrs.ResolutionCheckedTs {
+		return nil
+	}
+
+	idx, resolved, err := w.llmClient.DetectResolution(ctx, incident.Attrs, threadMsgs)
+	if err != nil {
+		return fmt.Errorf("detecting resolution: %w", err)
+	}
+
+	tx, err := w.bot.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := w.bot.UpdateMessage(ctx, tx, schema.UpdateMessageAttrsParams{
+		ChannelID: incident.ChannelID,
+		Ts:        incident.Ts,
+		Attrs:     dto.MessageAttrs{ResolutionCheckedTs: threadMsgs[len(threadMsgs)-1].Ts},
+	}); err != nil {
+		return fmt.Errorf("marking incident as checked: %w", err)
+	}
+
+	if resolved {
+		if err := w.closeIncident(ctx, tx, incident, threadMsgs[idx]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// closeIncident records a synthetic close_incident at the thread message that resolved the incident.
+func (w *incidentResolutionWorker) closeIncident(ctx context.Context, tx pgx.Tx, incident schema.MessagesV2, resolvedBy schema.ThreadMessagesV2) error {
+	openedAt, err := internal.TsToTime(incident.Ts)
+	if err != nil {
+		return fmt.Errorf("parsing incident ts: %w", err)
+	}
+
+	resolvedAt, err := internal.TsToTime(resolvedBy.Ts)
+	if err != nil {
+		return fmt.Errorf("parsing resolution ts: %w", err)
+	}
+
+	action := dto.IncidentAction{
+		Action:  dto.ActionCloseIncident,
+		Service: incident.Attrs.IncidentAction.Service,
+		Alert:   incident.Attrs.IncidentAction.Alert,
+	}
+	action.Duration.Duration = resolvedAt.Sub(openedAt)
+
+	slog.InfoContext(ctx, "auto-closing resolved incident",
+		"channel_id", incident.ChannelID,
+		"slack_ts", incident.Ts,
+		"resolved_ts", resolvedBy.Ts,
+		"duration", action.Duration.Duration,
+	)
+
+	if err := w.bot.AddMessage(ctx, tx, []schema.AddMessageParams{
+		{
+			ChannelID: incident.ChannelID,
+			Ts:        resolvedBy.Ts,
+			Attrs: dto.MessageAttrs{
+				Message:        resolvedBy.Attrs.Message,
+				IncidentAction: action,
+				Synthetic:      true,
+			},
+		},
+	}, nil); err != nil {
+		return fmt.Errorf("adding close incident message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package incident_resolution_worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestResolvedIncidentIsClosed(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	q := schema.New(db)
+	_, err := q.AddChannel(ctx, "C1")
+	require.NoError(t, err)
+
+	openedAt := time.Now().Add(-3 * time.Hour)
+	incidentTs := internal.TimeToTs(openedAt)
+	_, err = q.AddMessage(ctx, schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        incidentTs,
+		Attrs: dto.MessageAttrs{
+			Message:        dto.SlackMessage{BotUsername: "alertmanager", Text: "[FIRING] payments/HighLatency"},
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+		},
+	})
+	require.NoError(t, err)
+	replies := []string{"looking into it", "rolled back the deploy, fixed"}
+	for i, text := range replies {
+		require.NoError(t, q.AddThreadMessage(ctx, schema.AddThreadMessageParams{
+			ChannelID: "C1",
+			ParentTs:  incidentTs,
+			Ts:        internal.TimeToTs(openedAt.Add(time.Duration(i+1) * 10 * time.Minute)),
+			Attrs:     dto.ThreadMessageAttrs{Message: dto.SlackMessage{User: "U1", Text: text}},
+		}))
+	}
+
+	llmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/models/") {
+			_, _ = fmt.Fprintf(w, `{"id":%q,"object":"model"}`, strings.TrimPrefix(r.URL.Path, "/models/"))
+			return
+		}
+		content, _ := json.Marshal(`{"resolved": true, "message_index": 1, "confidence": "high"}`)
+		_, _ = fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":"test-model","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":%s}}]}`, content)
+	}))
+	t.Cleanup(llmSrv.Close)
+	llmClient, err := llm.New(ctx, llm.Config{URL: llmSrv.URL + "/", APIKey: "test", Model: "test-model", MessageFormat: llm.MessageFormatPlain})
+	require.NoError(t, err)
+
+	w := New(Config{MinAge: time.Hour, Lookback: 24 * time.Hour}, internal.New(db, nil, nil, false, false), llmClient)
+	require.NoError(t, w.Work(ctx, &river.Job[background.IncidentResolutionWorkerArgs]{}))
+
+	unresolved, err := q.GetUnresolvedIncidents(ctx, schema.GetUnresolvedIncidentsParams{
+		StartTs: internal.TimeToTs(openedAt.Add(-time.Minute)),
+		EndTs:   internal.TimeToTs(time.Now()),
+	})
+	require.NoError(t, err)
+	require.Empty(t, unresolved)
+
+	closedAt := internal.TimeToTs(openedAt.Add(20 * time.Minute))
+	closed, err := q.GetMessage(ctx, schema.GetMessageParams{ChannelID: "C1", Ts: closedAt})
+	require.NoError(t, err)
+	require.True(t, closed.Attrs.Synthetic)
+	require.Equal(t, dto.ActionCloseIncident, closed.Attrs.IncidentAction.Action)
+	require.Equal(t, 20*time.Minute, closed.Attrs.IncidentAction.Duration.Duration)
+}
@@ -0,0 +1,116 @@
+package background
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/riverqueue/river"
+	"github.com/robfig/cron/v3"
+)
+
+// PeriodicJobConfig defines a job to insert on a schedule, as read from the periodic jobs file.
+type PeriodicJobConfig struct {
+	Kind string `json:"kind"`
+	// Standard 5-field cron expression, or a descriptor like "@daily" or "@every 1h".
+	Schedule string `json:"schedule"`
+	// Arguments for the job, e.g. {"channel_id": "C123"} for a report.
+	Args json.RawMessage `json:"args,omitzero"`
+	// Also insert the job when ratchet starts, not just on schedule.
+	RunOnStart bool `json:"run_on_start,omitzero"`
+}
+
+// periodicKinds decodes the arguments of each job kind that can be scheduled from config.
+var periodicKinds = map[string]func(json.RawMessage) (river.JobArgs, error){
+	ReportWorkerArgs{}.Kind():             decodeArgs[ReportWorkerArgs],
+	IncidentResolutionWorkerArgs{}.Kind(): decodeArgs[IncidentResolutionWorkerArgs],
+	IncidentDurationWorkerArgs{}.Kind():   decodeArgs[IncidentDurationWorkerArgs],
+}
+
+func decodeArgs[T river.JobArgs](raw json.RawMessage) (river.JobArgs, error) {
+	var args T
+	if len(raw) == 0 {
+		return args, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&args); err != nil {
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// periodicJob is a PeriodicJobConfig with its schedule and arguments parsed.
+type periodicJob struct {
+	schedule   cron.Schedule
+	args       river.JobArgs
+	runOnStart bool
+}
+
+// LoadPeriodicJobs reads a JSON list of PeriodicJobConfig from path. An empty path means no jobs.
+func LoadPeriodicJobs(path string) ([]*river.PeriodicJob, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading periodic jobs: %w", err)
+	}
+
+	var configs []PeriodicJobConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parsing periodic jobs %s: %w", path, err)
+	}
+
+	jobs, err := parsePeriodicJobs(configs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing periodic jobs %s: %w", path, err)
+	}
+
+	periodicJobs := make([]*river.PeriodicJob, 0, len(jobs))
+	for _, job := range jobs {
+		periodicJobs = append(periodicJobs, river.NewPeriodicJob(
+			job.schedule,
+			func() (river.JobArgs, *river.InsertOpts) {
+				return job.args, nil
+			},
+			&river.PeriodicJobOpts{RunOnStart: job.runOnStart},
+		))
+	}
+
+	return periodicJobs, nil
+}
+
+// parsePeriodicJobs validates every config, reporting all problems at once.
+func parsePeriodicJobs(configs []PeriodicJobConfig) ([]periodicJob, error) {
+	var jobs []periodicJob
+	var errs []error
+	for i, c := range configs {
+		decode, ok := periodicKinds[c.Kind]
+		if !ok {
+			errs = append(errs, fmt.Errorf("job %d: unknown kind %q", i, c.Kind))
+			continue
+		}
+
+		schedule, err := cron.ParseStandard(c.Schedule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %d (%s): invalid schedule %q: %w", i, c.Kind, c.Schedule, err))
+			continue
+		}
+
+		args, err := decode(c.Args)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %d (%s): invalid args: %w", i, c.Kind, err))
+			continue
+		}
+
+		jobs = append(jobs, periodicJob{schedule: schedule, args: args, runOnStart: c.RunOnStart})
+	}
+
+	return jobs, errors.Join(errs...)
+}
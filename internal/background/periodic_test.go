@@ -0,0 +1,54 @@
+package background
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriodicJobs(t *testing.T) {
+	var configs []PeriodicJobConfig
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"kind": "report", "schedule": "0 9 * * MON", "args": {"channel_id": "C1", "destinations": ["C2"]}},
+		{"kind": "incident_resolution", "schedule": "@every 30m", "run_on_start": true}
+	]`), &configs))
+
+	jobs, err := parsePeriodicJobs(configs)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	// Wednesday 2024-01-03 12:00 UTC.
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC), jobs[0].schedule.Next(now))
+	require.Equal(t, ReportWorkerArgs{ChannelID: "C1", Destinations: []string{"C2"}}, jobs[0].args)
+	require.False(t, jobs[0].runOnStart)
+
+	require.Equal(t, now.Add(30*time.Minute), jobs[1].schedule.Next(now))
+	require.Equal(t, IncidentResolutionWorkerArgs{}, jobs[1].args)
+	require.True(t, jobs[1].runOnStart)
+
+	_, err = parsePeriodicJobs([]PeriodicJobConfig{
+		{Kind: "report", Schedule: "every monday"},
+		{Kind: "classifier", Schedule: "@daily"},
+		{Kind: "report", Schedule: "@daily", Args: json.RawMessage(`{"channel": "C1"}`)},
+	})
+	require.ErrorContains(t, err, `invalid schedule "every monday"`)
+	require.ErrorContains(t, err, `unknown kind "classifier"`)
+	require.ErrorContains(t, err, `unknown field "channel"`)
+}
+
+func TestLoadPeriodicJobs(t *testing.T) {
+	jobs, err := LoadPeriodicJobs("")
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+
+	path := filepath.Join(t.TempDir(), "periodic.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"kind": "incident_duration", "schedule": "@daily", "args": {"channel_id": "C1"}}]`), 0o600))
+	jobs, err = LoadPeriodicJobs(path)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+}
@@ -0,0 +1,585 @@
+package report_worker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// Report sections a channel can choose from.
+const (
+	SectionUsers       = "users"
+	SectionBots        = "bots"
+	SectionAlerts      = "alerts"
+	SectionTimeToAck   = "time_to_ack"
+	SectionOwners      = "owners"
+	SectionImpact      = "impact"
+	SectionStopped     = "stopped_firing"
+	SectionMTTR        = "mttr"
+	SectionVolume      = "volume"
+	SectionFrequent    = "frequent"
+	SectionLongRunning = "long_running"
+	SectionUntriaged   = "untriaged"
+	SectionSuggestions = "suggestions"
+)
+
+const (
+	// stoppedFiringBaseline is how far before the report's week to look for alerts that used to fire.
+	stoppedFiringBaseline = 28 * 24 * time.Hour
+	// frequentAlertThreshold is how many times in a week an alert fires before it is listed as frequent.
+	frequentAlertThreshold = 3
+	// longRunningThreshold is how long an incident lasts before it is listed as long-running.
+	longRunningThreshold = 4 * time.Hour
+)
+
+// DefaultSections are the sections of a channel's report unless it picks its own.
+var DefaultSections = []string{
+	SectionUsers,
+	SectionBots,
+	SectionAlerts,
+	SectionFrequent,
+	SectionLongRunning,
+	SectionUntriaged,
+	SectionMTTR,
+	SectionTimeToAck,
+	SectionOwners,
+	SectionImpact,
+	SectionStopped,
+	SectionVolume,
+	SectionSuggestions,
+}
+
+// ValidateSections returns an error if sections is empty or has unknown or repeated names.
+func ValidateSections(sections []string) error {
+	if len(sections) == 0 {
+		return errors.New("at least one report section is required")
+	}
+
+	for i, name := range sections {
+		if _, ok := sectionRenderers[name]; !ok {
+			return fmt.Errorf("unknown report section %q, expected one of %s", name, strings.Join(DefaultSections, ", "))
+		}
+		if slices.Contains(sections[:i], name) {
+			return fmt.Errorf("report section %q listed twice", name)
+		}
+	}
+
+	return nil
+}
+
+// reportData is the week of channel activity the report sections render.
+type reportData struct {
+	channelID  string
+	start, end time.Time
+	messages   []schema.MessagesV2
+
+	// TODO: Figure out how to handle bots and users in the same report
+	userMsgCounts     map[string]int
+	botMsgCounts      map[string]int
+	incidentCounts    map[string]int             // key: "service/alert"
+	incidentDurations map[string][]time.Duration // key: "service/alert"
+	ownerCounts       map[string]int             // incidents assigned to each owner
+}
+
+func newReportData(channelID string, start, end time.Time, messages []schema.MessagesV2) *reportData {
+	// Sections that pair incidents with their closes, and sampling, rely on time order.
+	slices.SortFunc(messages, func(a, b schema.MessagesV2) int { return strings.Compare(a.Ts, b.Ts) })
+
+	data := &reportData{
+		channelID:         channelID,
+		start:             start,
+		end:               end,
+		messages:          messages,
+		userMsgCounts:     make(map[string]int),
+		botMsgCounts:      make(map[string]int),
+		incidentCounts:    make(map[string]int),
+		incidentDurations: make(map[string][]time.Duration),
+		ownerCounts:       make(map[string]int),
+	}
+
+	for _, msg := range messages {
+		if msg.Attrs.Message.BotID != "" {
+			data.botMsgCounts[msg.Attrs.Message.BotUsername]++
+		} else {
+			data.userMsgCounts[msg.Attrs.Message.User]++
+		}
+
+		incidentKey := fmt.Sprintf("%s/%s", msg.Attrs.IncidentAction.Service, msg.Attrs.IncidentAction.Alert)
+
+		switch msg.Attrs.IncidentAction.Action {
+		case dto.ActionOpenIncident:
+			data.incidentCounts[incidentKey]++
+			if msg.Attrs.OwnerID != "" {
+				data.ownerCounts[msg.Attrs.OwnerID]++
+			}
+		case dto.ActionCloseIncident:
+			data.incidentDurations[incidentKey] = append(data.incidentDurations[incidentKey], msg.Attrs.IncidentAction.Duration.Duration)
+		}
+	}
+
+	return data
+}
+
+// sectionRenderer appends one section of the report, or nothing if the section has nothing to show.
+type sectionRenderer func(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error
+
+var sectionRenderers = map[string]sectionRenderer{
+	SectionUsers:       renderUsers,
+	SectionBots:        renderBots,
+	SectionAlerts:      renderAlerts,
+	SectionTimeToAck:   renderTimeToAck,
+	SectionOwners:      renderOwners,
+	SectionImpact:      renderImpact,
+	SectionStopped:     renderStoppedFiring,
+	SectionMTTR:        renderMTTR,
+	SectionVolume:      renderVolume,
+	SectionFrequent:    renderFrequent,
+	SectionLongRunning: renderLongRunning,
+	SectionUntriaged:   renderUntriaged,
+	SectionSuggestions: renderSuggestions,
+}
+
+func renderUsers(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	report.WriteString("*Top Active Users:*\n")
+	for user, count := range sortMapByValue(data.userMsgCounts, 5) {
+		report.WriteString(fmt.Sprintf("• <@%s>: %d messages\n", user, count))
+	}
+
+	return nil
+}
+
+func renderBots(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	report.WriteString("*Top Active Bots:*\n")
+	for bot, count := range sortMapByValue(data.botMsgCounts, 5) {
+		report.WriteString(fmt.Sprintf("• <@%s>: %d messages\n", bot, count))
+	}
+
+	return nil
+}
+
+func renderAlerts(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error {
+	report.WriteString("*Top Alerts:*\n")
+	report.WriteString("```\n")
+
+	table := tablewriter.NewWriter(report)
+	table.SetHeader([]string{"Service", "Alert", "Occurrences", "Average Duration"})
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+
+	var runbookLinks []string
+	for alert, count := range sortMapByValue(data.incidentCounts, 5) {
+		service, alertName, _ := strings.Cut(alert, "/")
+		avgDuration := calculateAverage(data.incidentDurations[alert])
+		table.Append([]string{
+			service,
+			alertName,
+			fmt.Sprintf("%d", count),
+			avgDuration.Round(time.Second).String(),
+		})
+
+		runbookURL, err := schema.New(w.bot.DB).GetAlertRunbookURL(ctx, schema.GetAlertRunbookURLParams{
+			Service: service,
+			Alert:   alertName,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("getting runbook url (%s): %w", alert, err)
+		}
+		if runbookURL != "" {
+			runbookLinks = append(runbookLinks, fmt.Sprintf("• %s: <%s|runbook>\n", alert, runbookURL))
+		}
+	}
+
+	table.Render()
+	report.WriteString("```\n")
+
+	if len(runbookLinks) > 0 {
+		report.WriteString("*Runbooks:*\n")
+		for _, link := range runbookLinks {
+			report.WriteString(link)
+		}
+	}
+
+	return nil
+}
+
+func renderTimeToAck(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error {
+	timeToAck, err := schema.New(w.bot.DB).GetTimeToAckByService(ctx, schema.GetTimeToAckByServiceParams{
+		ChannelID: data.channelID,
+		StartTs:   fmt.Sprintf("%d.000000", data.start.Unix()),
+		EndTs:     fmt.Sprintf("%d.000000", data.end.Unix()),
+	})
+	if err != nil {
+		return fmt.Errorf("getting time to acknowledge: %w", err)
+	}
+
+	if len(timeToAck) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Time to Acknowledge:*\n")
+	slices.SortFunc(timeToAck, func(a, b schema.GetTimeToAckByServiceRow) int { return strings.Compare(a.Service, b.Service) })
+	for _, row := range timeToAck {
+		avg := time.Duration(row.AvgSeconds * float64(time.Second)).Round(time.Second)
+		report.WriteString(fmt.Sprintf("• %s: %s average (%d acknowledged, %d never acknowledged)\n", row.Service, avg, row.Acked, row.Unacked))
+	}
+
+	return nil
+}
+
+func renderOwners(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	if len(data.ownerCounts) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Incident Owners:*\n")
+	for owner, count := range sortMapByValue(data.ownerCounts, 5) {
+		report.WriteString(fmt.Sprintf("• <@%s>: %d incidents\n", owner, count))
+	}
+
+	return nil
+}
+
+func renderImpact(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error {
+	impact, err := schema.New(w.bot.DB).GetImpactByService(ctx, schema.GetImpactByServiceParams{
+		ChannelID: data.channelID,
+		StartTs:   fmt.Sprintf("%d.000000", data.start.Unix()),
+		EndTs:     fmt.Sprintf("%d.000000", data.end.Unix()),
+	})
+	if err != nil {
+		return fmt.Errorf("getting incident impact: %w", err)
+	}
+
+	if len(impact) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Incident Impact:*\n")
+	for _, row := range impact {
+		downtime := time.Duration(row.DowntimeMinutes) * time.Minute
+		report.WriteString(fmt.Sprintf("• %s: %s downtime, %d users affected (%d incidents)\n", row.Service, downtime, row.AffectedUsers, row.Incidents))
+	}
+
+	return nil
+}
+
+// renderStoppedFiring lists alerts that fired in the weeks before the report but not during it.
+// They may point at a fixed problem, or at a broken alert pipeline.
+func renderStoppedFiring(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error {
+	alerts, err := schema.New(w.bot.DB).GetDisappearedAlerts(ctx, schema.GetDisappearedAlertsParams{
+		ChannelID:       data.channelID,
+		BaselineStartTs: fmt.Sprintf("%d.000000", data.start.Add(-stoppedFiringBaseline).Unix()),
+		EndTs:           fmt.Sprintf("%d.000000", data.end.Unix()),
+		RecentStartTs:   fmt.Sprintf("%d.000000", data.start.Unix()),
+	})
+	if err != nil {
+		return fmt.Errorf("getting alerts that stopped firing: %w", err)
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Alerts That Stopped Firing:*\n")
+	for _, alert := range alerts[:min(len(alerts), 5)] {
+		lastSeen := alert.LastSeenTs
+		if t, err := internal.TsToTime(alert.LastSeenTs); err == nil {
+			lastSeen = t.Format("2006-01-02")
+		}
+		report.WriteString(fmt.Sprintf("• %s/%s: %d times before, last on %s\n", alert.Service, alert.Alert, alert.BaselineCount, lastSeen))
+	}
+
+	return nil
+}
+
+// renderMTTR lists the mean time to resolve the incidents closed during the week, per service.
+// Closes without a recorded duration are left out.
+func renderMTTR(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	durations := make(map[string][]time.Duration)
+	for alert, alertDurations := range data.incidentDurations {
+		service, _, _ := strings.Cut(alert, "/")
+		for _, duration := range alertDurations {
+			if duration > 0 {
+				durations[service] = append(durations[service], duration)
+			}
+		}
+	}
+	if len(durations) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Mean Time to Resolve:*\n")
+	for _, service := range slices.Sorted(maps.Keys(durations)) {
+		avg := calculateAverage(durations[service]).Round(time.Second)
+		report.WriteString(fmt.Sprintf("• %s: %s (%d resolved)\n", service, avg, len(durations[service])))
+	}
+
+	return nil
+}
+
+// renderVolume lists how many messages were posted on each day of the week, and how many by bots.
+func renderVolume(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	total := make(map[string]int)
+	bots := make(map[string]int)
+	for _, msg := range data.messages {
+		t, err := internal.TsToTime(msg.Ts)
+		if err != nil {
+			continue
+		}
+
+		day := t.UTC().Format("2006-01-02")
+		total[day]++
+		if msg.Attrs.Message.BotID != "" {
+			bots[day]++
+		}
+	}
+	if len(total) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Message Volume:*\n")
+	for _, day := range slices.Sorted(maps.Keys(total)) {
+		report.WriteString(fmt.Sprintf("• %s: %d messages (%d from bots)\n", day, total[day], bots[day]))
+	}
+
+	return nil
+}
+
+// renderFrequent lists alerts that fired at least frequentAlertThreshold times during the week.
+// They are candidates for tuning or for a permanent fix.
+func renderFrequent(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	var lines []string
+	for alert, count := range sortMapByValue(data.incidentCounts, len(data.incidentCounts)) {
+		if count < frequentAlertThreshold {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("• %s: %d times\n", alert, count))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	report.WriteString("*Frequently Firing Alerts:*\n")
+	for _, line := range lines[:min(len(lines), 5)] {
+		report.WriteString(line)
+	}
+
+	return nil
+}
+
+// weekIncident is an incident opened during the report's week, with how long it lasted.
+type weekIncident struct {
+	msg      schema.MessagesV2
+	duration time.Duration
+	resolved bool
+}
+
+// weekIncidents pairs each incident opened during the week with the first later close of the
+// same service and alert. Incidents still open at the end of the week last until then.
+func weekIncidents(data *reportData) []weekIncident {
+	var incidents []weekIncident
+	for i, msg := range data.messages {
+		action := msg.Attrs.IncidentAction
+		if action.Action != dto.ActionOpenIncident {
+			continue
+		}
+
+		incident := weekIncident{msg: msg}
+		if opened, err := internal.TsToTime(msg.Ts); err == nil {
+			incident.duration = data.end.Sub(opened)
+		}
+		for _, later := range data.messages[i+1:] {
+			closed := later.Attrs.IncidentAction
+			if closed.Action == dto.ActionCloseIncident && closed.Service == action.Service && closed.Alert == action.Alert {
+				incident.duration = closed.Duration.Duration
+				incident.resolved = true
+				break
+			}
+		}
+
+		incidents = append(incidents, incident)
+	}
+
+	return incidents
+}
+
+// renderLongRunning lists the week's incidents that lasted, or have been open for, at least
+// longRunningThreshold, longest first.
+func renderLongRunning(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	var long []weekIncident
+	for _, incident := range weekIncidents(data) {
+		if incident.duration >= longRunningThreshold {
+			long = append(long, incident)
+		}
+	}
+	if len(long) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(long, func(a, b weekIncident) int { return cmp.Compare(b.duration, a.duration) })
+
+	report.WriteString("*Long-Running Incidents:*\n")
+	for _, incident := range long[:min(len(long), 5)] {
+		status := "resolved after"
+		if !incident.resolved {
+			status = "still open after"
+		}
+		action := incident.msg.Attrs.IncidentAction
+		report.WriteString(fmt.Sprintf("• %s/%s: %s %s\n", action.Service, action.Alert, status, incident.duration.Round(time.Minute)))
+	}
+
+	return nil
+}
+
+// renderUntriaged lists the week's incidents that are still open with nobody having replied in
+// their thread or taken ownership.
+func renderUntriaged(_ context.Context, _ *reportWorker, data *reportData, report *strings.Builder) error {
+	var untriaged []schema.MessagesV2
+	for _, incident := range weekIncidents(data) {
+		if !incident.resolved && incident.msg.Attrs.AcknowledgedTs == "" && incident.msg.Attrs.OwnerID == "" {
+			untriaged = append(untriaged, incident.msg)
+		}
+	}
+	if len(untriaged) == 0 {
+		return nil
+	}
+
+	report.WriteString(fmt.Sprintf("*Untriaged Incidents (%d):*\n", len(untriaged)))
+	for _, msg := range untriaged[:min(len(untriaged), 5)] {
+		opened := msg.Ts
+		if t, err := internal.TsToTime(msg.Ts); err == nil {
+			opened = t.UTC().Format("2006-01-02 15:04")
+		}
+		action := msg.Attrs.IncidentAction
+		report.WriteString(fmt.Sprintf("• %s/%s, opened %s\n", action.Service, action.Alert, opened))
+	}
+
+	return nil
+}
+
+// sampleMessages returns at most limit of messages, in order. Incident messages are kept first
+// and the rest are sampled evenly across the week. A limit of 0 keeps every message.
+func sampleMessages(messages []schema.MessagesV2, limit int) []schema.MessagesV2 {
+	if limit <= 0 || len(messages) <= limit {
+		return messages
+	}
+
+	keep := make([]bool, len(messages))
+	var others []int
+	kept := 0
+	for i, msg := range messages {
+		if msg.Attrs.IncidentAction.Action != "" && kept < limit {
+			keep[i] = true
+			kept++
+		} else {
+			others = append(others, i)
+		}
+	}
+
+	if room := limit - kept; room > 0 {
+		step := float64(len(others)) / float64(room)
+		for j := range room {
+			keep[others[int(float64(j)*step)]] = true
+		}
+	}
+
+	sampled := make([]schema.MessagesV2, 0, limit)
+	for i, msg := range messages {
+		if keep[i] {
+			sampled = append(sampled, msg)
+		}
+	}
+
+	return sampled
+}
+
+// suggestionThreads returns the threads suggestions are generated from, as the texts of human
+// messages and human thread replies. Incident threads are kept even though bots open them, since
+// the replies under them are what the suggestions are about. With a limit, at most half of it goes
+// to top-level messages and the rest is shared evenly among their threads, so limit bounds the
+// total number of messages. threadLimit additionally caps each thread when set.
+func suggestionThreads(ctx context.Context, q *schema.Queries, messages []schema.MessagesV2, limit, threadLimit int) ([][]string, error) {
+	var candidates []schema.MessagesV2
+	for _, msg := range messages {
+		if msg.Attrs.Message.BotID == "" || msg.Attrs.IncidentAction.Action == dto.ActionOpenIncident {
+			candidates = append(candidates, msg)
+		}
+	}
+
+	parents := candidates
+	perThread := threadLimit
+	if limit > 0 {
+		parents = sampleMessages(candidates, (limit+1)/2)
+		if len(parents) == 0 {
+			return nil, nil
+		}
+
+		perThread = (limit - len(parents)) / len(parents)
+		if threadLimit > 0 {
+			perThread = min(perThread, threadLimit)
+		}
+	}
+	if len(parents) < len(candidates) {
+		slog.InfoContext(ctx, "sampled messages for suggestions", "channel_id", parents[0].ChannelID, "messages", len(candidates), "sampled", len(parents), "replies_per_thread", perThread)
+	}
+
+	threads := make([][]string, 0, len(parents))
+	for _, msg := range parents {
+		thread := []string{msg.Attrs.Message.Text}
+		if limit > 0 && perThread == 0 {
+			threads = append(threads, thread)
+			continue
+		}
+
+		replies, err := q.GetThreadMessages(ctx, schema.GetThreadMessagesParams{
+			ChannelID:   msg.ChannelID,
+			ParentTs:    msg.Ts,
+			MaxMessages: int32(perThread),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("getting thread messages: %w", err)
+		}
+		for _, reply := range replies {
+			if reply.Attrs.Message.BotID == "" {
+				thread = append(thread, reply.Attrs.Message.Text)
+			}
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return threads, nil
+}
+
+func renderSuggestions(ctx context.Context, w *reportWorker, data *reportData, report *strings.Builder) error {
+	textMessages, err := suggestionThreads(ctx, schema.New(w.bot.DB), data.messages, w.messagesLimit, w.threadMessagesLimit)
+	if err != nil {
+		return err
+	}
+
+	// The rest of the report doesn't need the LLM, so post it even if suggestions fail.
+	suggestions, err := w.llmClient.GenerateChannelSuggestions(ctx, textMessages)
+	if err != nil {
+		slog.WarnContext(ctx, "generating suggestions failed, posting report without them", "channel_id", data.channelID, "error", err)
+		report.WriteString("*Suggestions for Improvement:*\n_Suggestions are unavailable right now._\n")
+		return nil
+	}
+
+	if suggestions != "" {
+		report.WriteString(fmt.Sprintf("*Suggestions for Improvement:*\n%s\n", suggestions))
+	}
+
+	return nil
+}
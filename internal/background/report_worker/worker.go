@@ -2,152 +2,381 @@ package report_worker
 
 import (
 	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"iter"
+	"log/slog"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/background"
 	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/slack_integration"
 	"github.com/dynoinc/ratchet/internal/storage/schema"
 	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
-	"github.com/olekukonko/tablewriter"
 	"github.com/riverqueue/river"
 	"github.com/slack-go/slack"
 )
 
+// Formats the report can additionally be uploaded in, as a file in the report's thread.
+const (
+	AttachmentNone     = ""
+	AttachmentMarkdown = "markdown"
+	AttachmentCSV      = "csv"
+)
+
+// ValidateAttachmentFormat returns an error if format is not one of the Attachment formats.
+func ValidateAttachmentFormat(format string) error {
+	if !slices.Contains([]string{AttachmentNone, AttachmentMarkdown, AttachmentCSV}, format) {
+		return fmt.Errorf("unknown report attachment format %q, expected %q or %q", format, AttachmentMarkdown, AttachmentCSV)
+	}
+
+	return nil
+}
+
 type reportWorker struct {
 	river.WorkerDefaults[background.ReportWorkerArgs]
 
-	bot          *internal.Bot
-	slackClient  *slack.Client
-	llmClient    *llm.Client
-	devChannelID string
+	bot                 *internal.Bot
+	slackClient         *slack.Client
+	llmClient           *llm.Client
+	devChannelID        string
+	maxMessageLength    int
+	messagesLimit       int
+	threadMessagesLimit int
+	attachmentFormat    string
+	dedupWindow         time.Duration
+	// Post reports as Block Kit blocks instead of plain text.
+	blocks bool
 }
 
-func New(bot *internal.Bot, slackClient *slack.Client, llmClient *llm.Client, devChannelID string) *reportWorker {
-	return &reportWorker{
-		bot:          bot,
-		slackClient:  slackClient,
-		llmClient:    llmClient,
-		devChannelID: devChannelID,
+func New(bot *internal.Bot, slackClient *slack.Client, llmClient *llm.Client, devChannelID string, maxMessageLength, messagesLimit, threadMessagesLimit int, attachmentFormat string, dedupWindow time.Duration, blocks bool) (*reportWorker, error) {
+	if err := ValidateAttachmentFormat(attachmentFormat); err != nil {
+		return nil, err
 	}
+
+	return &reportWorker{
+		bot:                 bot,
+		slackClient:         slackClient,
+		llmClient:           llmClient,
+		devChannelID:        devChannelID,
+		maxMessageLength:    maxMessageLength,
+		messagesLimit:       messagesLimit,
+		threadMessagesLimit: threadMessagesLimit,
+		attachmentFormat:    attachmentFormat,
+		dedupWindow:         dedupWindow,
+		blocks:              blocks,
+	}, nil
 }
 
 func (w *reportWorker) Work(ctx context.Context, job *river.Job[background.ReportWorkerArgs]) error {
-	messages, err := schema.New(w.bot.DB).GetMessagesWithinTS(ctx, schema.GetMessagesWithinTSParams{
-		ChannelID: job.Args.ChannelID,
-		StartTs:   fmt.Sprintf("%d.000000", time.Now().AddDate(0, 0, -7).Unix()),
-		EndTs:     fmt.Sprintf("%d.000000", time.Now().Unix()),
-	})
+	allowed, err := w.bot.IsChannelAllowed(ctx, job.Args.ChannelID)
 	if err != nil {
-		return fmt.Errorf("getting messages for channel: %w", err)
+		return fmt.Errorf("checking channel allowlist: %w", err)
+	}
+	if !allowed {
+		slog.InfoContext(ctx, "skipping report for channel not in allowlist", "channel_id", job.Args.ChannelID)
+		return nil
 	}
 
-	// TODO: Figure out how to handle bots and users in the same report
-	userMsgCounts := make(map[string]int)
-	botMsgCounts := make(map[string]int)
-	incidentCounts := make(map[string]int)                // key: "service/alert"
-	incidentDurations := make(map[string][]time.Duration) // key: "service/alert"
+	previous, claimed, err := w.claim(ctx, job)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		slog.InfoContext(ctx, "skipping report already posted recently", "channel_id", job.Args.ChannelID, "window", w.dedupWindow)
+		return nil
+	}
 
-	for _, msg := range messages {
-		if msg.Attrs.Message.BotID != "" {
-			botMsgCounts[msg.Attrs.Message.BotUsername]++
-		} else {
-			userMsgCounts[msg.Attrs.Message.User]++
+	// A retry skips the destinations an earlier attempt already posted to.
+	var delivered []string
+	if previous.ReportJobID == job.ID {
+		delivered = previous.ReportDeliveredTo
+	}
+
+	err = w.buildAndPublish(ctx, job, &delivered)
+	if err != nil && len(delivered) == 0 {
+		// Nothing was posted, so let the next job for the channel post the report.
+		if releaseErr := schema.New(w.bot.DB).SetReportClaim(ctx, schema.SetReportClaimParams{
+			ReportPostedTs:    previous.ReportPostedTs,
+			ReportJobID:       previous.ReportJobID,
+			ReportDeliveredTo: previous.ReportDeliveredTo,
+			ID:                job.Args.ChannelID,
+		}); releaseErr != nil {
+			return errors.Join(err, fmt.Errorf("releasing report claim for channel %s: %w", job.Args.ChannelID, releaseErr))
 		}
+	}
 
-		incidentKey := fmt.Sprintf("%s/%s", msg.Attrs.IncidentAction.Service, msg.Attrs.IncidentAction.Alert)
+	return err
+}
+
+// claim records in a transaction that job is posting the channel's report now, unless another
+// job posted it less than dedupWindow ago, so a job that fires twice doesn't post the same report
+// twice. A retry of a job that already posted to some destinations keeps its claim. It returns
+// the channel's attrs from before the claim.
+func (w *reportWorker) claim(ctx context.Context, job *river.Job[background.ReportWorkerArgs]) (dto.ChannelAttrs, bool, error) {
+	tx, err := w.bot.DB.Begin(ctx)
+	if err != nil {
+		return dto.ChannelAttrs{}, false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	qtx := schema.New(tx)
+	channel, err := qtx.GetChannelForUpdate(ctx, job.Args.ChannelID)
+	if err != nil {
+		return dto.ChannelAttrs{}, false, fmt.Errorf("getting channel %s: %w", job.Args.ChannelID, err)
+	}
 
-		switch msg.Attrs.IncidentAction.Action {
-		case dto.ActionOpenIncident:
-			incidentCounts[incidentKey]++
-		case dto.ActionCloseIncident:
-			incidentDurations[incidentKey] = append(incidentDurations[incidentKey], msg.Attrs.IncidentAction.Duration.Duration)
+	claim := schema.SetReportClaimParams{
+		ReportPostedTs: internal.TimeToTs(time.Now()),
+		ReportJobID:    job.ID,
+		ID:             job.Args.ChannelID,
+	}
+	if channel.Attrs.ReportJobID == job.ID {
+		claim.ReportDeliveredTo = channel.Attrs.ReportDeliveredTo
+	} else {
+		posted, err := w.postedWithinWindow(channel.Attrs.ReportPostedTs)
+		if err != nil {
+			return dto.ChannelAttrs{}, false, err
+		}
+		if posted {
+			return channel.Attrs, false, nil
 		}
 	}
 
-	// Build report sections
-	var report strings.Builder
-	report.WriteString(fmt.Sprintf("*Weekly Channel Report (Channel: <#%s>, Period: %s-%s)*\n\n", job.Args.ChannelID, time.Now().AddDate(0, 0, -7).Format("2006-01-02"), time.Now().Format("2006-01-08")))
+	if err := qtx.SetReportClaim(ctx, claim); err != nil {
+		return dto.ChannelAttrs{}, false, fmt.Errorf("claiming report for channel %s: %w", job.Args.ChannelID, err)
+	}
+
+	return channel.Attrs, true, tx.Commit(ctx)
+}
+
+// postedWithinWindow reports whether a report posted at postedTs was posted less than
+// dedupWindow ago.
+func (w *reportWorker) postedWithinWindow(postedTs string) (bool, error) {
+	if w.dedupWindow <= 0 || postedTs == "" {
+		return false, nil
+	}
+
+	postedAt, err := internal.TsToTime(postedTs)
+	if err != nil {
+		return false, fmt.Errorf("parsing report posted ts: %w", err)
+	}
+
+	return time.Since(postedAt) < w.dedupWindow, nil
+}
+
+// buildAndPublish builds the report for job and posts it to every destination not in delivered,
+// recording each one in delivered, and in the channel's attrs, as it is posted.
+func (w *reportWorker) buildAndPublish(ctx context.Context, job *river.Job[background.ReportWorkerArgs], delivered *[]string) error {
+	report, alertRows, err := w.build(ctx, job.Args.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	destinations, err := w.destinations(ctx, job.Args)
+	if err != nil {
+		return err
+	}
+	destinations = slices.DeleteFunc(destinations, func(channelID string) bool { return slices.Contains(*delivered, channelID) })
+
+	// Send report to Slack
+	return w.publish(ctx, destinations, report, alertRows, func(channelID string) error {
+		*delivered = append(*delivered, channelID)
+		if err := schema.New(w.bot.DB).UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
+			ID:    job.Args.ChannelID,
+			Attrs: dto.ChannelAttrs{ReportDeliveredTo: *delivered},
+		}); err != nil {
+			return fmt.Errorf("recording report delivery to channel %s: %w", channelID, err)
+		}
+		return nil
+	})
+}
 
-	// Top users section
-	report.WriteString("*Top Active Users:*\n")
-	for user, count := range sortMapByValue(userMsgCounts, 5) {
-		report.WriteString(fmt.Sprintf("• <@%s>: %d messages\n", user, count))
+// Preview builds the report for channelID and returns it as the Slack blocks it would be
+// posted as, without posting anything.
+func (w *reportWorker) Preview(ctx context.Context, channelID string) ([]slack.Block, error) {
+	report, _, err := w.build(ctx, channelID)
+	if err != nil {
+		return nil, err
 	}
-	report.WriteString("\n")
 
-	// Top bots section
-	report.WriteString("*Top Active Bots:*\n")
-	for bot, count := range sortMapByValue(botMsgCounts, 5) {
-		report.WriteString(fmt.Sprintf("• <@%s>: %d messages\n", bot, count))
+	return slack_integration.MarkdownBlocks(report), nil
+}
+
+// build aggregates the last week of messages in channelID into the report text, with the
+// channel's configured sections. It also returns every alert's row for the CSV attachment.
+func (w *reportWorker) build(ctx context.Context, channelID string) (string, [][]string, error) {
+	channel, err := schema.New(w.bot.DB).GetChannel(ctx, channelID)
+	if err != nil {
+		return "", nil, fmt.Errorf("getting channel %s: %w", channelID, err)
 	}
-	report.WriteString("\n")
 
-	// Top alerts section
-	report.WriteString("*Top Alerts:*\n")
-	report.WriteString("```\n")
+	end := time.Now()
+	start := end.AddDate(0, 0, -7)
+	messages, err := schema.New(w.bot.DB).GetMessagesWithinTS(ctx, schema.GetMessagesWithinTSParams{
+		ChannelID: channelID,
+		StartTs:   fmt.Sprintf("%d.000000", start.Unix()),
+		EndTs:     fmt.Sprintf("%d.000000", end.Unix()),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("getting messages for channel: %w", err)
+	}
+
+	sections := channel.Attrs.ReportSections
+	if len(sections) == 0 {
+		sections = DefaultSections
+	}
 
-	// Create table using go-pretty
-	table := tablewriter.NewWriter(&report)
-	table.SetHeader([]string{"Service", "Alert", "Occurrences", "Average Duration"})
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
+	data := newReportData(channelID, start, end, messages)
+	report, err := w.render(ctx, data, sections)
+	if err != nil {
+		return "", nil, err
+	}
 
-	for alert, count := range sortMapByValue(incidentCounts, 5) {
+	var alertRows [][]string
+	for alert, count := range sortMapByValue(data.incidentCounts, len(data.incidentCounts)) {
 		service, alertName, _ := strings.Cut(alert, "/")
-		avgDuration := calculateAverage(incidentDurations[alert])
-		table.Append([]string{
+		alertRows = append(alertRows, []string{
 			service,
 			alertName,
-			fmt.Sprintf("%d", count),
-			avgDuration.Round(time.Second).String(),
+			strconv.Itoa(count),
+			calculateAverage(data.incidentDurations[alert]).Round(time.Second).String(),
 		})
 	}
 
-	table.Render()
-	report.WriteString("```\n")
+	return report, alertRows, nil
+}
+
+// render writes the report header followed by each of sections, in order.
+func (w *reportWorker) render(ctx context.Context, data *reportData, sections []string) (string, error) {
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("*Weekly Channel Report (Channel: <#%s>, Period: %s-%s)*\n", data.channelID, data.start.Format("2006-01-02"), data.end.Format("2006-01-08")))
 
-	textMessages := make([][]string, 0, len(messages))
-	for _, msg := range messages {
-		if msg.Attrs.Message.BotID != "" {
-			continue
+	for _, name := range sections {
+		section, ok := sectionRenderers[name]
+		if !ok {
+			return "", fmt.Errorf("unknown report section %q", name)
 		}
 
-		threadMessages, err := schema.New(w.bot.DB).GetThreadMessages(ctx, schema.GetThreadMessagesParams{
-			ChannelID: msg.ChannelID,
-			ParentTs:  msg.Ts,
-		})
-		if err != nil {
-			return fmt.Errorf("getting thread messages: %w", err)
+		var body strings.Builder
+		if err := section(ctx, w, data, &body); err != nil {
+			return "", fmt.Errorf("rendering %s section: %w", name, err)
+		}
+		if body.Len() > 0 {
+			report.WriteString("\n" + body.String())
 		}
-		fullThreadMessages := []string{msg.Attrs.Message.Text}
-		for _, threadMessage := range threadMessages {
-			fullThreadMessages = append(fullThreadMessages, threadMessage.Attrs.Message.Text)
+	}
+
+	return report.String(), nil
+}
+
+// destinations returns the channels to post the report for args to: the channel it covers and
+// any additional destinations the bot may post in.
+func (w *reportWorker) destinations(ctx context.Context, args background.ReportWorkerArgs) ([]string, error) {
+	var destinations []string
+	for _, channelID := range reportDestinations(args, w.devChannelID) {
+		if channelID != args.ChannelID && channelID != w.devChannelID {
+			allowed, err := w.bot.IsChannelAllowed(ctx, channelID)
+			if err != nil {
+				return nil, fmt.Errorf("checking channel allowlist: %w", err)
+			}
+			if !allowed {
+				slog.InfoContext(ctx, "skipping report destination not in allowlist", "channel_id", channelID)
+				continue
+			}
 		}
 
-		textMessages = append(textMessages, fullThreadMessages)
+		destinations = append(destinations, channelID)
 	}
-	suggestions, err := w.llmClient.GenerateChannelSuggestions(ctx, textMessages)
-	if err != nil {
-		return fmt.Errorf("generating suggestions: %w", err)
+
+	return destinations, nil
+}
+
+// publish posts the report to each of destinations, calling delivered as soon as its message is
+// posted. Failures after that, of a continuation or of the attachment, are only logged: failing
+// the job would post the report to the destination again.
+func (w *reportWorker) publish(ctx context.Context, destinations []string, report string, alertRows [][]string, delivered func(channelID string) error) error {
+	for _, channelID := range destinations {
+		ts, postErr := w.post(ctx, channelID, report)
+		if ts == "" {
+			return fmt.Errorf("posting report to channel %s: %w", channelID, postErr)
+		}
+		if err := delivered(channelID); err != nil {
+			return err
+		}
+		if postErr != nil {
+			slog.WarnContext(ctx, "report posted incompletely", "channel_id", channelID, "error", postErr)
+		}
+
+		if err := w.attach(ctx, channelID, ts, report, alertRows); err != nil {
+			slog.WarnContext(ctx, "uploading report attachment failed", "channel_id", channelID, "error", err)
+		}
 	}
-	if len(suggestions) > 0 {
-		report.WriteString(fmt.Sprintf("\n*Suggestions for Improvement:*\n%s\n", suggestions))
+
+	return nil
+}
+
+// reportDestinations returns the channels to post a report to. In dev mode everything goes to
+// the dev channel, once.
+func reportDestinations(args background.ReportWorkerArgs, devChannelID string) []string {
+	if devChannelID != "" {
+		return []string{devChannelID}
 	}
 
-	// Send report to Slack
-	channelID := job.Args.ChannelID
-	if w.devChannelID != "" {
-		channelID = w.devChannelID
+	destinations := []string{args.ChannelID}
+	for _, channelID := range args.Destinations {
+		if !slices.Contains(destinations, channelID) {
+			destinations = append(destinations, channelID)
+		}
 	}
 
-	_, _, err = w.slackClient.PostMessage(channelID, slack.MsgOptionText(report.String(), false))
+	return destinations
+}
+
+// post posts the report message and returns its ts, which is set even with an error if only
+// a continuation in its thread failed.
+func (w *reportWorker) post(ctx context.Context, channelID, report string) (string, error) {
+	var ts string
+	var err error
+	if w.blocks {
+		ts, err = slack_integration.PostBlocks(ctx, w.slackClient, channelID, "", report, false)
+	} else {
+		ts, err = slack_integration.PostMessage(ctx, w.slackClient, channelID, "", report, w.maxMessageLength, false)
+	}
 	if err != nil {
-		return fmt.Errorf("posting report message: %w", err)
+		return ts, fmt.Errorf("posting report message: %w", err)
+	}
+
+	return ts, nil
+}
+
+// attach uploads the report, if configured, as a file in the thread of the report posted at ts.
+func (w *reportWorker) attach(ctx context.Context, channelID, ts, report string, alertRows [][]string) error {
+	date := time.Now().Format("2006-01-02")
+	var filename, content string
+	switch w.attachmentFormat {
+	case AttachmentNone:
+		return nil
+	case AttachmentMarkdown:
+		filename, content = fmt.Sprintf("report-%s.md", date), report
+	case AttachmentCSV:
+		var buf strings.Builder
+		cw := csv.NewWriter(&buf)
+		_ = cw.Write([]string{"service", "alert", "occurrences", "average_duration"})
+		_ = cw.WriteAll(alertRows)
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("writing report csv: %w", err)
+		}
+		filename, content = fmt.Sprintf("alerts-%s.csv", date), buf.String()
+	}
+
+	if err := slack_integration.UploadFile(ctx, w.slackClient, channelID, ts, filename, content); err != nil {
+		return fmt.Errorf("uploading report attachment: %w", err)
 	}
 
 	return nil
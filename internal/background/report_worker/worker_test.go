@@ -0,0 +1,467 @@
+package report_worker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestAttachUploadsCSV(t *testing.T) {
+	var filename, content, threadTS string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	})
+	mux.HandleFunc("/files.getUploadURLExternal", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"ok":true,"upload_url":%q,"file_id":"F1"}`, srv.URL+"/upload")
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		body, err := io.ReadAll(file)
+		require.NoError(t, err)
+		filename, content = header.Filename, string(body)
+	})
+	mux.HandleFunc("/files.completeUploadExternal", func(w http.ResponseWriter, r *http.Request) {
+		threadTS = r.FormValue("thread_ts")
+		_, _ = w.Write([]byte(`{"ok":true,"files":[{"id":"F1"}]}`))
+	})
+
+	w := &reportWorker{
+		slackClient:      slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		maxMessageLength: 3000,
+		attachmentFormat: AttachmentCSV,
+	}
+	err := w.attach(t.Context(), "C1", "1700000000.000100", "*Weekly Channel Report*", [][]string{
+		{"payments", "HighLatency", "3", "5m0s"},
+		{"search", "IndexLag", "1", "0s"},
+	})
+	require.NoError(t, err)
+
+	require.Regexp(t, `^alerts-\d{4}-\d{2}-\d{2}\.csv$`, filename)
+	require.Equal(t, "service,alert,occurrences,average_duration\npayments,HighLatency,3,5m0s\nsearch,IndexLag,1,0s\n", content)
+	require.Equal(t, "1700000000.000100", threadTS)
+}
+
+func TestRenderCustomSections(t *testing.T) {
+	data := newReportData("C1", time.Now().AddDate(0, 0, -7), time.Now(), []schema.MessagesV2{
+		{Attrs: dto.MessageAttrs{Message: dto.SlackMessage{User: "U1"}}},
+		{Attrs: dto.MessageAttrs{Message: dto.SlackMessage{User: "U1"}}},
+		{Attrs: dto.MessageAttrs{Message: dto.SlackMessage{BotID: "B1", BotUsername: "alertmanager"}}},
+	})
+
+	report, err := (&reportWorker{}).render(t.Context(), data, []string{SectionBots, SectionUsers})
+	require.NoError(t, err)
+	require.Contains(t, report, "*Top Active Bots:*\n• <@alertmanager>: 1 messages\n\n*Top Active Users:*\n• <@U1>: 2 messages\n")
+	require.NotContains(t, report, "Top Alerts")
+	require.NotContains(t, report, "Suggestions")
+
+	require.NoError(t, ValidateSections(DefaultSections))
+	require.Error(t, ValidateSections([]string{SectionUsers, "latency"}))
+	require.Error(t, ValidateSections([]string{SectionUsers, SectionUsers}))
+}
+
+func TestRenderIncidentSections(t *testing.T) {
+	end := time.Date(2026, 10, 8, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -7)
+	at := func(d time.Duration) string { return internal.TimeToTs(start.Add(d)) }
+	open := func(ts, service, owner string) schema.MessagesV2 {
+		return schema.MessagesV2{Ts: ts, Attrs: dto.MessageAttrs{
+			Message:        dto.SlackMessage{BotID: "B1"},
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: service, Alert: "HighLatency"},
+			OwnerID:        owner,
+		}}
+	}
+	closed := func(ts, service string, d time.Duration) schema.MessagesV2 {
+		msg := schema.MessagesV2{Ts: ts, Attrs: dto.MessageAttrs{
+			Message:        dto.SlackMessage{BotID: "B1"},
+			IncidentAction: dto.IncidentAction{Action: dto.ActionCloseIncident, Service: service, Alert: "HighLatency"},
+		}}
+		msg.Attrs.IncidentAction.Duration.Duration = d
+		return msg
+	}
+
+	// Given out of order, as the messages query returns them.
+	data := newReportData("C1", start, end, []schema.MessagesV2{
+		closed(at(6*time.Hour), "payments", 5*time.Hour),
+		open(at(time.Hour), "payments", "U1"),
+		open(at(24*time.Hour), "payments", "U1"),
+		closed(at(24*time.Hour+10*time.Minute), "payments", 10*time.Minute),
+		open(at(48*time.Hour), "payments", "U1"),
+		open(at(6*24*time.Hour), "search", ""),
+		{Ts: at(6 * 24 * time.Hour), Attrs: dto.MessageAttrs{Message: dto.SlackMessage{User: "U1"}}},
+	})
+
+	report, err := (&reportWorker{}).render(t.Context(), data, []string{SectionFrequent, SectionLongRunning, SectionUntriaged, SectionMTTR, SectionVolume})
+	require.NoError(t, err)
+	require.Contains(t, report, "*Frequently Firing Alerts:*\n• payments/HighLatency: 3 times\n")
+	require.Contains(t, report, "*Long-Running Incidents:*\n• payments/HighLatency: still open after 120h0m0s\n• search/HighLatency: still open after 24h0m0s\n• payments/HighLatency: resolved after 5h0m0s\n")
+	require.NotContains(t, report, "after 10m0s")
+	require.Contains(t, report, "*Untriaged Incidents (1):*\n• search/HighLatency, opened 2026-10-07 00:00\n")
+	require.Contains(t, report, "*Mean Time to Resolve:*\n• payments: 2h35m0s (2 resolved)\n")
+	require.Contains(t, report, "*Message Volume:*\n• 2026-10-01: 2 messages (2 from bots)\n• 2026-10-02: 2 messages (2 from bots)\n• 2026-10-03: 1 messages (1 from bots)\n• 2026-10-07: 2 messages (1 from bots)\n")
+}
+
+func TestSampleMessages(t *testing.T) {
+	var messages []schema.MessagesV2
+	for i := range 100 {
+		msg := schema.MessagesV2{Ts: fmt.Sprintf("%d.000000", 1000+i)}
+		if i%25 == 0 {
+			msg.Attrs.IncidentAction = dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"}
+		}
+		messages = append(messages, msg)
+	}
+
+	require.Len(t, sampleMessages(messages, 0), 100)
+
+	sampled := sampleMessages(messages, 10)
+	require.Len(t, sampled, 10)
+	var incidents int
+	for i, msg := range sampled {
+		if msg.Attrs.IncidentAction.Action != "" {
+			incidents++
+		}
+		if i > 0 {
+			require.Less(t, sampled[i-1].Ts, msg.Ts)
+		}
+	}
+	require.Equal(t, 4, incidents)
+	require.Greater(t, sampled[len(sampled)-1].Ts, "1075.000000")
+
+	require.Len(t, sampleMessages(messages, 2), 2)
+}
+
+func TestSuggestionThreadsRespectLimit(t *testing.T) {
+	db := setupChannel(t)
+	q := schema.New(db)
+
+	addMessage := func(ts string, attrs dto.MessageAttrs) schema.MessagesV2 {
+		_, err := q.AddMessage(t.Context(), schema.AddMessageParams{ChannelID: "C1", Ts: ts, Attrs: attrs})
+		require.NoError(t, err)
+		return schema.MessagesV2{ChannelID: "C1", Ts: ts, Attrs: attrs}
+	}
+	addReplies := func(parentTs string, n int, botID string) {
+		for i := range n {
+			require.NoError(t, q.AddThreadMessage(t.Context(), schema.AddThreadMessageParams{
+				ChannelID: "C1",
+				ParentTs:  parentTs,
+				Ts:        fmt.Sprintf("%s%02d", parentTs[:len(parentTs)-2], i+1),
+				Attrs:     dto.ThreadMessageAttrs{Message: dto.SlackMessage{Text: "reply from " + cmp.Or(botID, "human"), BotID: botID}},
+			}))
+		}
+	}
+
+	var messages []schema.MessagesV2
+	for i := range 20 {
+		ts := fmt.Sprintf("%d.000000", 1000+i)
+		messages = append(messages, addMessage(ts, dto.MessageAttrs{Message: dto.SlackMessage{User: "U1", Text: "question"}}))
+		addReplies(ts, 5, "")
+	}
+	incident := addMessage("2000.000000", dto.MessageAttrs{
+		Message:        dto.SlackMessage{BotID: "B1", Text: "HighLatency firing"},
+		IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+	})
+	messages = append(messages, incident)
+	addReplies(incident.Ts, 1, "B1")
+	messages = append(messages, addMessage("3000.000000", dto.MessageAttrs{Message: dto.SlackMessage{BotID: "B1", Text: "deploy done"}}))
+
+	threads, err := suggestionThreads(t.Context(), q, messages, 10, 0)
+	require.NoError(t, err)
+	total := 0
+	for _, thread := range threads {
+		total += len(thread)
+		require.NotContains(t, thread, "deploy done")
+		require.NotContains(t, thread, "reply from B1")
+	}
+	require.LessOrEqual(t, total, 10)
+	require.Len(t, threads, 5)
+	require.Equal(t, []string{"HighLatency firing"}, threads[len(threads)-1])
+	require.Equal(t, []string{"question", "reply from human"}, threads[0])
+
+	threads, err = suggestionThreads(t.Context(), q, messages, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, threads, 21)
+	require.Len(t, threads[0], 3)
+}
+
+func TestPublishFansOutToDestinations(t *testing.T) {
+	var channels []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channels = append(channels, r.FormValue("channel"))
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w := &reportWorker{
+		slackClient:      slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")),
+		maxMessageLength: 3000,
+	}
+	args := background.ReportWorkerArgs{ChannelID: "C1", Destinations: []string{"C2", "C1", "C3"}}
+
+	var delivered []string
+	record := func(channelID string) error {
+		delivered = append(delivered, channelID)
+		return nil
+	}
+
+	require.NoError(t, w.publish(t.Context(), reportDestinations(args, ""), "*Weekly Channel Report*", nil, record))
+	require.Equal(t, []string{"C1", "C2", "C3"}, channels)
+	require.Equal(t, channels, delivered)
+
+	channels, delivered = nil, nil
+	require.NoError(t, w.publish(t.Context(), reportDestinations(args, "CDEV"), "*Weekly Channel Report*", nil, record))
+	require.Equal(t, []string{"CDEV"}, channels)
+	require.Equal(t, channels, delivered)
+}
+
+func TestFailedReportReleasesClaim(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		if posts == 1 {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 3000, 0, 0, AttachmentNone, time.Hour, false)
+	require.NoError(t, err)
+
+	require.Error(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 1}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	channel, err := schema.New(db).GetChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.Empty(t, channel.Attrs.ReportPostedTs)
+
+	// The failed job didn't hold the window, so the next one posts.
+	require.NoError(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 2}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	require.Equal(t, 2, posts)
+	channel, err = schema.New(db).GetChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.NotEmpty(t, channel.Attrs.ReportPostedTs)
+	require.Equal(t, int64(2), channel.Attrs.ReportJobID)
+	require.Equal(t, []string{"C1"}, channel.Attrs.ReportDeliveredTo)
+}
+
+func TestFailedUploadDoesNotRepostReport(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	var posts int
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	})
+	mux.HandleFunc("/files.getUploadURLExternal", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+	})
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 3000, 0, 0, AttachmentMarkdown, time.Hour, false)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 1}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	require.Equal(t, 1, posts)
+	channel, err := schema.New(db).GetChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"C1"}, channel.Attrs.ReportDeliveredTo)
+}
+
+func TestReportRetrySkipsDeliveredDestinations(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	var posts []string
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel := r.FormValue("channel")
+		posts = append(posts, channel)
+		if channel == "C3" && !failed {
+			failed = true
+			_, _ = w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 3000, 0, 0, AttachmentNone, 0, false)
+	require.NoError(t, err)
+
+	job := &river.Job[background.ReportWorkerArgs]{
+		JobRow: &rivertype.JobRow{ID: 1},
+		Args:   background.ReportWorkerArgs{ChannelID: "C1", Destinations: []string{"C2", "C3"}},
+	}
+	require.Error(t, w.Work(ctx, job))
+	require.NoError(t, w.Work(ctx, job))
+	require.Equal(t, []string{"C1", "C2", "C3", "C3"}, posts)
+
+	// A new job posts everywhere again.
+	posts = nil
+	job.JobRow = &rivertype.JobRow{ID: 2}
+	require.NoError(t, w.Work(ctx, job))
+	require.Equal(t, []string{"C1", "C2", "C3"}, posts)
+}
+
+func TestReportRetrySkipsDestinationThatFailedAfterPosting(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	// The report is long enough to continue in its thread, and C2's continuation fails once.
+	var roots []string
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel := r.FormValue("channel")
+		if r.FormValue("thread_ts") == "" {
+			roots = append(roots, channel)
+		} else if channel == "C2" && !failed {
+			failed = true
+			_, _ = w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 100, 0, 0, AttachmentNone, 0, false)
+	require.NoError(t, err)
+
+	job := &river.Job[background.ReportWorkerArgs]{
+		JobRow: &rivertype.JobRow{ID: 1},
+		Args:   background.ReportWorkerArgs{ChannelID: "C1", Destinations: []string{"C2"}},
+	}
+	require.NoError(t, w.Work(ctx, job))
+	require.True(t, failed)
+	require.Equal(t, []string{"C1", "C2"}, roots)
+
+	channel, err := schema.New(db).GetChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"C1", "C2"}, channel.Attrs.ReportDeliveredTo)
+
+	// A retry of the job posts nowhere again.
+	require.NoError(t, w.Work(ctx, job))
+	require.Equal(t, []string{"C1", "C2"}, roots)
+}
+
+// setupChannel returns a database with channel C1 holding one incident from the past week.
+func setupChannel(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	_, err := schema.New(db).AddChannel(ctx, "C1")
+	require.NoError(t, err)
+	_, err = schema.New(db).AddMessage(ctx, schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        internal.TimeToTs(time.Now().Add(-time.Hour)),
+		Attrs: dto.MessageAttrs{
+			Message:        dto.SlackMessage{BotID: "B1", BotUsername: "alertmanager"},
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+		},
+	})
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestPreviewPostsNothing(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 3000, 0, 10, AttachmentNone, 0, false)
+	require.NoError(t, err)
+
+	blocks, err := w.Preview(ctx, "C1")
+	require.NoError(t, err)
+	var text strings.Builder
+	for _, block := range blocks {
+		text.WriteString(block.(*slack.SectionBlock).Text.Text)
+	}
+	require.Contains(t, text.String(), "HighLatency")
+	require.Zero(t, calls)
+}
+
+func TestReportPostedOncePerWindow(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, []string{"C1"}, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), nil, "", 3000, 0, 10, AttachmentNone, time.Hour, false)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 1}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	require.NoError(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 2}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	require.Equal(t, 1, posts)
+}
+
+func TestReportPostsWithoutSuggestionsWhenLLMFails(t *testing.T) {
+	ctx := context.Background()
+	db := setupChannel(t)
+
+	llmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/models/") {
+			_, _ = fmt.Fprintf(w, `{"id":%q,"object":"model"}`, strings.TrimPrefix(r.URL.Path, "/models/"))
+			return
+		}
+		http.Error(w, `{"error":{"message":"model overloaded"}}`, http.StatusBadRequest)
+	}))
+	t.Cleanup(llmSrv.Close)
+	llmClient, err := llm.New(ctx, llm.Config{URL: llmSrv.URL + "/", APIKey: "test", Model: "test-model"})
+	require.NoError(t, err)
+
+	var posted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = append(posted, r.FormValue("text"))
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w, err := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), llmClient, "", 3000, 0, 10, AttachmentNone, 0, false)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Work(ctx, &river.Job[background.ReportWorkerArgs]{JobRow: &rivertype.JobRow{ID: 1}, Args: background.ReportWorkerArgs{ChannelID: "C1"}}))
+	require.Len(t, posted, 1)
+	require.Contains(t, posted[0], "HighLatency")
+	require.Contains(t, posted[0], "Suggestions are unavailable")
+}
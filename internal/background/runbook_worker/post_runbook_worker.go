@@ -4,10 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 
 	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/llm"
+	"github.com/dynoinc/ratchet/internal/oncall"
+	"github.com/dynoinc/ratchet/internal/slack_integration"
 	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
 	"github.com/slack-go/slack"
 )
@@ -15,16 +21,26 @@ import (
 type postRunbookWorker struct {
 	river.WorkerDefaults[background.PostRunbookWorkerArgs]
 
-	bot          *internal.Bot
-	slackClient  *slack.Client
-	devChannelID string
+	bot              *internal.Bot
+	slackClient      *slack.Client
+	devChannelID     string
+	maxMessageLength int
+	broadcast        bool
+	// Post runbooks as Block Kit blocks instead of plain text.
+	blocks bool
+	// Mentioned in the runbook reply when set.
+	onCall oncall.Provider
 }
 
-func NewPostRunbookWorker(bot *internal.Bot, slackClient *slack.Client, devChannelID string) *postRunbookWorker {
+func NewPostRunbookWorker(bot *internal.Bot, slackClient *slack.Client, devChannelID string, maxMessageLength int, broadcast, blocks bool, onCall oncall.Provider) *postRunbookWorker {
 	return &postRunbookWorker{
-		bot:          bot,
-		slackClient:  slackClient,
-		devChannelID: devChannelID,
+		bot:              bot,
+		slackClient:      slackClient,
+		devChannelID:     devChannelID,
+		maxMessageLength: maxMessageLength,
+		broadcast:        broadcast,
+		blocks:           blocks,
+		onCall:           onCall,
 	}
 }
 
@@ -38,12 +54,21 @@ func (w *postRunbookWorker) Work(ctx context.Context, job *river.Job[background.
 		return fmt.Errorf("getting message: %w", err)
 	}
 
+	channel, err := schema.New(w.bot.DB).GetChannel(ctx, job.Args.ChannelID)
+	if err != nil {
+		return fmt.Errorf("getting channel: %w", err)
+	}
+	if !w.bot.ChannelAllowed(channel) {
+		return nil
+	}
+
 	serviceName := msg.IncidentAction.Service
 	alertName := msg.IncidentAction.Alert
 
 	runbook, err := schema.New(w.bot.DB).GetRunbook(ctx, schema.GetRunbookParams{
 		ServiceName: serviceName,
 		AlertName:   alertName,
+		Locale:      llm.RunbookLocale(channel.Attrs.Locale),
 	})
 	if err != nil {
 		return fmt.Errorf("getting runbook: %w", err)
@@ -64,25 +89,70 @@ func (w *postRunbookWorker) Work(ctx context.Context, job *river.Job[background.
 		}
 	}
 
+	runbookURL, err := schema.New(w.bot.DB).GetAlertRunbookURL(ctx, schema.GetAlertRunbookURLParams{
+		Service: serviceName,
+		Alert:   alertName,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("getting runbook url: %w", err)
+	}
+
 	runbookMessage := "No runbook found for this alert"
 	if runbook.Attrs.Runbook != "" {
 		runbookMessage = fmt.Sprintf("Runbook: %s", runbook.Attrs.Runbook)
 	}
+	if runbookURL != "" {
+		runbookMessage = fmt.Sprintf("<%s|Runbook link>\n\n%s", runbookURL, runbookMessage)
+	}
 	runbookMessage = fmt.Sprintf("%s\n\n%s", runbookMessage, updatesMessage)
+	if mention := w.onCallMention(ctx, serviceName); mention != "" {
+		runbookMessage = fmt.Sprintf("On-call for %s: %s\n\n%s", serviceName, mention, runbookMessage)
+	}
 
-	channelID := job.Args.ChannelID
-	msgOptions := []slack.MsgOption{slack.MsgOptionText(runbookMessage, false)}
+	// Ingested incidents have no Slack message to reply to, so their runbook goes to the channel.
+	channelID, threadTS := job.Args.ChannelID, job.Args.SlackTS
+	if msg.Synthetic {
+		threadTS = ""
+	}
 	if w.devChannelID != "" {
-		channelID = w.devChannelID
-	} else {
-		msgOptions = append(msgOptions, slack.MsgOptionTS(job.Args.SlackTS))
+		channelID, threadTS = w.devChannelID, ""
 	}
 
-	if _, _, err := w.slackClient.PostMessage(
-		channelID,
-		msgOptions...); err != nil {
+	if w.blocks {
+		_, err = slack_integration.PostBlocks(ctx, w.slackClient, channelID, threadTS, runbookMessage, w.broadcast)
+	} else {
+		_, err = slack_integration.PostMessage(ctx, w.slackClient, channelID, threadTS, runbookMessage, w.maxMessageLength, w.broadcast)
+	}
+	if err != nil {
 		return fmt.Errorf("posting runbook message: %w", err)
 	}
 
 	return nil
 }
+
+// onCallMention returns a mention of service's current on-call, or "" if there is nobody to
+// mention. Lookup failures are logged rather than holding back the runbook.
+func (w *postRunbookWorker) onCallMention(ctx context.Context, service string) string {
+	if w.onCall == nil || service == "" {
+		return ""
+	}
+
+	user, err := w.onCall.OnCall(ctx, service)
+	if err != nil {
+		slog.WarnContext(ctx, "looking up on-call failed", "service", service, "error", err)
+		return ""
+	}
+
+	if strings.Contains(user, "@") {
+		user, err = slack_integration.GetUserIDByEmail(ctx, w.slackClient, user)
+		if err != nil {
+			slog.WarnContext(ctx, "resolving on-call email failed", "service", service, "error", err)
+			return ""
+		}
+	}
+	if user == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("<@%s>", user)
+}
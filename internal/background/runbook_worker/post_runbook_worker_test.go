@@ -0,0 +1,148 @@
+package runbook_worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/background/report_worker"
+	"github.com/dynoinc/ratchet/internal/oncall"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestOnCallMention(t *testing.T) {
+	var lookups []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/users.lookupByEmail", r.URL.Path)
+		lookups = append(lookups, r.FormValue("email"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U456"}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	var static oncall.Static
+	require.NoError(t, static.Decode("payments:U123,search:bob@example.com"))
+
+	w := NewPostRunbookWorker(nil, slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "", 3000, false, false, static)
+	require.Equal(t, "<@U123>", w.onCallMention(t.Context(), "payments"))
+	require.Equal(t, "<@U456>", w.onCallMention(t.Context(), "search"))
+	require.Empty(t, w.onCallMention(t.Context(), "billing"))
+	require.Equal(t, []string{"bob@example.com"}, lookups)
+
+	require.Error(t, static.Decode("payments"))
+}
+
+func TestUnlistedChannelIsIngestedButNotPostedIn(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	var posts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts = append(posts, r.FormValue("channel"))
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+
+	riverClient, err := river.NewClient(riverpgxv5.New(db), &river.Config{})
+	require.NoError(t, err)
+	bot := internal.New(db, []string{"C2"}, nil, false, false)
+	require.NoError(t, bot.Init(riverClient))
+
+	_, err = schema.New(db).CreateRunbook(ctx, dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Runbook: "restart"})
+	require.NoError(t, err)
+
+	runbooks := NewPostRunbookWorker(bot, slackClient, "", 3000, false, false, nil)
+	reports, err := report_worker.New(bot, slackClient, nil, "", 3000, 0, 0, report_worker.AttachmentNone, 0, false)
+	require.NoError(t, err)
+
+	for _, channelID := range []string{"C1", "C2"} {
+		_, err := schema.New(db).AddChannel(ctx, channelID)
+		require.NoError(t, err)
+
+		require.NoError(t, bot.Notify(ctx, &slackevents.MessageEvent{
+			Channel:   channelID,
+			TimeStamp: "1700000000.000000",
+			Username:  "alertmanager",
+			BotID:     "B1",
+			Text:      "[FIRING] payments/HighLatency",
+		}))
+
+		// Stored, and classified as an incident, whether or not the bot may post in the channel.
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, bot.UpdateMessage(ctx, tx, schema.UpdateMessageAttrsParams{
+			ChannelID: channelID,
+			Ts:        "1700000000.000000",
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: "payments",
+				Alert:   "HighLatency",
+			}},
+		}))
+		require.NoError(t, tx.Commit(ctx))
+
+		msg, err := bot.GetMessage(ctx, channelID, "1700000000.000000")
+		require.NoError(t, err)
+		require.Equal(t, "[FIRING] payments/HighLatency", msg.Message.Text)
+
+		require.NoError(t, runbooks.Work(ctx, &river.Job[background.PostRunbookWorkerArgs]{
+			Args: background.PostRunbookWorkerArgs{ChannelID: channelID, SlackTS: "1700000000.000000"},
+		}))
+		require.NoError(t, reports.Work(ctx, &river.Job[background.ReportWorkerArgs]{
+			JobRow: &rivertype.JobRow{ID: 1},
+			Args:   background.ReportWorkerArgs{ChannelID: channelID},
+		}))
+	}
+
+	// Only the listed channel got its runbook and report.
+	require.Equal(t, []string{"C2", "C2"}, posts)
+}
+
+func TestSyntheticIncidentRunbookPostedToChannel(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	q := schema.New(db)
+	_, err := q.AddChannel(ctx, "C1")
+	require.NoError(t, err)
+	_, err = q.AddMessage(ctx, schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "1700000000.000000",
+		Attrs: dto.MessageAttrs{
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+			Synthetic:      true,
+		},
+	})
+	require.NoError(t, err)
+	_, err = q.CreateRunbook(ctx, dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Runbook: "restart"})
+	require.NoError(t, err)
+
+	var threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		threads = append(threads, r.FormValue("thread_ts"))
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w := NewPostRunbookWorker(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "", 3000, true, false, nil)
+	require.NoError(t, w.Work(ctx, &river.Job[background.PostRunbookWorkerArgs]{
+		Args: background.PostRunbookWorkerArgs{ChannelID: "C1", SlackTS: "1700000000.000000"},
+	}))
+
+	// The ingested incident's ts isn't a Slack message, so the runbook isn't a reply to it.
+	require.Equal(t, []string{""}, threads)
+}
@@ -18,14 +18,16 @@ import (
 type updateRunbookWorker struct {
 	river.WorkerDefaults[background.UpdateRunbookWorkerArgs]
 
-	bot       *internal.Bot
-	llmClient *llm.Client
+	bot                 *internal.Bot
+	llmClient           *llm.Client
+	threadMessagesLimit int
 }
 
-func NewUpdateRunbookWorker(bot *internal.Bot, llmClient *llm.Client) *updateRunbookWorker {
+func NewUpdateRunbookWorker(bot *internal.Bot, llmClient *llm.Client, threadMessagesLimit int) *updateRunbookWorker {
 	return &updateRunbookWorker{
-		bot:       bot,
-		llmClient: llmClient,
+		bot:                 bot,
+		llmClient:           llmClient,
+		threadMessagesLimit: threadMessagesLimit,
 	}
 }
 
@@ -37,24 +39,32 @@ func (w *updateRunbookWorker) Work(ctx context.Context, job *river.Job[backgroun
 
 	// get thread messages
 	threadMsgs, err := schema.New(w.bot.DB).GetThreadMessages(ctx, schema.GetThreadMessagesParams{
-		ChannelID: job.Args.ChannelID,
-		ParentTs:  job.Args.SlackTS,
+		ChannelID:   job.Args.ChannelID,
+		ParentTs:    job.Args.SlackTS,
+		MaxMessages: int32(w.threadMessagesLimit),
 	})
 	if err != nil {
 		return fmt.Errorf("getting thread messages: %w", err)
 	}
 
-	// get current runbook
+	channel, err := schema.New(w.bot.DB).GetChannel(ctx, job.Args.ChannelID)
+	if err != nil {
+		return fmt.Errorf("getting channel: %w", err)
+	}
+
+	// get current runbook in the channel's language
+	locale := llm.RunbookLocale(channel.Attrs.Locale)
 	runbook, err := schema.New(w.bot.DB).GetRunbook(ctx, schema.GetRunbookParams{
 		ServiceName: msg.IncidentAction.Service,
 		AlertName:   msg.IncidentAction.Alert,
+		Locale:      locale,
 	})
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return fmt.Errorf("getting runbook: %w", err)
 	}
 
 	// ask LLM to update the existing runbook with the info from new messages
-	updatedRunbook, err := w.llmClient.UpdateRunbook(ctx, runbook, msg, threadMsgs)
+	updatedRunbook, err := w.llmClient.UpdateRunbook(ctx, runbook, msg, threadMsgs, locale)
 	if err != nil {
 		return fmt.Errorf("updating runbook: %w", err)
 	}
@@ -70,6 +80,7 @@ func (w *updateRunbookWorker) Work(ctx context.Context, job *river.Job[backgroun
 		ServiceName: msg.IncidentAction.Service,
 		AlertName:   msg.IncidentAction.Alert,
 		Runbook:     updatedRunbook,
+		Locale:      locale,
 	}); err != nil {
 		return fmt.Errorf("creating runbook: %w", err)
 	}
@@ -0,0 +1,183 @@
+package status_update_worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/riverqueue/river"
+	"github.com/slack-go/slack"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+type statusUpdateWorker struct {
+	river.WorkerDefaults[background.StatusUpdateWorkerArgs]
+
+	bot          *internal.Bot
+	slackClient  *slack.Client
+	devChannelID string
+}
+
+func New(bot *internal.Bot, slackClient *slack.Client, devChannelID string) *statusUpdateWorker {
+	return &statusUpdateWorker{
+		bot:          bot,
+		slackClient:  slackClient,
+		devChannelID: devChannelID,
+	}
+}
+
+// Work posts a structured status update in the incident's thread and stores it on the posted
+// reply, so the incident's updates can be read back as a timeline.
+func (w *statusUpdateWorker) Work(ctx context.Context, job *river.Job[background.StatusUpdateWorkerArgs]) error {
+	msg, err := w.bot.GetMessage(ctx, job.Args.ChannelID, job.Args.SlackTS)
+	if err != nil {
+		if errors.Is(err, internal.ErrMessageNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("getting incident message: %w", err)
+	}
+
+	allowed, err := w.bot.IsChannelAllowed(ctx, job.Args.ChannelID)
+	if err != nil {
+		return fmt.Errorf("checking channel allowlist: %w", err)
+	}
+	if !allowed {
+		return nil
+	}
+
+	text, err := formatStatusUpdate(job.Args.Update)
+	if err != nil {
+		return err
+	}
+
+	// Updates posted to the dev channel aren't replies in the incident's thread, so there is
+	// nothing to store.
+	if w.devChannelID != "" {
+		if _, _, err := w.slackClient.PostMessageContext(ctx, w.devChannelID, slack.MsgOptionText(text, false)); err != nil {
+			return fmt.Errorf("posting status update: %w", err)
+		}
+		return nil
+	}
+
+	// Updates to ingested incidents are posted to the channel, as there is no Slack thread to
+	// reply in. They are still stored with the incident.
+	threadTS := job.Args.SlackTS
+	if msg.Synthetic {
+		threadTS = ""
+	}
+
+	// A retry after storing failed must not post the update again.
+	var ts string
+	if job.Attempt > 1 {
+		ts, err = w.findPosted(ctx, job.Args.ChannelID, threadTS, text, job.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	if ts == "" {
+		opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+		_, ts, err = w.slackClient.PostMessageContext(ctx, job.Args.ChannelID, opts...)
+		if err != nil {
+			return fmt.Errorf("posting status update: %w", err)
+		}
+	}
+
+	// Slack also delivers the reply as a message event, which may land before or after this.
+	if err := schema.New(w.bot.DB).UpsertStatusUpdate(ctx, schema.UpsertStatusUpdateParams{
+		ChannelID: job.Args.ChannelID,
+		ParentTs:  job.Args.SlackTS,
+		Ts:        ts,
+		Attrs: dto.ThreadMessageAttrs{
+			Message:      dto.SlackMessage{Text: text},
+			StatusUpdate: job.Args.Update,
+		},
+	}); err != nil {
+		return fmt.Errorf("storing status update: %w", err)
+	}
+
+	return nil
+}
+
+// findPosted returns the ts of a bot message with text in the thread, or in the channel since
+// since if threadTS is empty, or "" if there is none.
+func (w *statusUpdateWorker) findPosted(ctx context.Context, channelID, threadTS, text string, since time.Time) (string, error) {
+	if threadTS == "" {
+		params := &slack.GetConversationHistoryParameters{ChannelID: channelID, Oldest: internal.TimeToTs(since)}
+		for {
+			history, err := w.slackClient.GetConversationHistoryContext(ctx, params)
+			if err != nil {
+				return "", fmt.Errorf("getting channel history: %w", err)
+			}
+
+			if ts := postedTs(history.Messages, text); ts != "" {
+				return ts, nil
+			}
+
+			if !history.HasMore {
+				return "", nil
+			}
+			params.Cursor = history.ResponseMetaData.NextCursor
+		}
+	}
+
+	params := &slack.GetConversationRepliesParameters{ChannelID: channelID, Timestamp: threadTS}
+	for {
+		replies, hasMore, nextCursor, err := w.slackClient.GetConversationRepliesContext(ctx, params)
+		if err != nil {
+			return "", fmt.Errorf("getting thread replies: %w", err)
+		}
+
+		if ts := postedTs(replies, text); ts != "" {
+			return ts, nil
+		}
+
+		if !hasMore {
+			return "", nil
+		}
+		params.Cursor = nextCursor
+	}
+}
+
+// postedTs returns the ts of the first bot message in messages with text, or "".
+func postedTs(messages []slack.Message, text string) string {
+	for _, msg := range messages {
+		if msg.BotID != "" && msg.Text == text {
+			return msg.Timestamp
+		}
+	}
+
+	return ""
+}
+
+// formatStatusUpdate renders update in the same layout for every incident.
+func formatStatusUpdate(update dto.StatusUpdate) (string, error) {
+	if !slices.Contains(dto.IncidentStatuses, update.Status) {
+		return "", fmt.Errorf("unknown incident status %q, expected one of %s", update.Status, strings.Join(dto.IncidentStatuses, ", "))
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "*Status update:* %s\n", strings.ToUpper(update.Status[:1])+update.Status[1:])
+	if update.Impact != "" {
+		fmt.Fprintf(&text, "*Impact:* %s\n", update.Impact)
+	}
+	if update.NextUpdateTs != "" {
+		next, err := internal.TsToTime(update.NextUpdateTs)
+		if err != nil {
+			return "", fmt.Errorf("parsing next update ts: %w", err)
+		}
+		fmt.Fprintf(&text, "*Next update:* <!date^%d^{date_short_pretty} {time}|%s>\n", next.Unix(), next.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+
+	return strings.TrimSuffix(text.String(), "\n"), nil
+}
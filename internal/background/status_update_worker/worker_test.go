@@ -0,0 +1,192 @@
+package status_update_worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestFormatStatusUpdate(t *testing.T) {
+	text, err := formatStatusUpdate(dto.StatusUpdate{
+		Status:       dto.IncidentStatusMonitoring,
+		Impact:       "Checkout latency elevated in us-east",
+		NextUpdateTs: "1700001800.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "*Status update:* Monitoring\n*Impact:* Checkout latency elevated in us-east\n*Next update:* <!date^1700001800^{date_short_pretty} {time}|2023-11-14 22:43 UTC>", text)
+
+	_, err = formatStatusUpdate(dto.StatusUpdate{Status: "fixed"})
+	require.Error(t, err)
+}
+
+// setupIncident returns a database with an incident opened at 1700000000.000000 in C1.
+func setupIncident(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	q := schema.New(db)
+	_, err := q.AddChannel(ctx, "C1")
+	require.NoError(t, err)
+	_, err = q.AddMessage(ctx, schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "1700000000.000000",
+		Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+			Action:  dto.ActionOpenIncident,
+			Service: "payments",
+			Alert:   "HighLatency",
+		}},
+	})
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestStatusUpdateStoredOnReply(t *testing.T) {
+	ctx := context.Background()
+	db := setupIncident(t)
+	q := schema.New(db)
+
+	// The message event for the reply arrives before the worker stores the update.
+	require.NoError(t, q.AddThreadMessage(ctx, schema.AddThreadMessageParams{
+		ChannelID: "C1",
+		ParentTs:  "1700000000.000000",
+		Ts:        "1700000100.000000",
+		Attrs:     dto.ThreadMessageAttrs{Message: dto.SlackMessage{BotID: "B1", Text: "*Status update:* Identified"}},
+	}))
+
+	var threadTS string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		threadTS = r.FormValue("thread_ts")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000100.000000"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "")
+	update := dto.StatusUpdate{Status: dto.IncidentStatusIdentified, Impact: "Card payments failing"}
+	require.NoError(t, w.Work(ctx, &river.Job[background.StatusUpdateWorkerArgs]{JobRow: &rivertype.JobRow{Attempt: 1}, Args: background.StatusUpdateWorkerArgs{
+		ChannelID: "C1",
+		SlackTS:   "1700000000.000000",
+		Update:    update,
+	}}))
+	require.Equal(t, "1700000000.000000", threadTS)
+
+	msgs, err := q.GetThreadMessages(ctx, schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, update, msgs[0].Attrs.StatusUpdate)
+	require.Equal(t, "B1", msgs[0].Attrs.Message.BotID)
+}
+
+func TestStatusUpdateRetryDoesNotRepost(t *testing.T) {
+	ctx := context.Background()
+	db := setupIncident(t)
+
+	update := dto.StatusUpdate{Status: dto.IncidentStatusMonitoring}
+	text, err := formatStatusUpdate(update)
+	require.NoError(t, err)
+
+	var posts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/conversations.replies":
+			// The previous attempt posted the update, then failed to store it.
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"ok": true,
+				"messages": []map[string]string{
+					{"ts": "1700000000.000000", "text": "[FIRING] payments/HighLatency"},
+					{"ts": "1700000100.000000", "text": text, "bot_id": "B1"},
+				},
+			}))
+		case "/chat.postMessage":
+			posts++
+			_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000200.000000"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	w := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "")
+	job := &river.Job[background.StatusUpdateWorkerArgs]{JobRow: &rivertype.JobRow{Attempt: 2}, Args: background.StatusUpdateWorkerArgs{
+		ChannelID: "C1",
+		SlackTS:   "1700000000.000000",
+		Update:    update,
+	}}
+	require.NoError(t, w.Work(ctx, job))
+	require.Zero(t, posts)
+
+	msgs, err := schema.New(db).GetThreadMessages(ctx, schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "1700000100.000000", msgs[0].Ts)
+}
+
+func TestStatusUpdateInDevChannelIsNotStored(t *testing.T) {
+	ctx := context.Background()
+	db := setupIncident(t)
+
+	var channel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel = r.FormValue("channel")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"CDEV","ts":"1700000100.000000"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "CDEV")
+	require.NoError(t, w.Work(ctx, &river.Job[background.StatusUpdateWorkerArgs]{JobRow: &rivertype.JobRow{Attempt: 1}, Args: background.StatusUpdateWorkerArgs{
+		ChannelID: "C1",
+		SlackTS:   "1700000000.000000",
+		Update:    dto.StatusUpdate{Status: dto.IncidentStatusIdentified},
+	}}))
+	require.Equal(t, "CDEV", channel)
+
+	msgs, err := schema.New(db).GetThreadMessages(ctx, schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Empty(t, msgs)
+}
+
+func TestStatusUpdateForSyntheticIncidentPostedToChannel(t *testing.T) {
+	ctx := context.Background()
+	db := setupIncident(t)
+	require.NoError(t, schema.New(db).UpdateMessageAttrs(ctx, schema.UpdateMessageAttrsParams{
+		ChannelID: "C1",
+		Ts:        "1700000000.000000",
+		Attrs:     dto.MessageAttrs{Synthetic: true},
+	}))
+
+	var threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		threads = append(threads, r.FormValue("thread_ts"))
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000100.000000"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	w := New(internal.New(db, nil, nil, false, false), slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/")), "")
+	require.NoError(t, w.Work(ctx, &river.Job[background.StatusUpdateWorkerArgs]{JobRow: &rivertype.JobRow{Attempt: 1}, Args: background.StatusUpdateWorkerArgs{
+		ChannelID: "C1",
+		SlackTS:   "1700000000.000000",
+		Update:    dto.StatusUpdate{Status: dto.IncidentStatusIdentified},
+	}}))
+	require.Equal(t, []string{""}, threads)
+
+	// The update is still part of the incident's timeline.
+	msgs, err := schema.New(db).GetThreadMessages(ctx, schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1700000000.000000"})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, "1700000100.000000", msgs[0].Ts)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/riverqueue/river"
+	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 
 	"github.com/dynoinc/ratchet/internal/background"
@@ -27,11 +29,23 @@ var (
 type Bot struct {
 	DB          *pgxpool.Pool
 	riverClient *river.Client[pgx.Tx]
+
+	// Channel IDs or names the bot may post in. Empty means all channels.
+	allowedChannels []string
+	redactor        *Redactor
+	// Replace the stored Slack message when a message is delivered again, keeping enrichments.
+	upsertMessages bool
+	// Backfill the thread when a reply arrives for a parent message that isn't stored.
+	backfillUnknownThreads bool
 }
 
-func New(db *pgxpool.Pool) *Bot {
+func New(db *pgxpool.Pool, allowedChannels []string, redactor *Redactor, upsertMessages, backfillUnknownThreads bool) *Bot {
 	return &Bot{
-		DB: db,
+		DB:                     db,
+		allowedChannels:        allowedChannels,
+		redactor:               redactor,
+		upsertMessages:         upsertMessages,
+		backfillUnknownThreads: backfillUnknownThreads,
 	}
 }
 
@@ -58,33 +72,69 @@ func (b *Bot) UpdateMessage(ctx context.Context, tx pgx.Tx, params schema.Update
 	}
 
 	if params.Attrs.IncidentAction.Action == dto.ActionOpenIncident {
-		if _, err := b.riverClient.InsertTx(ctx, tx, background.PostRunbookWorkerArgs{
+		// Replies stored before the message was classified didn't acknowledge it.
+		if err := qtx.AcknowledgeIncidentFromThread(ctx, schema.AcknowledgeIncidentFromThreadParams{
 			ChannelID: params.ChannelID,
-			SlackTS:   params.Ts,
-		}, nil); err != nil {
-			return fmt.Errorf("scheduling runbook worker: %w", err)
+			Ts:        params.Ts,
+		}); err != nil {
+			return fmt.Errorf("acknowledging incident (ts=%s) in channel %s: %w", params.Ts, params.ChannelID, err)
 		}
 
-		// schedule a job to update runbook 1 day after the incident is opened
-		ts, err := TsToTime(params.Ts)
-		if err != nil {
-			return fmt.Errorf("converting slack ts (%s) to time: %w", params.Ts, err)
+		if err := b.scheduleRunbooks(ctx, tx, params.ChannelID, params.Ts); err != nil {
+			return err
 		}
+	}
 
-		if _, err := b.riverClient.InsertTx(ctx, tx, background.UpdateRunbookWorkerArgs{
-			ChannelID: params.ChannelID,
-			SlackTS:   params.Ts,
-		}, &river.InsertOpts{
-			Queue:       "update_runbook",
-			ScheduledAt: ts.Add(24 * time.Hour),
-		}); err != nil {
-			return fmt.Errorf("scheduling runbook worker: %w", err)
-		}
+	return nil
+}
+
+// scheduleRunbooks schedules posting the runbook for a newly opened incident, and updating it
+// from the incident's thread a day later.
+func (b *Bot) scheduleRunbooks(ctx context.Context, tx pgx.Tx, channelID, slackTS string) error {
+	if _, err := b.riverClient.InsertTx(ctx, tx, background.PostRunbookWorkerArgs{
+		ChannelID: channelID,
+		SlackTS:   slackTS,
+	}, nil); err != nil {
+		return fmt.Errorf("scheduling runbook worker: %w", err)
+	}
+
+	// schedule a job to update runbook 1 day after the incident is opened
+	ts, err := TsToTime(slackTS)
+	if err != nil {
+		return fmt.Errorf("converting slack ts (%s) to time: %w", slackTS, err)
+	}
+
+	if _, err := b.riverClient.InsertTx(ctx, tx, background.UpdateRunbookWorkerArgs{
+		ChannelID: channelID,
+		SlackTS:   slackTS,
+	}, &river.InsertOpts{
+		Queue:       "update_runbook",
+		ScheduledAt: ts.Add(24 * time.Hour),
+	}); err != nil {
+		return fmt.Errorf("scheduling runbook worker: %w", err)
 	}
 
 	return nil
 }
 
+// OnboardChannel schedules onboarding for a channel the bot may post in. It reports whether a
+// job was scheduled.
+func (b *Bot) OnboardChannel(ctx context.Context, channelID string) (bool, error) {
+	allowed, err := b.IsChannelAllowed(ctx, channelID)
+	if err != nil {
+		return false, fmt.Errorf("checking channel allowlist: %w", err)
+	}
+	if !allowed {
+		return false, nil
+	}
+
+	if _, err := b.riverClient.Insert(ctx, background.ChannelOnboardWorkerArgs{ChannelID: channelID}, nil); err != nil {
+		return false, fmt.Errorf("scheduling channel onboarding for channel %s: %w", channelID, err)
+	}
+
+	return true, nil
+}
+
 func (b *Bot) AddMessage(ctx context.Context, tx pgx.Tx, params []schema.AddMessageParams, classifierInsertOpts *river.InsertOpts) error {
 	qtx := schema.New(b.DB).WithTx(tx)
 
@@ -94,7 +144,7 @@ func (b *Bot) AddMessage(ctx context.Context, tx pgx.Tx, params []schema.AddMess
 		return fmt.Errorf("adding channel %s: %w", channelID, err)
 	}
 
-	if channel.Attrs == (dto.ChannelAttrs{}) {
+	if channel.Attrs.IsZero() {
 		if err := qtx.UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
 			ID: channelID,
 			Attrs: dto.ChannelAttrs{
@@ -113,18 +163,39 @@ func (b *Bot) AddMessage(ctx context.Context, tx pgx.Tx, params []schema.AddMess
 
 	var jobs []river.InsertManyParams
 	for _, param := range params {
-		if err := qtx.AddMessage(ctx, param); err != nil {
+		b.redactor.RedactMessage(&param.Attrs.Message)
+		var written int64
+		if b.upsertMessages {
+			written, err = qtx.UpsertMessage(ctx, schema.UpsertMessageParams(param))
+		} else {
+			written, err = qtx.AddMessage(ctx, param)
+		}
+		if err != nil {
 			return fmt.Errorf("adding message (ts=%s) to channel %s: %w", param.Ts, param.ChannelID, err)
 		}
 
+		// Messages that arrive with an incident action (e.g. from webhooks) are already classified,
+		// so incidents they open get their runbooks right away. A redelivered one was already
+		// stored, and its runbooks scheduled.
+		if param.Attrs.IncidentAction.Action != "" {
+			if param.Attrs.IncidentAction.Action == dto.ActionOpenIncident && written > 0 {
+				if err := b.scheduleRunbooks(ctx, tx, param.ChannelID, param.Ts); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
 		jobs = append(jobs, river.InsertManyParams{
 			Args:       background.ClassifierArgs{ChannelID: param.ChannelID, SlackTS: param.Ts},
 			InsertOpts: classifierInsertOpts,
 		})
 	}
 
-	if _, err := b.riverClient.InsertManyTx(ctx, tx, jobs); err != nil {
-		return fmt.Errorf("scheduling message classification for channel %s: %w", channelID, err)
+	if len(jobs) > 0 {
+		if _, err := b.riverClient.InsertManyTx(ctx, tx, jobs); err != nil {
+			return fmt.Errorf("scheduling message classification for channel %s: %w", channelID, err)
+		}
 	}
 
 	return nil
@@ -134,18 +205,66 @@ func (b *Bot) AddThreadMessages(ctx context.Context, tx pgx.Tx, params []schema.
 	qtx := schema.New(b.DB).WithTx(tx)
 
 	for _, param := range params {
-		if err := qtx.AddThreadMessage(ctx, param); err != nil {
-			if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.ForeignKeyViolation {
-				continue
-			}
+		b.redactor.RedactMessage(&param.Attrs.Message)
+		added, err := b.addThreadMessage(ctx, tx, param)
+		if err != nil {
+			return err
+		}
+		if !added {
+			continue
+		}
 
-			return fmt.Errorf("adding thread message (ts=%s) to channel %s: %w", param.Ts, param.ChannelID, err)
+		// The first human reply to an incident acknowledges it.
+		msg := param.Attrs.Message
+		if msg.BotID == "" && msg.User != "" && msg.SubType == "" {
+			if err := qtx.SetIncidentAcknowledged(ctx, schema.SetIncidentAcknowledgedParams{
+				AckTs:     param.Ts,
+				ChannelID: param.ChannelID,
+				Ts:        param.ParentTs,
+			}); err != nil {
+				return fmt.Errorf("acknowledging incident (ts=%s) in channel %s: %w", param.ParentTs, param.ChannelID, err)
+			}
 		}
 	}
 
 	return nil
 }
 
+// addThreadMessage adds a reply under a savepoint, so a reply whose parent isn't stored only
+// skips that reply instead of aborting tx. If enabled, the reply's thread is then scheduled
+// for backfill, which stores the parent along with the rest of the thread.
+func (b *Bot) addThreadMessage(ctx context.Context, tx pgx.Tx, param schema.AddThreadMessageParams) (bool, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = sp.Rollback(ctx) }()
+
+	if err := schema.New(b.DB).WithTx(sp).AddThreadMessage(ctx, param); err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != pgerrcode.ForeignKeyViolation {
+			return false, fmt.Errorf("adding thread message (ts=%s) to channel %s: %w", param.Ts, param.ChannelID, err)
+		}
+
+		if err := sp.Rollback(ctx); err != nil {
+			return false, err
+		}
+
+		if b.backfillUnknownThreads {
+			if _, err := b.riverClient.InsertTx(ctx, tx, background.BackfillThreadWorkerArgs{
+				ChannelID: param.ChannelID,
+				SlackTS:   param.ParentTs,
+			}, nil); err != nil {
+				return false, fmt.Errorf("scheduling backfill of thread (ts=%s) in channel %s: %w", param.ParentTs, param.ChannelID, err)
+			}
+		}
+
+		return false, nil
+	}
+
+	return true, sp.Commit(ctx)
+}
+
 func (b *Bot) Notify(ctx context.Context, ev *slackevents.MessageEvent) error {
 	tx, err := b.DB.Begin(ctx)
 	if err != nil {
@@ -153,6 +272,17 @@ func (b *Bot) Notify(ctx context.Context, ev *slackevents.MessageEvent) error {
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
+	// Edits arrive as message_changed events carrying the edited message.
+	if ev.SubType == slack.MsgSubTypeMessageChanged {
+		if ev.Message == nil {
+			return nil
+		}
+		if err := b.updateEditedMessage(ctx, tx, ev.Channel, ev.Message); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+
 	if ev.ThreadTimeStamp == "" {
 		if err := b.AddMessage(ctx, tx, []schema.AddMessageParams{
 			{
@@ -195,6 +325,45 @@ func (b *Bot) Notify(ctx context.Context, ev *slackevents.MessageEvent) error {
 	return tx.Commit(ctx)
 }
 
+// updateEditedMessage replaces the text of a stored message with its edit, if messages are
+// upserted. Edits to messages that aren't stored are ignored. The message is not classified
+// again, so an edited alert doesn't post its runbook twice. Edits to thread replies are ignored.
+func (b *Bot) updateEditedMessage(ctx context.Context, tx pgx.Tx, channelID string, msg *slackevents.MessageEvent) error {
+	if !b.upsertMessages || (msg.ThreadTimeStamp != "" && msg.ThreadTimeStamp != msg.TimeStamp) {
+		return nil
+	}
+
+	qtx := schema.New(b.DB).WithTx(tx)
+	if _, err := qtx.GetMessage(ctx, schema.GetMessageParams{ChannelID: channelID, Ts: msg.TimeStamp}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("getting edited message (ts=%s) from channel %s: %w", msg.TimeStamp, channelID, err)
+	}
+
+	message := dto.SlackMessage{
+		SubType:     msg.SubType,
+		Text:        msg.Text,
+		User:        msg.User,
+		BotID:       msg.BotID,
+		BotUsername: msg.Username,
+	}
+	if msg.Edited != nil {
+		message.EditedTs = msg.Edited.TimeStamp
+	}
+	b.redactor.RedactMessage(&message)
+
+	if _, err := qtx.UpsertMessage(ctx, schema.UpsertMessageParams{
+		ChannelID: channelID,
+		Ts:        msg.TimeStamp,
+		Attrs:     dto.MessageAttrs{Message: message},
+	}); err != nil {
+		return fmt.Errorf("updating edited message (ts=%s) in channel %s: %w", msg.TimeStamp, channelID, err)
+	}
+
+	return nil
+}
+
 func (b *Bot) GetMessage(ctx context.Context, channelID string, slackTs string) (dto.MessageAttrs, error) {
 	msg, err := schema.New(b.DB).GetMessage(ctx, schema.GetMessageParams{
 		ChannelID: channelID,
@@ -211,6 +380,55 @@ func (b *Bot) GetMessage(ctx context.Context, channelID string, slackTs string)
 	return msg.Attrs, nil
 }
 
+// IsChannelAllowed reports whether the bot may post in the channel. Messages from every
+// channel are still ingested.
+func (b *Bot) IsChannelAllowed(ctx context.Context, channelID string) (bool, error) {
+	// A channel the allowlist lists by ID is only loaded to check that it isn't archived. Any
+	// other channel may still be listed by name.
+	listed := channelAllowed(b.allowedChannels, channelID, "")
+
+	channel, err := schema.New(b.DB).GetChannel(ctx, channelID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return listed, nil
+		}
+
+		return false, fmt.Errorf("getting channel %s: %w", channelID, err)
+	}
+	if listed {
+		return !channel.Attrs.Archived, nil
+	}
+
+	return b.ChannelAllowed(channel), nil
+}
+
+// ChannelAllowed is IsChannelAllowed for an already loaded channel. The bot never posts in
+// channels archived in Slack.
+func (b *Bot) ChannelAllowed(channel schema.ChannelsV2) bool {
+	return !channel.Attrs.Archived && channelAllowed(b.allowedChannels, channel.ID, channel.Attrs.Name)
+}
+
+// SetChannelArchived records whether the channel is archived in Slack. Unknown channels are
+// ignored.
+func (b *Bot) SetChannelArchived(ctx context.Context, channelID string, archived bool) error {
+	if err := schema.New(b.DB).SetChannelArchived(ctx, schema.SetChannelArchivedParams{
+		Archived: archived,
+		ID:       channelID,
+	}); err != nil {
+		return fmt.Errorf("marking channel %s archived=%t: %w", channelID, archived, err)
+	}
+
+	return nil
+}
+
+func channelAllowed(allowlist []string, channelID, channelName string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	return slices.Contains(allowlist, channelID) || (channelName != "" && slices.Contains(allowlist, channelName))
+}
+
 func TsToTime(ts string) (time.Time, error) {
 	// Split the timestamp into seconds and microseconds
 	parts := strings.Split(ts, ".")
@@ -241,3 +459,20 @@ func TimeToTs(t time.Time) string {
 	// Convert Unix seconds and nanoseconds to a Slack timestamp
 	return fmt.Sprintf("%d.%06d", seconds, nanoseconds/1000)
 }
+
+// SplitWindows splits [start, end] into consecutive windows of at most size, oldest first.
+func SplitWindows(start, end time.Time, size time.Duration) []background.BackfillWindow {
+	var windows []background.BackfillWindow
+	for oldest := start; oldest.Before(end); oldest = oldest.Add(size) {
+		latest := oldest.Add(size)
+		if latest.After(end) {
+			latest = end
+		}
+		windows = append(windows, background.BackfillWindow{
+			Oldest: TimeToTs(oldest),
+			Latest: TimeToTs(latest),
+		})
+	}
+
+	return windows
+}
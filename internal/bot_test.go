@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+func TestChannelAllowed(t *testing.T) {
+	require.True(t, channelAllowed(nil, "C1", "general"))
+
+	allowlist := []string{"C1", "incidents"}
+	require.True(t, channelAllowed(allowlist, "C1", ""))
+	require.True(t, channelAllowed(allowlist, "C2", "incidents"))
+	require.False(t, channelAllowed(allowlist, "C3", "random"))
+	require.False(t, channelAllowed(allowlist, "C3", ""))
+
+	bot := New(nil, nil, nil, false, false)
+	require.True(t, bot.ChannelAllowed(schema.ChannelsV2{ID: "C1"}))
+	require.False(t, bot.ChannelAllowed(schema.ChannelsV2{ID: "C1", Attrs: dto.ChannelAttrs{Archived: true}}))
+}
+
+func TestSplitWindows(t *testing.T) {
+	windows := SplitWindows(time.Unix(1000, 0), time.Unix(10000, 0), time.Hour)
+	require.Equal(t, []background.BackfillWindow{
+		{Oldest: "1000.000000", Latest: "4600.000000"},
+		{Oldest: "4600.000000", Latest: "8200.000000"},
+		{Oldest: "8200.000000", Latest: "10000.000000"},
+	}, windows)
+
+	require.Empty(t, SplitWindows(time.Unix(1000, 0), time.Unix(1000, 0), time.Hour))
+}
+
+// setupBot returns a bot backed by a fresh database with channel C1, and the River client its
+// jobs are inserted with.
+func setupBot(t *testing.T, upsertMessages, backfillUnknownThreads bool) (*Bot, *river.Client[pgx.Tx]) {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	_, err := schema.New(db).AddChannel(ctx, "C1")
+	require.NoError(t, err)
+
+	riverClient, err := river.NewClient(riverpgxv5.New(db), &river.Config{})
+	require.NoError(t, err)
+	bot := New(db, nil, nil, upsertMessages, backfillUnknownThreads)
+	require.NoError(t, bot.Init(riverClient))
+
+	return bot, riverClient
+}
+
+func TestReplyToUnknownParentSchedulesBackfill(t *testing.T) {
+	ctx := context.Background()
+	bot, riverClient := setupBot(t, false, true)
+
+	reply := func(ts string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{
+			Channel:         "C1",
+			ThreadTimeStamp: "1700000000.000100",
+			TimeStamp:       ts,
+			User:            "U1",
+			Text:            "looking",
+		}
+	}
+	require.NoError(t, bot.Notify(ctx, reply("1700000000.000200")))
+	require.NoError(t, bot.Notify(ctx, reply("1700000000.000300")))
+
+	res, err := riverClient.JobList(ctx, river.NewJobListParams().Kinds("backfill_thread"))
+	require.NoError(t, err)
+	require.Len(t, res.Jobs, 1)
+
+	var args background.BackfillThreadWorkerArgs
+	require.NoError(t, json.Unmarshal(res.Jobs[0].EncodedArgs, &args))
+	require.Equal(t, background.BackfillThreadWorkerArgs{ChannelID: "C1", SlackTS: "1700000000.000100"}, args)
+}
+
+func TestAddMessageRedelivery(t *testing.T) {
+	for _, upsert := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upsert=%t", upsert), func(t *testing.T) {
+			ctx := context.Background()
+			bot, _ := setupBot(t, upsert, false)
+
+			add := func(msg dto.SlackMessage) {
+				tx, err := bot.DB.Begin(ctx)
+				require.NoError(t, err)
+				defer func() { _ = tx.Rollback(ctx) }()
+
+				require.NoError(t, bot.AddMessage(ctx, tx, []schema.AddMessageParams{
+					{ChannelID: "C1", Ts: "1000.000000", Attrs: dto.MessageAttrs{Message: msg}},
+				}, nil))
+				require.NoError(t, tx.Commit(ctx))
+			}
+
+			add(dto.SlackMessage{User: "U1", Text: "payments are down"})
+			add(dto.SlackMessage{User: "U1", Text: "payments are down in us-east", EditedTs: "1010.000000"})
+			add(dto.SlackMessage{User: "U1", Text: "payments are down"})
+
+			attrs, err := bot.GetMessage(ctx, "C1", "1000.000000")
+			require.NoError(t, err)
+			if upsert {
+				require.Equal(t, "payments are down in us-east", attrs.Message.Text)
+			} else {
+				require.Equal(t, "payments are down", attrs.Message.Text)
+			}
+		})
+	}
+}
+
+func TestRedeliveredIncidentSchedulesRunbookOnce(t *testing.T) {
+	for _, upsert := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upsert=%t", upsert), func(t *testing.T) {
+			ctx := context.Background()
+			bot, riverClient := setupBot(t, upsert, false)
+
+			for range 2 {
+				tx, err := bot.DB.Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, bot.AddMessage(ctx, tx, []schema.AddMessageParams{{
+					ChannelID: "C1",
+					Ts:        "1000.000000",
+					Attrs: dto.MessageAttrs{
+						Message:        dto.SlackMessage{BotID: "ratchet_ingest", Text: "open_incident payments/HighLatency"},
+						IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+						Synthetic:      true,
+					},
+				}}, nil))
+				require.NoError(t, tx.Commit(ctx))
+			}
+
+			res, err := riverClient.JobList(ctx, river.NewJobListParams().Kinds("post_runbook"))
+			require.NoError(t, err)
+			require.Len(t, res.Jobs, 1)
+		})
+	}
+}
+
+func TestIsChannelAllowed(t *testing.T) {
+	ctx := context.Background()
+	bot, _ := setupBot(t, false, false)
+	bot.allowedChannels = []string{"C1", "incidents"}
+
+	_, err := schema.New(bot.DB).AddChannel(ctx, "C2")
+	require.NoError(t, err)
+	require.NoError(t, schema.New(bot.DB).UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
+		ID:    "C2",
+		Attrs: dto.ChannelAttrs{Name: "incidents"},
+	}))
+
+	for channelID, want := range map[string]bool{"C1": true, "C2": true, "C3": false} {
+		allowed, err := bot.IsChannelAllowed(ctx, channelID)
+		require.NoError(t, err)
+		require.Equal(t, want, allowed, channelID)
+	}
+
+	for _, channelID := range []string{"C1", "C2"} {
+		require.NoError(t, bot.SetChannelArchived(ctx, channelID, true))
+		allowed, err := bot.IsChannelAllowed(ctx, channelID)
+		require.NoError(t, err)
+		require.False(t, allowed, channelID)
+	}
+}
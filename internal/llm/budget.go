@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultContextWindow is assumed for models without a configured context window. It is
+	// small enough for most models a team would run locally.
+	defaultContextWindow = 8192
+	// completionReserve is the part of the context window left for the model's reply.
+	completionReserve = 2048
+)
+
+// ContextWindows maps model names to their context window in tokens. It decodes from
+// "model:tokens,..." where model names may contain ':', as in "qwen2.5:7b:32768".
+type ContextWindows map[string]int
+
+func (w *ContextWindows) Decode(value string) error {
+	windows := make(ContextWindows)
+	for pair := range strings.SplitSeq(value, ",") {
+		pair = strings.TrimSpace(pair)
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return fmt.Errorf("invalid context window %q, expected model:tokens", pair)
+		}
+
+		tokens, err := strconv.Atoi(pair[i+1:])
+		if err != nil || tokens <= completionReserve {
+			return fmt.Errorf("invalid context window %q, expected more than %d tokens", pair, completionReserve)
+		}
+		windows[pair[:i]] = tokens
+	}
+
+	*w = windows
+	return nil
+}
+
+// inputBudget returns how many tokens of input can go with prompt to task's model, leaving
+// room for the reply.
+func (c *Client) inputBudget(task, prompt string) int {
+	window, ok := c.contextWindows[c.modelFor(task)]
+	if !ok {
+		window = defaultContextWindow
+	}
+
+	return max(window-completionReserve-approxTokens(prompt), 0)
+}
+
+// approxTokens estimates the tokens in text, at roughly four bytes per token.
+func approxTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// sampleToBudget keeps an evenly spaced, in-order subset of lines whose estimated size fits
+// within budget tokens. It returns lines unchanged when they already fit.
+func sampleToBudget(lines []string, budget int) []string {
+	total := 0
+	for _, line := range lines {
+		total += approxTokens(line)
+	}
+	if total <= budget {
+		return lines
+	}
+
+	// Sample every step-th line, widening the step until the sample fits.
+	for step := 2; step <= len(lines); step++ {
+		var sampled []string
+		size := 0
+		for i := 0; i < len(lines); i += step {
+			sampled = append(sampled, lines[i])
+			size += approxTokens(lines[i])
+		}
+		if size <= budget {
+			return sampled
+		}
+	}
+
+	return nil
+}
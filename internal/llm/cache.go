@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// responseCache is an in-memory LRU of chat completions that expire after ttl.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *openai.ChatCompletion
+	expires time.Time
+}
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *responseCache) get(key string) (*openai.ChatCompletion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.resp, true
+}
+
+func (c *responseCache) put(key string, resp *openai.ChatCompletion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, resp: resp, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
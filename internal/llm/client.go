@@ -2,29 +2,150 @@ package llm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/storage/schema"
 	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"golang.org/x/sync/singleflight"
 )
 
+// Tasks that can be routed to a dedicated model.
+const (
+	TaskClassify  = "classify"
+	TaskRunbook   = "runbook"
+	TaskSummarize = "summarize"
+)
+
+var tasks = []string{TaskClassify, TaskRunbook, TaskSummarize}
+
 type Config struct {
 	APIKey string `envconfig:"API_KEY"`
 	URL    string `default:"http://localhost:11434/v1/"`
 	Model  string `default:"qwen2.5:7b"`
+	// Per-task model overrides, e.g. "classify:qwen2.5:7b,runbook:gpt-4o". Tasks without an
+	// override use Model.
+	Models TaskModels
+	// Context window in tokens per model, e.g. "qwen2.5:7b:32768,gpt-4o:128000". Inputs that are
+	// sampled to fit, like channel history, are sized from it. Models not listed are assumed to
+	// have 8192.
+	ContextWindows ContextWindows `split_words:"true"`
+	// Upper bound on each LLM call, including retries, regardless of the caller's deadline.
+	Timeout time.Duration `default:"2m"`
+	// File every prompt and completion is appended to as NDJSON. Empty disables prompt logging.
+	PromptLog string `split_words:"true"`
+	// Directory of <name>.tmpl files overriding the built-in prompt templates of the same name.
+	PromptDir string `split_words:"true"`
+	// Sink receives every prompt and completion, taking precedence over PromptLog.
+	Sink PromptSink `ignored:"true"`
+	// Number of responses to cache for prompts that repeat, like classifying identical alert
+	// text. 0 disables the cache.
+	CacheSize int           `split_words:"true" default:"0"`
+	CacheTTL  time.Duration `split_words:"true" default:"1h"`
+	// Most chat completion requests in flight at once, so a single backend like Ollama isn't
+	// overwhelmed. Further requests wait for a slot. 0 means no limit.
+	MaxConcurrentRequests int `split_words:"true" default:"0"`
+	// How message text is sent: "plain" turns Slack's <@U123|alice> and <url|text> encodings
+	// into readable text, "mrkdwn" sends it as stored. Stored messages are never changed.
+	MessageFormat string `split_words:"true" default:"plain"`
+}
+
+// TaskModels maps tasks to model names. Unlike envconfig's map decoding, model names may contain ':'.
+type TaskModels map[string]string
+
+func (m *TaskModels) Decode(value string) error {
+	models := make(TaskModels)
+	for pair := range strings.SplitSeq(value, ",") {
+		task, model, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || task == "" || model == "" {
+			return fmt.Errorf("invalid task model %q, expected task:model", pair)
+		}
+		models[task] = model
+	}
+
+	*m = models
+	return nil
+}
+
+// Validate reports every problem with the configuration.
+func (cfg Config) Validate() error {
+	var errs []error
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("URL must be an http or https URL, got %q", cfg.URL))
+	}
+	if cfg.Model == "" {
+		errs = append(errs, fmt.Errorf("MODEL must be set"))
+	}
+	for task, model := range cfg.Models {
+		if !slices.Contains(tasks, task) {
+			errs = append(errs, fmt.Errorf("MODELS has unknown task %q, expected one of %s", task, strings.Join(tasks, ", ")))
+		}
+		if model == "" {
+			errs = append(errs, fmt.Errorf("MODELS has no model for task %q", task))
+		}
+	}
+	if cfg.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("TIMEOUT must not be negative, got %s", cfg.Timeout))
+	}
+	if cfg.MaxConcurrentRequests < 0 {
+		errs = append(errs, fmt.Errorf("MAX_CONCURRENT_REQUESTS must not be negative, got %d", cfg.MaxConcurrentRequests))
+	}
+	if cfg.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("CACHE_SIZE must not be negative, got %d", cfg.CacheSize))
+	}
+	if cfg.MessageFormat != MessageFormatPlain && cfg.MessageFormat != MessageFormatMrkdwn {
+		errs = append(errs, fmt.Errorf("MESSAGE_FORMAT must be %s or %s, got %q", MessageFormatPlain, MessageFormatMrkdwn, cfg.MessageFormat))
+	}
+	if cfg.CacheSize > 0 && cfg.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("CACHE_TTL must be positive when the cache is enabled, got %s", cfg.CacheTTL))
+	}
+
+	return errors.Join(errs...)
 }
 
 type Client struct {
-	client *openai.Client
-	model  string
+	client  *openai.Client
+	model   string
+	models  map[string]string
+	timeout time.Duration
+	metrics *usageMetrics
+	sink    PromptSink
+	// cache holds responses for calls that opt in with completeCached. Nil when disabled.
+	cache *responseCache
+	// slots bounds concurrent backend requests. Nil when unlimited.
+	slots chan struct{}
+	// prompts are the parsed prompt templates, built in or overridden from PromptDir.
+	prompts *template.Template
+	// contextWindows are the configured context windows by model name.
+	contextWindows ContextWindows
+	// messageFormat is how message text is sent, MessageFormatPlain unless configured otherwise.
+	messageFormat string
+
+	// inflight coalesces concurrent identical requests into a single backend call.
+	inflight singleflight.Group
 }
 
 func New(ctx context.Context, cfg Config) (*Client, error) {
+	// Checked even when the LLM is disabled, so a bad template fails at startup.
+	prompts, err := loadPrompts(cfg.PromptDir)
+	if err != nil {
+		return nil, err
+	}
+
 	if cfg.URL != "http://localhost:11434/v1/" && cfg.APIKey == "" {
 		return nil, nil
 	}
@@ -35,40 +156,216 @@ func New(ctx context.Context, cfg Config) (*Client, error) {
 		return nil, fmt.Errorf("getting model: %w", err)
 	}
 
+	models := make(map[string]string, len(cfg.Models))
+	for task, name := range cfg.Models {
+		if !slices.Contains(tasks, task) {
+			return nil, fmt.Errorf("unknown llm task %q", task)
+		}
+
+		taskModel, err := client.Models.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("getting model for task %s: %w", task, err)
+		}
+
+		models[task] = taskModel.ID
+	}
+
+	metrics, err := newUsageMetrics()
+	if err != nil {
+		return nil, fmt.Errorf("setting up metrics: %w", err)
+	}
+
+	sink := cfg.Sink
+	if sink == nil && cfg.PromptLog != "" {
+		if sink, err = NewNDJSONSink(cfg.PromptLog); err != nil {
+			return nil, err
+		}
+	}
+	if sink == nil {
+		sink = NopSink{}
+	}
+
+	var cache *responseCache
+	if cfg.CacheSize > 0 {
+		cache = newResponseCache(cfg.CacheSize, cfg.CacheTTL)
+	}
+
+	var slots chan struct{}
+	if cfg.MaxConcurrentRequests > 0 {
+		slots = make(chan struct{}, cfg.MaxConcurrentRequests)
+	}
+
 	return &Client{
-		client: client,
-		model:  model.ID,
+		client:         client,
+		model:          model.ID,
+		models:         models,
+		contextWindows: cfg.ContextWindows,
+		timeout:        cfg.Timeout,
+		metrics:        metrics,
+		sink:           sink,
+		cache:          cache,
+		slots:          slots,
+		prompts:        prompts,
+		messageFormat:  cfg.MessageFormat,
 	}, nil
 }
 
+// modelFor returns the model configured for task, falling back to the default model.
+func (c *Client) modelFor(task string) string {
+	if model, ok := c.models[task]; ok {
+		return model
+	}
+
+	return c.model
+}
+
+// complete sends a chat completion request for task and records its usage. Concurrent calls
+// with the same task and params share one request. It isn't cancelled with any one caller, only
+// by the client's timeout; each caller stops waiting for it when its own context is done.
+func (c *Client) complete(ctx context.Context, task string, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	key, err := requestKey(task, params)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := context.WithoutCancel(ctx)
+	results := c.inflight.DoChan(key, func() (any, error) {
+		return c.doComplete(shared, task, params)
+	})
+
+	select {
+	case res := <-results:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*openai.ChatCompletion), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// completeCached is complete for prompts whose answer only depends on the prompt, serving
+// repeats from the response cache when it is enabled.
+func (c *Client) completeCached(ctx context.Context, task string, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if c.cache == nil {
+		return c.complete(ctx, task, params)
+	}
+
+	key, err := requestKey(task, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp, ok := c.cache.get(key); ok {
+		return resp, nil
+	}
+
+	resp, err := c.complete(ctx, task, params)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.put(key, resp)
+	return resp, nil
+}
+
+// requestKey identifies a request by a hash of its task and full request body.
+func requestKey(task string, params openai.ChatCompletionNewParams) (string, error) {
+	body, err := params.MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("marshaling request: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(task))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Client) doComplete(ctx context.Context, task string, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a free LLM request slot: %w", ctx.Err())
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.client.Chat.Completions.New(ctx, params)
+
+	var promptTokens, completionTokens int64
+	if resp != nil {
+		promptTokens, completionTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+	}
+	c.metrics.record(ctx, params.Model.Value, task, promptTokens, completionTokens, err)
+	c.recordPrompt(ctx, start, task, params, resp, err)
+
+	if err == nil && len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	return resp, err
+}
+
+// recordPrompt hands the request and its outcome to the prompt sink.
+func (c *Client) recordPrompt(ctx context.Context, start time.Time, task string, params openai.ChatCompletionNewParams, resp *openai.ChatCompletion, err error) {
+	if _, ok := c.sink.(NopSink); ok {
+		return
+	}
+
+	request, marshalErr := params.MarshalJSON()
+	if marshalErr != nil {
+		slog.WarnContext(ctx, "failed to marshal prompt for sink", "error", marshalErr)
+		return
+	}
+
+	record := PromptRecord{
+		Time:      start,
+		Task:      task,
+		Model:     params.Model.Value,
+		Request:   request,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if resp != nil {
+		record.PromptTokens, record.CompletionTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+		if len(resp.Choices) > 0 {
+			record.Response = resp.Choices[0].Message.Content
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	c.sink.Record(ctx, record)
+}
+
 func (c *Client) GenerateChannelSuggestions(ctx context.Context, messages [][]string) (string, error) {
 	if c == nil {
 		return "", nil
 	}
 
-	prompt := `You are a technical analyst reviewing user support messages. Your task is to identify specific, actionable improvements based on the provided messages.
-
-	For each suggestion:
-	1. Focus only on concrete issues mentioned in the messages
-	2. Provide a clear, specific title that identifies the problem area
-	3. Include a single, concise bullet point explaining the proposed solution
-	4. Format in Slack-friendly markdown with each suggestion as a separate block
-
-	Rules:
-	- Maximum 3 suggestions
-	- Each suggestion must directly relate to issues in the messages
-	- No generic or speculative improvements
-	- Keep titles short and descriptive
-	- Bullet points should be 1-2 sentences maximum
-	- If no clear improvements can be identified, return "No specific improvements identified from these messages"
+	prompt, err := c.prompt(PromptSuggestions, nil)
+	if err != nil {
+		return "", err
+	}
 
-	Format each suggestion as:
-	*Title*
-	• Specific improvement details
-	`
+	texts := make([][]string, len(messages))
+	for i, thread := range messages {
+		for _, text := range thread {
+			texts[i] = append(texts[i], c.text(text))
+		}
+	}
 
 	params := openai.ChatCompletionNewParams{
-		Model: openai.F(openai.ChatModel(c.model)),
+		Model: openai.F(openai.ChatModel(c.modelFor(TaskSummarize))),
 		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
 			openai.ChatCompletionMessageParam{
 				Role:    openai.F(openai.ChatCompletionMessageParamRoleSystem),
@@ -76,13 +373,13 @@ func (c *Client) GenerateChannelSuggestions(ctx context.Context, messages [][]st
 			},
 			openai.ChatCompletionMessageParam{
 				Role:    openai.F(openai.ChatCompletionMessageParamRoleUser),
-				Content: openai.F(any(fmt.Sprintf("Messages:\n%s", messages))),
+				Content: openai.F(any(fmt.Sprintf("Messages:\n%s", texts))),
 			},
 		}),
 		Temperature: openai.F(0.7),
 	}
 
-	resp, err := c.client.Chat.Completions.New(ctx, params)
+	resp, err := c.complete(ctx, TaskSummarize, params)
 	if err != nil {
 		return "", fmt.Errorf("generating suggestions: %w", err)
 	}
@@ -97,21 +394,13 @@ func (c *Client) ClassifyService(ctx context.Context, text string, services []st
 		return "", nil
 	}
 
-	prompt := `You are a service classification assistant. Your task is to identify which service from the following list is being referenced in the user's message:
-
-Services: ` + strings.Join(services, ", ") + `
-
-Rules:
-- Return EXACTLY one service name from the list above
-- If no service matches, return "none"
-- Return ONLY the service name, no explanation
-- The response must match the exact spelling and case of the service name
-
-Message to classify:
-` + text
+	prompt, err := c.prompt(PromptClassify, classifyPrompt{Services: strings.Join(services, ", "), Message: c.text(text)})
+	if err != nil {
+		return "", err
+	}
 
 	params := openai.ChatCompletionNewParams{
-		Model: openai.F(openai.ChatModel(c.model)),
+		Model: openai.F(openai.ChatModel(c.modelFor(TaskClassify))),
 		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
 			openai.ChatCompletionMessageParam{
 				Role:    openai.F(openai.ChatCompletionMessageParamRoleSystem),
@@ -121,7 +410,7 @@ Message to classify:
 		Temperature: openai.F(0.0),
 	}
 
-	resp, err := c.client.Chat.Completions.New(ctx, params)
+	resp, err := c.completeCached(ctx, TaskClassify, params)
 	if err != nil {
 		return "", fmt.Errorf("classifying service: %w", err)
 	}
@@ -143,29 +432,27 @@ Message to classify:
 	return service, nil
 }
 
-func (c *Client) UpdateRunbook(ctx context.Context, runbook schema.IncidentRunbook, msg dto.MessageAttrs, threadMsgs []schema.ThreadMessagesV2) (string, error) {
+// UpdateRunbook writes the runbook for msg's alert from its thread, revising runbook if there is
+// one. The runbook is written in the language of locale, English if empty.
+func (c *Client) UpdateRunbook(ctx context.Context, runbook schema.IncidentRunbook, msg dto.MessageAttrs, threadMsgs []schema.ThreadMessagesV2, locale string) (string, error) {
 	if c == nil {
 		return "", nil
 	}
 
-	prompt := `You are a technical analyst creating or updating a runbook for an incident alert. Your task is to create a concise runbook based solely on the information provided in the messages.
-
-The runbook should have the following sections:
-1. Alert Description - Explain what this alert means and when it triggers, based on the messages
-2. Troubleshooting Steps - Document only the specific steps that were actually taken or suggested in the messages
-3. Historical Causes - Document only the causes derived from the messages
-
-Important:
-- Do not include generic advice or steps that weren't mentioned in the messages
-- Keep the content focused and specific to what was discussed
-- If certain information is not available in the messages, keep that section brief or note "No information available"
+	lang, err := languageName(locale)
+	if err != nil {
+		return "", err
+	}
 
-Format the response in Markdown with clear section headers.`
+	prompt, err := c.prompt(PromptRunbook, runbookPrompt{Language: lang})
+	if err != nil {
+		return "", err
+	}
 
 	allMsgs := make([]string, 0, len(threadMsgs)+1)
-	allMsgs = append(allMsgs, fmt.Sprintf("Initial incident message: %s", msg.Message.Text))
+	allMsgs = append(allMsgs, fmt.Sprintf("Initial incident message: %s", c.text(msg.Message.Text)))
 	for _, msg := range threadMsgs {
-		allMsgs = append(allMsgs, fmt.Sprintf("Thread message: %s", msg.Attrs.Message.Text))
+		allMsgs = append(allMsgs, fmt.Sprintf("Thread message: %s", c.text(msg.Attrs.Message.Text)))
 	}
 
 	allMsgsStr := strings.Join(allMsgs, "\n")
@@ -178,7 +465,7 @@ Format the response in Markdown with clear section headers.`
 	}
 
 	params := openai.ChatCompletionNewParams{
-		Model: openai.F(openai.ChatModel(c.model)),
+		Model: openai.F(openai.ChatModel(c.modelFor(TaskRunbook))),
 		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
 			openai.ChatCompletionMessageParam{
 				Role:    openai.F(openai.ChatCompletionMessageParamRoleSystem),
@@ -192,7 +479,7 @@ Format the response in Markdown with clear section headers.`
 		Temperature: openai.F(0.7),
 	}
 
-	resp, err := c.client.Chat.Completions.New(ctx, params)
+	resp, err := c.complete(ctx, TaskRunbook, params)
 	if err != nil {
 		return "", fmt.Errorf("updating runbook: %w", err)
 	}
@@ -201,3 +488,148 @@ Format the response in Markdown with clear section headers.`
 
 	return resp.Choices[0].Message.Content, nil
 }
+
+// SummarizeChannel writes a digest of msgs, grouped by incident or topic, for someone who was
+// away from the channel. Busy windows are sampled down to fit the model's context window. Each
+// point cites the messages it is based on as [n], linked to the message when permalink is set.
+func (c *Client) SummarizeChannel(ctx context.Context, msgs []schema.MessagesV2, permalink func(ts string) string) (string, error) {
+	if c == nil || len(msgs) == 0 {
+		return "", nil
+	}
+
+	prompt, err := c.prompt(PromptCatchUp, nil)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(msgs))
+	cited := make([]string, 0, len(msgs)) // ts of the message numbered i+1
+	for _, msg := range msgs {
+		if msg.Attrs.Message.Text == "" {
+			continue
+		}
+
+		cited = append(cited, msg.Ts)
+		var line strings.Builder
+		line.WriteString(fmt.Sprintf("[%d] ", len(cited)))
+		if t, err := internal.TsToTime(msg.Ts); err == nil {
+			line.WriteString(t.UTC().Format("2006-01-02 15:04") + " ")
+		}
+		if action := msg.Attrs.IncidentAction; action.Action != "" {
+			line.WriteString(fmt.Sprintf("[%s %s/%s] ", action.Action, action.Service, action.Alert))
+		}
+		line.WriteString(c.text(msg.Attrs.Message.Text))
+		lines = append(lines, line.String())
+	}
+
+	sampled := sampleToBudget(lines, c.inputBudget(TaskSummarize, prompt))
+	if len(sampled) < len(lines) {
+		slog.InfoContext(ctx, "sampled channel history to fit token budget", "messages", len(lines), "sampled", len(sampled))
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model: openai.F(openai.ChatModel(c.modelFor(TaskSummarize))),
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.ChatCompletionMessageParam{
+				Role:    openai.F(openai.ChatCompletionMessageParamRoleSystem),
+				Content: openai.F(any(prompt)),
+			},
+			openai.ChatCompletionMessageParam{
+				Role:    openai.F(openai.ChatCompletionMessageParamRoleUser),
+				Content: openai.F(any("Messages:\n" + strings.Join(sampled, "\n"))),
+			},
+		}),
+		Temperature: openai.F(0.3),
+	}
+
+	resp, err := c.complete(ctx, TaskSummarize, params)
+	if err != nil {
+		return "", fmt.Errorf("summarizing channel: %w", err)
+	}
+
+	slog.DebugContext(ctx, "summarized channel", "request", params, "response", resp.Choices[0].Message.Content)
+
+	return linkCitations(resp.Choices[0].Message.Content, cited, permalink), nil
+}
+
+var citation = regexp.MustCompile(`\[(\d+)\]`)
+
+// linkCitations turns [n] citations of the n-th of cited messages into Slack links to them.
+// Citations of messages that don't exist are left as they are.
+func linkCitations(text string, cited []string, permalink func(ts string) string) string {
+	if permalink == nil {
+		return text
+	}
+
+	return citation.ReplaceAllStringFunc(text, func(ref string) string {
+		n, err := strconv.Atoi(ref[1 : len(ref)-1])
+		if err != nil || n < 1 || n > len(cited) {
+			return ref
+		}
+
+		return fmt.Sprintf("<%s|%s>", permalink(cited[n-1]), ref)
+	})
+}
+
+type resolution struct {
+	Resolved     bool   `json:"resolved"`
+	MessageIndex int    `json:"message_index"`
+	Confidence   string `json:"confidence"`
+}
+
+// DetectResolution asks the LLM whether the thread of an open incident shows that it was resolved.
+// Only confident answers count as resolved. The returned index points at the thread message
+// where the resolution happened.
+func (c *Client) DetectResolution(ctx context.Context, msg dto.MessageAttrs, threadMsgs []schema.ThreadMessagesV2) (int, bool, error) {
+	if c == nil || len(threadMsgs) == 0 {
+		return 0, false, nil
+	}
+
+	prompt, err := c.prompt(PromptResolution, nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("Incident alert: %s\n\nReplies:\n", c.text(msg.Message.Text)))
+	for i, threadMsg := range threadMsgs {
+		content.WriteString(fmt.Sprintf("%d. %s\n", i, c.text(threadMsg.Attrs.Message.Text)))
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model: openai.F(openai.ChatModel(c.modelFor(TaskClassify))),
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.ChatCompletionMessageParam{
+				Role:    openai.F(openai.ChatCompletionMessageParamRoleSystem),
+				Content: openai.F(any(prompt)),
+			},
+			openai.ChatCompletionMessageParam{
+				Role:    openai.F(openai.ChatCompletionMessageParamRoleUser),
+				Content: openai.F(any(content.String())),
+			},
+		}),
+		Temperature: openai.F(0.0),
+	}
+
+	resp, err := c.complete(ctx, TaskClassify, params)
+	if err != nil {
+		return 0, false, fmt.Errorf("detecting resolution: %w", err)
+	}
+
+	slog.DebugContext(ctx, "detected resolution", "request", params, "response", resp.Choices[0].Message.Content)
+
+	raw := strings.TrimSpace(resp.Choices[0].Message.Content)
+	raw = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(raw, "```json"), "```"), "```")
+
+	var r resolution
+	if err := json.Unmarshal([]byte(raw), &r); err != nil {
+		slog.WarnContext(ctx, "llm returned invalid resolution", "response", raw, "error", err)
+		return 0, false, nil
+	}
+
+	if !r.Resolved || r.Confidence != "high" || r.MessageIndex < 0 || r.MessageIndex >= len(threadMsgs) {
+		return 0, false, nil
+	}
+
+	return r.MessageIndex, true, nil
+}
@@ -1,9 +1,29 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/openai/openai-go"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
 )
 
 func TestClassifyService(t *testing.T) {
@@ -55,3 +75,513 @@ func TestClassifyService(t *testing.T) {
 		})
 	}
 }
+
+// newFakeClient returns a client backed by a fake OpenAI-compatible server that answers every
+// chat completion with the content returned by reply.
+func newFakeClient(t *testing.T, cfg Config, reply func(r *http.Request) string) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/models/"):
+			_, _ = fmt.Fprintf(w, `{"id":%q,"object":"model"}`, strings.TrimPrefix(r.URL.Path, "/models/"))
+		case r.URL.Path == "/chat/completions":
+			content, _ := json.Marshal(reply(r))
+			_, _ = fmt.Fprintf(w, `{"id":"1","object":"chat.completion","model":"test-model","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":%s}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg.URL, cfg.APIKey = srv.URL+"/", "test"
+	if cfg.Model == "" {
+		cfg.Model = "test-model"
+	}
+
+	client, err := New(t.Context(), cfg)
+	require.NoError(t, err)
+	return client
+}
+
+func TestDetectResolution(t *testing.T) {
+	responses := map[string]string{
+		"fixed, closing out":        `{"resolved": true, "message_index": 1, "confidence": "high"}`,
+		"looking into it, not sure": `{"resolved": true, "message_index": 1, "confidence": "low"}`,
+	}
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		body, _ := io.ReadAll(r.Body)
+		for text, response := range responses {
+			if strings.Contains(string(body), text) {
+				return response
+			}
+		}
+		return `{"resolved": false}`
+	})
+
+	for text, wantResolved := range map[string]bool{
+		"fixed, closing out":        true,
+		"looking into it, not sure": false,
+	} {
+		t.Run(text, func(t *testing.T) {
+			threadMsgs := []schema.ThreadMessagesV2{
+				{Ts: "2.000000", Attrs: dto.ThreadMessageAttrs{Message: dto.SlackMessage{Text: "investigating"}}},
+				{Ts: "3.000000", Attrs: dto.ThreadMessageAttrs{Message: dto.SlackMessage{Text: text}}},
+			}
+
+			idx, resolved, err := client.DetectResolution(t.Context(), dto.MessageAttrs{}, threadMsgs)
+			require.NoError(t, err)
+			require.Equal(t, wantResolved, resolved)
+			if wantResolved {
+				require.Equal(t, 1, idx)
+			}
+		})
+	}
+}
+
+func TestSummarizeChannel(t *testing.T) {
+	var prompt string
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		prompt = body.Messages[len(body.Messages)-1].Content
+		return "*payments HighLatency*\n• Opened and resolved after a deploy rollback [1][2]\n• Unrelated [9999]"
+	})
+
+	msgs := []schema.MessagesV2{{
+		Ts: "1704067200.000000",
+		Attrs: dto.MessageAttrs{
+			Message:        dto.SlackMessage{Text: "checkout latency is high"},
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "HighLatency"},
+		},
+	}}
+	for i := range 2000 {
+		msgs = append(msgs, schema.MessagesV2{
+			Ts:    fmt.Sprintf("%d.000000", 1704067260+i*60),
+			Attrs: dto.MessageAttrs{Message: dto.SlackMessage{Text: fmt.Sprintf("chatter message number %d", i)}},
+		})
+	}
+
+	permalink := func(ts string) string {
+		return "https://example.slack.com/archives/C1/p" + strings.ReplaceAll(ts, ".", "")
+	}
+	summary, err := client.SummarizeChannel(t.Context(), msgs, permalink)
+	require.NoError(t, err)
+	require.Contains(t, summary, "payments HighLatency")
+	require.Contains(t, summary, "rollback <https://example.slack.com/archives/C1/p1704067200000000|[1]><https://example.slack.com/archives/C1/p1704067260000000|[2]>")
+	require.Contains(t, summary, "Unrelated [9999]")
+	require.Contains(t, prompt, "[1] 2024-01-01 00:00 [open_incident payments/HighLatency] checkout latency is high")
+	require.LessOrEqual(t, approxTokens(prompt), defaultContextWindow-completionReserve)
+	require.NotContains(t, prompt, "chatter message number 0\n")
+}
+
+func TestContextWindowSizesBudget(t *testing.T) {
+	var windows ContextWindows
+	require.NoError(t, windows.Decode("test-model:4096, qwen2.5:7b:32768"))
+	require.Equal(t, ContextWindows{"test-model": 4096, "qwen2.5:7b": 32768}, windows)
+	require.Error(t, windows.Decode("test-model"))
+	require.Error(t, windows.Decode("test-model:100"))
+
+	var prompt string
+	client := newFakeClient(t, Config{ContextWindows: ContextWindows{"test-model": 4096}}, func(r *http.Request) string {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		prompt = body.Messages[len(body.Messages)-1].Content
+		return "summary"
+	})
+	require.Equal(t, 4096-completionReserve-approxTokens("system prompt"), client.inputBudget(TaskSummarize, "system prompt"))
+
+	var msgs []schema.MessagesV2
+	for i := range 2000 {
+		msgs = append(msgs, schema.MessagesV2{
+			Ts:    fmt.Sprintf("%d.000000", 1704067260+i*60),
+			Attrs: dto.MessageAttrs{Message: dto.SlackMessage{Text: fmt.Sprintf("chatter message number %d", i)}},
+		})
+	}
+
+	_, err := client.SummarizeChannel(t.Context(), msgs, nil)
+	require.NoError(t, err)
+	require.LessOrEqual(t, approxTokens(prompt), 4096-completionReserve)
+	require.Greater(t, approxTokens(prompt), 1000)
+
+	// Models without a configured window get the default.
+	client.contextWindows = nil
+	require.Equal(t, defaultContextWindow-completionReserve, client.inputBudget(TaskSummarize, ""))
+}
+
+func TestPlainText(t *testing.T) {
+	text := "<!here> <@U123|alice> and <@U456> paged <!subteam^S789|@oncall> in <#C1|payments>: " +
+		"see <https://grafana.example.com/d/1|the dashboard> or <https://status.example.com>, mail <mailto:sre@example.com|sre@example.com> &lt;urgent&gt; &amp; ok"
+	require.Equal(t, "@here @alice and @U456 paged @oncall in #payments: "+
+		"see the dashboard (https://grafana.example.com/d/1) or https://status.example.com, mail sre@example.com <urgent> & ok", plainText(text))
+
+	var prompt string
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		prompt = body.Messages[len(body.Messages)-1].Content
+		return "runbook"
+	})
+	msg := dto.MessageAttrs{Message: dto.SlackMessage{Text: "<@U123|alice> is looking at <https://grafana.example.com/d/1|latency>"}}
+
+	_, err := client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, msg, nil, "")
+	require.NoError(t, err)
+	require.Contains(t, prompt, "@alice is looking at latency (https://grafana.example.com/d/1)")
+
+	client.messageFormat = MessageFormatMrkdwn
+	_, err = client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, msg, nil, "")
+	require.NoError(t, err)
+	require.Contains(t, prompt, msg.Message.Text)
+}
+
+func TestSampleToBudget(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"}
+	require.Equal(t, lines, sampleToBudget(lines, 5))
+	require.Equal(t, []string{"aaaa", "cccc", "eeee"}, sampleToBudget(lines, 3))
+	require.Equal(t, []string{"aaaa"}, sampleToBudget(lines, 1))
+	require.Empty(t, sampleToBudget(lines, 0))
+}
+
+func TestPromptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.ndjson")
+	client := newFakeClient(t, Config{PromptLog: path}, func(r *http.Request) string { return "svc" })
+
+	_, err := client.ClassifyService(t.Context(), "payments are down", []string{"svc"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+
+	var record PromptRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	require.Equal(t, TaskClassify, record.Task)
+	require.Equal(t, "test-model", record.Model)
+	require.Contains(t, string(record.Request), "payments are down")
+	require.Equal(t, "svc", record.Response)
+	require.Equal(t, int64(10), record.PromptTokens)
+	require.Equal(t, int64(5), record.CompletionTokens)
+}
+
+func TestPromptDirOverridesRunbookPrompt(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "runbook.tmpl"), []byte("Write a runbook in the team's house style.\n"), 0o600))
+
+	var system string
+	client := newFakeClient(t, Config{PromptDir: dir}, func(r *http.Request) string {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		system = body.Messages[0].Content
+		return "runbook"
+	})
+
+	_, err := client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, "Write a runbook in the team's house style.", system)
+
+	// Other prompts keep their built-in defaults.
+	_, err = client.ClassifyService(t.Context(), "checkout is slow", []string{"payments"})
+	require.NoError(t, err)
+	require.Contains(t, system, "Services: payments")
+	require.True(t, strings.HasSuffix(system, "Message to classify:\ncheckout is slow"), system)
+}
+
+func TestUpdateRunbookLanguage(t *testing.T) {
+	var system string
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		system = body.Messages[0].Content
+		return "runbook"
+	})
+
+	_, err := client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, "ja")
+	require.NoError(t, err)
+	require.Contains(t, system, "Write the runbook in Japanese.")
+	require.Contains(t, system, "untranslated")
+
+	for _, locale := range []string{"", "en-GB"} {
+		_, err = client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, locale)
+		require.NoError(t, err)
+		require.NotContains(t, system, "Write the runbook in")
+	}
+
+	_, err = client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, "not a locale")
+	require.Error(t, err)
+}
+
+func TestRunbookLocale(t *testing.T) {
+	for locale, want := range map[string]string{
+		"":      "",
+		"en":    "",
+		"en-GB": "",
+		"ja":    "ja",
+		"pt-br": "pt-BR",
+	} {
+		require.Equal(t, want, RunbookLocale(locale), locale)
+	}
+}
+
+func TestLoadPromptsRejectsBadTemplates(t *testing.T) {
+	_, err := loadPrompts("")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "runbok.tmpl"), []byte("typo"), 0o600))
+	_, err = loadPrompts(dir)
+	require.ErrorContains(t, err, `unknown prompt "runbok.tmpl"`)
+
+	dir = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "classify.tmpl"), []byte("{{.Services"), 0o600))
+	_, err = loadPrompts(dir)
+	require.ErrorContains(t, err, "parsing prompt classify")
+}
+
+func TestTaskModelRouting(t *testing.T) {
+	var gotModel string
+	client := newFakeClient(t, Config{
+		Model:  "default-model",
+		Models: TaskModels{TaskRunbook: "runbook-model"},
+	}, func(r *http.Request) string {
+		var req struct {
+			Model string `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		gotModel = req.Model
+		return "ok"
+	})
+
+	_, err := client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, "runbook-model", gotModel)
+
+	_, err = client.ClassifyService(t.Context(), "text", []string{"svc"})
+	require.NoError(t, err)
+	require.Equal(t, "default-model", gotModel)
+}
+
+func TestTaskModelsDecode(t *testing.T) {
+	var models TaskModels
+	require.NoError(t, models.Decode("classify:qwen2.5:7b,runbook:gpt-4o"))
+	require.Equal(t, TaskModels{TaskClassify: "qwen2.5:7b", TaskRunbook: "gpt-4o"}, models)
+	require.Error(t, models.Decode("classify"))
+}
+
+func TestUsageMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	client := newFakeClient(t, Config{}, func(r *http.Request) string { return "svc" })
+	_, err := client.ClassifyService(t.Context(), "text", []string{"svc"})
+	require.NoError(t, err)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(t.Context(), &rm))
+
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				got[m.Name] += dp.Value
+			}
+		}
+	}
+	require.Equal(t, map[string]int64{
+		"llm.requests":          1,
+		"llm.prompt_tokens":     10,
+		"llm.completion_tokens": 5,
+	}, got)
+}
+
+func TestResponseCache(t *testing.T) {
+	var hits atomic.Int32
+	client := newFakeClient(t, Config{CacheSize: 10, CacheTTL: time.Hour}, func(r *http.Request) string {
+		hits.Add(1)
+		return "svc"
+	})
+
+	for range 2 {
+		service, err := client.ClassifyService(t.Context(), "payments are down", []string{"svc"})
+		require.NoError(t, err)
+		require.Equal(t, "svc", service)
+	}
+	require.Equal(t, int32(1), hits.Load())
+
+	_, err := client.ClassifyService(t.Context(), "search is slow", []string{"svc"})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), hits.Load())
+
+	// Runbooks are not cached.
+	for range 2 {
+		_, err := client.UpdateRunbook(t.Context(), schema.IncidentRunbook{}, dto.MessageAttrs{}, nil, "")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(4), hits.Load())
+}
+
+func TestResponseCacheEvictsAndExpires(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newResponseCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", &openai.ChatCompletion{ID: "a"})
+	cache.put("b", &openai.ChatCompletion{ID: "b"})
+	_, ok := cache.get("a")
+	require.True(t, ok)
+	cache.put("c", &openai.ChatCompletion{ID: "c"})
+
+	_, ok = cache.get("b")
+	require.False(t, ok, "least recently used entry is evicted")
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("a")
+	require.False(t, ok, "entries expire after the ttl")
+}
+
+func TestConcurrentIdenticalRequestsCoalesced(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		hits.Add(1)
+		<-release
+		return "payments"
+	})
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]string, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service, err := client.ClassifyService(t.Context(), "payments are failing", []string{"payments", "search"})
+			require.NoError(t, err)
+			results[i] = service
+		}()
+	}
+
+	// Give every caller time to join the in-flight request before the backend replies.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), hits.Load())
+	for _, service := range results {
+		require.Equal(t, "payments", service)
+	}
+
+	// Distinct inputs are not coalesced.
+	_, err := client.ClassifyService(t.Context(), "search is slow", []string{"payments", "search"})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), hits.Load())
+}
+
+func TestCoalescedRequestSurvivesCancelledCaller(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	client := newFakeClient(t, Config{}, func(r *http.Request) string {
+		hits.Add(1)
+		<-release
+		return "payments"
+	})
+
+	// The first caller starts the shared request, then gives up on it.
+	ctx, cancel := context.WithCancel(t.Context())
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.ClassifyService(ctx, "payments are failing", []string{"payments", "search"})
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	const n = 5
+	var wg sync.WaitGroup
+	results := make([]string, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = client.ClassifyService(t.Context(), "payments are failing", []string{"payments", "search"})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), hits.Load())
+	for i := range n {
+		require.NoError(t, errs[i])
+		require.Equal(t, "payments", results[i])
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	var inflight, peak atomic.Int32
+	client := newFakeClient(t, Config{MaxConcurrentRequests: 2}, func(r *http.Request) string {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return "svc"
+	})
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ClassifyService(t.Context(), fmt.Sprintf("message %d", i), []string{"svc"})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(2), peak.Load())
+}
+
+func TestTimeout(t *testing.T) {
+	client := newFakeClient(t, Config{Timeout: 50 * time.Millisecond}, func(r *http.Request) string {
+		// The server only notices the client going away once the body has been read.
+		_, _ = io.ReadAll(r.Body)
+		<-r.Context().Done()
+		return "payments"
+	})
+
+	start := time.Now()
+	_, err := client.ClassifyService(t.Context(), "payments are failing", []string{"payments"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/dynoinc/ratchet/internal/llm"
+
+// usageMetrics counts LLM requests and token usage per model and task.
+type usageMetrics struct {
+	requests         metric.Int64Counter
+	promptTokens     metric.Int64Counter
+	completionTokens metric.Int64Counter
+}
+
+func newUsageMetrics() (*usageMetrics, error) {
+	meter := otel.Meter(meterName)
+
+	requests, err := meter.Int64Counter("llm.requests", metric.WithDescription("Number of LLM requests"))
+	if err != nil {
+		return nil, fmt.Errorf("creating requests counter: %w", err)
+	}
+
+	promptTokens, err := meter.Int64Counter("llm.prompt_tokens", metric.WithDescription("Number of prompt tokens sent to the LLM"))
+	if err != nil {
+		return nil, fmt.Errorf("creating prompt tokens counter: %w", err)
+	}
+
+	completionTokens, err := meter.Int64Counter("llm.completion_tokens", metric.WithDescription("Number of completion tokens returned by the LLM"))
+	if err != nil {
+		return nil, fmt.Errorf("creating completion tokens counter: %w", err)
+	}
+
+	return &usageMetrics{
+		requests:         requests,
+		promptTokens:     promptTokens,
+		completionTokens: completionTokens,
+	}, nil
+}
+
+func (m *usageMetrics) record(ctx context.Context, model, task string, promptTokens, completionTokens int64, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("task", task),
+	)
+	m.requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("task", task),
+		attribute.String("status", status),
+	))
+	m.promptTokens.Add(ctx, promptTokens, attrs)
+	m.completionTokens.Add(ctx, completionTokens, attrs)
+}
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Formats message text can be sent to the LLM in.
+const (
+	// MessageFormatPlain converts Slack's encodings of mentions and links to readable text.
+	MessageFormatPlain = "plain"
+	// MessageFormatMrkdwn sends message text as stored, in Slack's mrkdwn encoding.
+	MessageFormatMrkdwn = "mrkdwn"
+)
+
+// slackEntity matches Slack's <...> encodings of mentions, channels, special mentions and links.
+var slackEntity = regexp.MustCompile(`<([^<>]+)>`)
+
+// htmlEscapes are the only characters Slack escapes in message text.
+var htmlEscapes = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// plainText converts Slack mrkdwn encodings to plain text: <@U123|alice> becomes @alice,
+// <#C123|general> becomes #general, <!here> becomes @here and <https://x|docs> becomes
+// "docs (https://x)". Mentions without a label keep their ID, as in @U123.
+func plainText(text string) string {
+	text = slackEntity.ReplaceAllStringFunc(text, func(entity string) string {
+		target, label, hasLabel := strings.Cut(entity[1:len(entity)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			return "@" + cmp.Or(label, target[1:])
+		case strings.HasPrefix(target, "#"):
+			return "#" + cmp.Or(label, target[1:])
+		case strings.HasPrefix(target, "!subteam^"):
+			return cmp.Or(label, "@"+strings.TrimPrefix(target, "!subteam^"))
+		case strings.HasPrefix(target, "!date^"):
+			return label
+		case strings.HasPrefix(target, "!"):
+			return "@" + target[1:]
+		case strings.HasPrefix(target, "mailto:"):
+			return cmp.Or(label, strings.TrimPrefix(target, "mailto:"))
+		case hasLabel && label != target:
+			return fmt.Sprintf("%s (%s)", label, target)
+		default:
+			return target
+		}
+	})
+
+	return htmlEscapes.Replace(text)
+}
+
+// text returns message text in the configured message format.
+func (c *Client) text(text string) string {
+	if c.messageFormat == MessageFormatMrkdwn {
+		return text
+	}
+	return plainText(text)
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Names of the prompt templates, one per file in prompts/ named <name>.tmpl.
+const (
+	PromptSuggestions = "suggestions"
+	PromptClassify    = "classify"
+	PromptRunbook     = "runbook"
+	PromptResolution  = "resolution"
+	PromptCatchUp     = "catch_up"
+)
+
+var promptNames = []string{PromptSuggestions, PromptClassify, PromptRunbook, PromptResolution, PromptCatchUp}
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// classifyPrompt is the data the classify template renders.
+type classifyPrompt struct {
+	Services string
+	Message  string
+}
+
+// runbookPrompt is the data the runbook template renders.
+type runbookPrompt struct {
+	// English name of the language to write the runbook in, or empty for English.
+	Language string
+}
+
+// ValidateLocale checks that locale is a BCP 47 language tag, like "ja" or "pt-BR".
+func ValidateLocale(locale string) error {
+	_, err := languageName(locale)
+	return err
+}
+
+// RunbookLocale returns the locale runbooks for incidents in a channel with locale are stored
+// under: the canonical form of the tag, or "" for English and no locale.
+func RunbookLocale(locale string) string {
+	if locale == "" {
+		return ""
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return locale
+	}
+	if base, _ := tag.Base(); base.String() == "en" {
+		return ""
+	}
+
+	return tag.String()
+}
+
+// languageName returns the English name of locale's language, or "" for English and no locale.
+func languageName(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("invalid locale %q: %w", locale, err)
+	}
+	if base, _ := tag.Base(); base.String() == "en" {
+		return "", nil
+	}
+
+	return display.English.Tags().Name(tag), nil
+}
+
+// loadPrompts parses the embedded prompt templates, replacing any that have a <name>.tmpl
+// override in dir. Files in dir that don't name a prompt are an error, to catch typos.
+func loadPrompts(dir string) (*template.Template, error) {
+	overrides := make(map[string]string)
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading prompt dir: %w", err)
+		}
+
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), ".tmpl")
+			if entry.IsDir() || !ok {
+				continue
+			}
+			if !slices.Contains(promptNames, name) {
+				return nil, fmt.Errorf("unknown prompt %q in %s, expected one of %s", entry.Name(), dir, strings.Join(promptNames, ", "))
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("reading prompt %s: %w", name, err)
+			}
+			overrides[name] = string(data)
+		}
+	}
+
+	prompts := template.New("prompts").Option("missingkey=error")
+	for _, name := range promptNames {
+		text, ok := overrides[name]
+		if !ok {
+			data, err := defaultPrompts.ReadFile("prompts/" + name + ".tmpl")
+			if err != nil {
+				return nil, fmt.Errorf("reading default prompt %s: %w", name, err)
+			}
+			text = string(data)
+		}
+
+		if _, err := prompts.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("parsing prompt %s: %w", name, err)
+		}
+	}
+
+	return prompts, nil
+}
+
+// prompt renders the named prompt template with data.
+func (c *Client) prompt(name string, data any) (string, error) {
+	var prompt strings.Builder
+	if err := c.prompts.ExecuteTemplate(&prompt, name, data); err != nil {
+		return "", fmt.Errorf("rendering %s prompt: %w", name, err)
+	}
+
+	return strings.TrimSpace(prompt.String()), nil
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// PromptRecord is a single chat completion request and its outcome.
+type PromptRecord struct {
+	Time             time.Time       `json:"time"`
+	Task             string          `json:"task"`
+	Model            string          `json:"model"`
+	Request          json.RawMessage `json:"request"`
+	Response         string          `json:"response,omitzero"`
+	PromptTokens     int64           `json:"prompt_tokens"`
+	CompletionTokens int64           `json:"completion_tokens"`
+	LatencyMS        int64           `json:"latency_ms"`
+	Error            string          `json:"error,omitzero"`
+}
+
+// PromptSink receives a record of every chat completion the client makes. Record is called
+// synchronously from the request path, so sinks should be cheap and must be safe for
+// concurrent use.
+type PromptSink interface {
+	Record(ctx context.Context, record PromptRecord)
+}
+
+// NopSink discards every record.
+type NopSink struct{}
+
+func (NopSink) Record(context.Context, PromptRecord) {}
+
+// NDJSONSink appends records to a file, one JSON object per line.
+type NDJSONSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewNDJSONSink opens path for appending, creating it if needed.
+func NewNDJSONSink(path string) (*NDJSONSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening prompt log: %w", err)
+	}
+
+	return &NDJSONSink{file: file}, nil
+}
+
+func (s *NDJSONSink) Record(ctx context.Context, record PromptRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to marshal prompt record", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		slog.WarnContext(ctx, "failed to write prompt record", "error", err)
+	}
+}
+
+// Close closes the underlying file.
+func (s *NDJSONSink) Close() error {
+	return s.file.Close()
+}
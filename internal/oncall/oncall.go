@@ -0,0 +1,36 @@
+// Package oncall resolves who is currently on call for a service.
+package oncall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Provider returns the current on-call for service, as a Slack user ID or an email address. It
+// returns "" if nobody is on call for the service.
+type Provider interface {
+	OnCall(ctx context.Context, service string) (string, error)
+}
+
+// Static maps services to a fixed on-call. It decodes from "service:user,..." where user is a
+// Slack user ID or an email address.
+type Static map[string]string
+
+func (s *Static) Decode(value string) error {
+	static := make(Static)
+	for pair := range strings.SplitSeq(value, ",") {
+		service, user, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || service == "" || user == "" {
+			return fmt.Errorf("invalid on-call %q, expected service:user", pair)
+		}
+		static[service] = user
+	}
+
+	*s = static
+	return nil
+}
+
+func (s Static) OnCall(_ context.Context, service string) (string, error) {
+	return s[service], nil
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+const redactedText = "[REDACTED]"
+
+// Common secret formats that are always redacted.
+var defaultRedactPatterns = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`\bxox[abprs]-[0-9A-Za-z-]{10,}`,
+	`\bgh[pousr]_[0-9A-Za-z]{36,}\b`,
+	`\bgithub_pat_[0-9A-Za-z_]{22,}\b`,
+	`\bsk-[0-9A-Za-z_-]{20,}`,
+	`(?i)\bbearer\s+[0-9A-Za-z\-._~+/]{16,}=*`,
+	// key=value and key: value pairs, only for keys that name a secret (e.g. client_secret,
+	// DB_PASSWORD), so ordinary pairs like status=ok are kept.
+	`(?i)\b[\w-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key)\s*[:=]\s*\S+`,
+}
+
+// Redactor replaces secrets in message text before it is stored.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a redactor for the default secret formats plus extra, if set.
+func NewRedactor(extra string) (*Redactor, error) {
+	patterns := defaultRedactPatterns
+	if extra != "" {
+		patterns = append(patterns[:len(patterns):len(patterns)], extra)
+	}
+
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// RedactMessage redacts msg's text in place and flags it if anything was replaced.
+func (r *Redactor) RedactMessage(msg *dto.SlackMessage) {
+	if r == nil || msg.Text == "" {
+		return
+	}
+
+	text := msg.Text
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, redactedText)
+	}
+
+	if text != msg.Text {
+		msg.Text = text
+		msg.Redacted = true
+	}
+}
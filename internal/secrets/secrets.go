@@ -0,0 +1,99 @@
+// Package secrets resolves config values that reference secrets kept outside the environment,
+// like "file:///run/secrets/slack-bot-token" or "vault://secret/data/ratchet#slack_bot_token".
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Provider returns the secret at ref, the part of a reference after "scheme://". A "#key"
+// suffix selects one field of a secret that holds several.
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver resolves references by their scheme. Values without a scheme are used as is.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver returns a resolver for env:// and file:// references, and vault:// references
+// when VAULT_ADDR is set.
+func NewResolver() *Resolver {
+	r := &Resolver{providers: make(map[string]Provider)}
+	r.Register("env", Env{})
+	r.Register("file", File{})
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		r.Register("vault", NewVault(addr, os.Getenv("VAULT_TOKEN")))
+	}
+	return r
+}
+
+// Register makes references with scheme resolve through p, replacing any previous provider.
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Resolve returns the secret value references, or value itself if it isn't a reference.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, " \t\n") {
+		return value, nil
+	}
+
+	p, ok := r.providers[scheme]
+	if !ok {
+		return "", fmt.Errorf("no secret provider for %s:// references", scheme)
+	}
+
+	secret, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s:// secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// Env resolves "env://NAME" to the value of the environment variable NAME.
+type Env struct{}
+
+func (Env) Resolve(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// File resolves "file:///path" to the contents of the file, without the trailing newline.
+// "file:///path#key" reads key from a file holding a JSON object.
+type File struct{}
+
+func (File) Resolve(_ context.Context, ref string) (string, error) {
+	path, key, _ := strings.Cut(ref, "#")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if key == "" {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return field(fields, key)
+}
+
+func field(fields map[string]string, key string) (string, error) {
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("no field %q in secret", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveFileReference(t *testing.T) {
+	dir := t.TempDir()
+	token := filepath.Join(dir, "slack-bot-token")
+	require.NoError(t, os.WriteFile(token, []byte("xoxb-secret\n"), 0o600))
+	bundle := filepath.Join(dir, "ratchet.json")
+	require.NoError(t, os.WriteFile(bundle, []byte(`{"api_key": "sk-secret"}`), 0o600))
+
+	r := NewResolver()
+
+	value, err := r.Resolve(t.Context(), "file://"+token)
+	require.NoError(t, err)
+	require.Equal(t, "xoxb-secret", value)
+
+	value, err = r.Resolve(t.Context(), "file://"+bundle+"#api_key")
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", value)
+
+	_, err = r.Resolve(t.Context(), "file://"+filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	value, err = r.Resolve(t.Context(), "xoxb-inline")
+	require.NoError(t, err)
+	require.Equal(t, "xoxb-inline", value)
+
+	_, err = r.Resolve(t.Context(), "unknown://secret")
+	require.ErrorContains(t, err, "no secret provider")
+}
+
+func TestResolveVaultReference(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/secret/data/ratchet", r.URL.Path)
+		require.Equal(t, "root", r.Header.Get("X-Vault-Token"))
+		_, _ = w.Write([]byte(`{"data": {"data": {"slack_bot_token": "xoxb-vault"}, "metadata": {"version": 3}}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	r := NewResolver()
+	r.Register("vault", NewVault(srv.URL, "root"))
+
+	value, err := r.Resolve(t.Context(), "vault://secret/data/ratchet#slack_bot_token")
+	require.NoError(t, err)
+	require.Equal(t, "xoxb-vault", value)
+
+	_, err = r.Resolve(t.Context(), "vault://secret/data/ratchet#missing")
+	require.Error(t, err)
+}
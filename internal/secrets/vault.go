@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Vault resolves "vault://path#key" by reading path over Vault's HTTP API. Both KV version 1
+// and 2 secret engines are supported; for version 2 the path includes "data/".
+type Vault struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewVault(addr, token string) *Vault {
+	return &Vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: http.DefaultClient,
+	}
+}
+
+func (v *Vault) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", fmt.Errorf("vault reference %q needs a #key", ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	// KV version 2 nests the secret under data.data, next to its metadata.
+	var kv2 struct {
+		Data     map[string]string `json:"data"`
+		Metadata json.RawMessage   `json:"metadata"`
+	}
+	if err := json.Unmarshal(body.Data, &kv2); err == nil && kv2.Metadata != nil {
+		return field(kv2.Data, key)
+	}
+
+	var kv1 map[string]string
+	if err := json.Unmarshal(body.Data, &kv1); err != nil {
+		return "", fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return field(kv1, key)
+}
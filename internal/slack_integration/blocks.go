@@ -0,0 +1,162 @@
+package slack_integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+// Block Kit limits.
+const (
+	// SectionTextLimit is the most text Slack accepts in a single section block.
+	SectionTextLimit = 3000
+	// MaxBlocksPerMessage is the most blocks Slack accepts in a single message.
+	MaxBlocksPerMessage = 50
+
+	headerTextLimit = 150
+)
+
+// MarkdownBlocks renders mrkdwn text as Block Kit blocks: "#" headings become header blocks,
+// "---" rules become dividers, and code blocks and lists get sections of their own. Sections
+// longer than SectionTextLimit are split.
+func MarkdownBlocks(text string) []slack.Block {
+	var blocks []slack.Block
+	var current strings.Builder
+	inCode, inList := false, false
+	flush := func() {
+		body := strings.Trim(current.String(), "\n")
+		current.Reset()
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+
+		for _, part := range SplitMessage(body, SectionTextLimit) {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, part, false, false), nil, nil))
+		}
+	}
+
+	for line := range strings.Lines(text) {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, codeFence) {
+			if !inCode {
+				flush()
+				inList = false
+			}
+			current.WriteString(line)
+			inCode = !inCode
+			if !inCode {
+				flush()
+			}
+			continue
+		}
+		if inCode {
+			current.WriteString(line)
+			continue
+		}
+
+		switch {
+		case isRule(trimmed):
+			flush()
+			blocks = append(blocks, slack.NewDividerBlock())
+			inList = false
+		case isHeading(trimmed):
+			flush()
+			heading := strings.Trim(strings.TrimLeft(trimmed, "#"), " *")
+			if heading != "" {
+				blocks = append(blocks, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, truncate(heading, headerTextLimit), false, false)))
+			}
+			inList = false
+		case trimmed == "":
+			current.WriteString(line)
+		default:
+			if isListItem(trimmed) != inList {
+				flush()
+				inList = !inList
+			}
+			current.WriteString(line)
+		}
+	}
+
+	// An unclosed code block still renders as code.
+	if inCode {
+		current.WriteString("\n" + codeFence)
+	}
+	flush()
+
+	return blocks
+}
+
+func isRule(line string) bool {
+	return len(line) >= 3 && strings.Trim(line, line[:1]) == "" && strings.Contains("-*_", line[:1])
+}
+
+func isHeading(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, "#"), " ") && strings.HasPrefix(line, "#")
+}
+
+func isListItem(line string) bool {
+	for _, marker := range []string{"• ", "- ", "* ", "◦ "} {
+		if strings.HasPrefix(line, marker) {
+			return true
+		}
+	}
+
+	digits := strings.TrimLeft(line, "0123456789")
+	return len(digits) < len(line) && (strings.HasPrefix(digits, ". ") || strings.HasPrefix(digits, ") "))
+}
+
+// truncate cuts s to at most limit bytes without splitting a rune.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	cut := limit - len("…")
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut] + "…"
+}
+
+// PostBlocks posts text to channelID rendered with MarkdownBlocks. Like PostMessage, a message with
+// more blocks than Slack allows continues in its thread, and threadTS and broadcast post it as a
+// (broadcast) reply instead. It returns the ts of the thread the message ended up in, also
+// alongside the error if a continuation fails after the root message was posted.
+func PostBlocks(ctx context.Context, client *slack.Client, channelID, threadTS, text string, broadcast bool) (string, error) {
+	blocks := MarkdownBlocks(text)
+	fallback := truncate(strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0]), headerTextLimit)
+	broadcast = broadcast && threadTS != ""
+	rooted := threadTS == ""
+
+	parts := (len(blocks) + MaxBlocksPerMessage - 1) / MaxBlocksPerMessage
+	for i := range parts {
+		opts := []slack.MsgOption{
+			slack.MsgOptionText(fallback, false),
+			slack.MsgOptionBlocks(blocks[i*MaxBlocksPerMessage : min(len(blocks), (i+1)*MaxBlocksPerMessage)]...),
+		}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+		if i == 0 && broadcast {
+			opts = append(opts, slack.MsgOptionBroadcast())
+		}
+
+		_, ts, err := client.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			if rooted && i > 0 {
+				return threadTS, fmt.Errorf("posting message part %d/%d: %w", i+1, parts, err)
+			}
+			return "", fmt.Errorf("posting message part %d/%d: %w", i+1, parts, err)
+		}
+
+		if threadTS == "" {
+			threadTS = ts
+		}
+	}
+
+	return threadTS, nil
+}
@@ -0,0 +1,64 @@
+package slack_integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownBlocks(t *testing.T) {
+	text := "# Runbook for HighLatency\n" +
+		"Latency on checkout is above 2s.\n\n" +
+		"- check the payments dashboard\n" +
+		"- roll back the last deploy\n" +
+		"---\n" +
+		"```\nkubectl rollout undo deploy/payments\n```\n" +
+		"```\n" + strings.Repeat("log line\n", 500) + "```\n"
+
+	blocks := MarkdownBlocks(text)
+
+	var types []slack.MessageBlockType
+	for _, block := range blocks {
+		types = append(types, block.BlockType())
+	}
+	require.Equal(t, []slack.MessageBlockType{
+		slack.MBTHeader, slack.MBTSection, slack.MBTSection, slack.MBTDivider, slack.MBTSection, slack.MBTSection, slack.MBTSection,
+	}, types)
+
+	require.Equal(t, "Runbook for HighLatency", blocks[0].(*slack.HeaderBlock).Text.Text)
+	require.Equal(t, "Latency on checkout is above 2s.", blocks[1].(*slack.SectionBlock).Text.Text)
+	require.Equal(t, "- check the payments dashboard\n- roll back the last deploy", blocks[2].(*slack.SectionBlock).Text.Text)
+	require.Equal(t, "```\nkubectl rollout undo deploy/payments\n```", blocks[4].(*slack.SectionBlock).Text.Text)
+	for _, block := range blocks[5:] {
+		section := block.(*slack.SectionBlock).Text.Text
+		require.LessOrEqual(t, len(section), SectionTextLimit)
+		require.True(t, strings.HasPrefix(section, "```") && strings.HasSuffix(section, "```"), section)
+	}
+}
+
+func TestPostBlocksContinuesInThread(t *testing.T) {
+	var threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		var blocks slack.Blocks
+		require.NoError(t, blocks.UnmarshalJSON([]byte(r.Form.Get("blocks"))))
+		require.LessOrEqual(t, len(blocks.BlockSet), MaxBlocksPerMessage)
+		threads = append(threads, r.Form.Get("thread_ts"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+	text := strings.Repeat("paragraph\n---\n", 40)
+
+	ts, err := PostBlocks(t.Context(), client, "C1", "", text, false)
+	require.NoError(t, err)
+	require.Equal(t, "1700000000.000100", ts)
+	require.Equal(t, []string{"", "1700000000.000100"}, threads)
+}
@@ -0,0 +1,51 @@
+package slack_integration
+
+import (
+	"sync"
+	"time"
+)
+
+// seenEvents remembers event IDs for ttl so events Slack redelivers can be dropped.
+type seenEvents struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newSeenEvents(ttl time.Duration) *seenEvents {
+	return &seenEvents{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// firstSeen records id and reports whether it was not seen within the last ttl. Empty IDs
+// are never deduplicated.
+func (s *seenEvents) firstSeen(id string) bool {
+	if id == "" || s.ttl <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastPrune) >= s.ttl {
+		for seenID, at := range s.seen {
+			if now.Sub(at) >= s.ttl {
+				delete(s.seen, seenID)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	if at, ok := s.seen[id]; ok && now.Sub(at) < s.ttl {
+		return false
+	}
+
+	s.seen[id] = now
+	return true
+}
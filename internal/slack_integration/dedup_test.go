@@ -0,0 +1,24 @@
+package slack_integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeenEventsDropsRedeliveries(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	seen := newSeenEvents(10 * time.Minute)
+	seen.now = func() time.Time { return now }
+
+	require.True(t, seen.firstSeen("Ev1"))
+	require.False(t, seen.firstSeen("Ev1"))
+	require.True(t, seen.firstSeen("Ev2"))
+	require.True(t, seen.firstSeen(""))
+	require.True(t, seen.firstSeen(""))
+
+	now = now.Add(10 * time.Minute)
+	require.True(t, seen.firstSeen("Ev1"))
+	require.NotContains(t, seen.seen, "Ev2")
+}
@@ -0,0 +1,127 @@
+package slack_integration
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"github.com/slack-go/slack"
+)
+
+// failedJobErrorLimit caps how much of a job's last error is quoted in its alert.
+const failedJobErrorLimit = 1000
+
+// FailedJobNotifier posts an alert to a Slack channel for every job that fails for the last
+// time, so discarded jobs don't go unnoticed.
+type FailedJobNotifier struct {
+	client    *slack.Client
+	channelID string
+	// URL River UI is served at, e.g. https://ratchet.example.com/riverui. Empty leaves out links.
+	riverUIURL string
+}
+
+func NewFailedJobNotifier(client *slack.Client, channelID, riverUIURL string) *FailedJobNotifier {
+	return &FailedJobNotifier{
+		client:     client,
+		channelID:  channelID,
+		riverUIURL: strings.TrimSuffix(riverUIURL, "/"),
+	}
+}
+
+// Run posts an alert for each job riverClient discards until ctx is done. Failures that will
+// be retried are left alone.
+func (n *FailedJobNotifier) Run(ctx context.Context, riverClient *river.Client[pgx.Tx]) error {
+	events, cancel := riverClient.Subscribe(river.EventKindJobFailed)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if event.Job.State != rivertype.JobStateDiscarded {
+				continue
+			}
+
+			text, blocks := FailedJobBlocks(event.Job, n.riverUIURL)
+			if _, _, err := n.client.PostMessageContext(ctx, n.channelID, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+				slog.ErrorContext(ctx, "error posting failed job alert", "job_id", event.Job.ID, "kind", event.Job.Kind, "error", err)
+			}
+		}
+	}
+}
+
+// FailedJobBlocks formats an alert for a discarded job: what it was working on, taken from its
+// args, its last error and a link to the job in River UI. It returns the blocks and a plain
+// text fallback.
+func FailedJobBlocks(job *rivertype.JobRow, riverUIURL string) (string, []slack.Block) {
+	text := fmt.Sprintf("Job %s (#%d) failed after %d attempts", job.Kind, job.ID, job.Attempt)
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, ":rotating_light: *"+text+"*", false, false), jobArgFields(job.EncodedArgs), nil),
+	}
+
+	if len(job.Errors) > 0 {
+		lastError := truncate(job.Errors[len(job.Errors)-1].Error, failedJobErrorLimit)
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, codeFence+"\n"+lastError+"\n"+codeFence, false, false), nil, nil))
+	}
+
+	if riverUIURL != "" {
+		button := slack.NewButtonBlockElement("open_failed_job", fmt.Sprint(job.ID), slack.NewTextBlockObject(slack.PlainTextType, "Open in River UI", false, false))
+		blocks = append(blocks, slack.NewActionBlock("failed_job", button.WithURL(fmt.Sprintf("%s/jobs/%d", riverUIURL, job.ID))))
+	}
+
+	return text, blocks
+}
+
+// jobArgFields lists a job's scalar args as fields, channels first and linked, so the alert says
+// which channel or incident the job was for.
+func jobArgFields(encodedArgs []byte) []*slack.TextBlockObject {
+	var args map[string]any
+	if err := json.Unmarshal(encodedArgs, &args); err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(args))
+	for key, value := range args {
+		switch value.(type) {
+		case string, float64, bool:
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(argRank(a), argRank(b)), cmp.Compare(a, b))
+	})
+
+	var fields []*slack.TextBlockObject
+	for _, key := range keys {
+		value := fmt.Sprint(args[key])
+		if key == "channel_id" {
+			value = "<#" + value + ">"
+		}
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", key, value), false, false))
+	}
+
+	// Slack accepts at most 10 fields per section.
+	return fields[:min(len(fields), 10)]
+}
+
+func argRank(key string) int {
+	switch key {
+	case "channel_id":
+		return 0
+	case "slack_ts":
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,46 @@
+package slack_integration
+
+import (
+	"testing"
+
+	"github.com/riverqueue/river/rivertype"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedJobBlocks(t *testing.T) {
+	job := &rivertype.JobRow{
+		ID:          42,
+		Kind:        "report",
+		Attempt:     25,
+		State:       rivertype.JobStateDiscarded,
+		EncodedArgs: []byte(`{"channel_id": "C1", "destinations": ["C2"]}`),
+		Errors: []rivertype.AttemptError{
+			{Attempt: 24, Error: "timeout"},
+			{Attempt: 25, Error: "posting report to channel C1: channel_not_found"},
+		},
+	}
+
+	text, blocks := FailedJobBlocks(job, "https://ratchet.example.com/riverui")
+	require.Equal(t, "Job report (#42) failed after 25 attempts", text)
+	require.Len(t, blocks, 3)
+
+	summary := blocks[0].(*slack.SectionBlock)
+	require.Contains(t, summary.Text.Text, text)
+	require.Len(t, summary.Fields, 1)
+	require.Equal(t, "*channel_id*\n<#C1>", summary.Fields[0].Text)
+
+	lastError := blocks[1].(*slack.SectionBlock)
+	require.Contains(t, lastError.Text.Text, "channel_not_found")
+	require.NotContains(t, lastError.Text.Text, "timeout")
+
+	actions := blocks[2].(*slack.ActionBlock)
+	button := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	require.Equal(t, "https://ratchet.example.com/riverui/jobs/42", button.URL)
+
+	_, blocks = FailedJobBlocks(job, "")
+	require.Len(t, blocks, 2)
+	for _, block := range blocks {
+		require.NotEqual(t, slack.MBTAction, block.BlockType())
+	}
+}
@@ -0,0 +1,135 @@
+package slack_integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	codeFence        = "```"
+	continuationNote = "_(continued in thread)_"
+)
+
+// PostMessage posts text to channelID. Text longer than maxLength is split into a root
+// message followed by continuations posted in its thread. If threadTS is set, every part
+// is posted as a reply in that thread instead, and broadcast also shows the first reply in
+// the channel. It returns the ts of the thread the message ended up in, also alongside the
+// error if a continuation fails after the root message was posted.
+func PostMessage(ctx context.Context, client *slack.Client, channelID, threadTS, text string, maxLength int, broadcast bool) (string, error) {
+	parts := SplitMessage(text, maxLength-len(continuationNote)-1)
+	broadcast = broadcast && threadTS != ""
+	rooted := threadTS == ""
+	for i, part := range parts {
+		if i == 0 && threadTS == "" && len(parts) > 1 {
+			part = part + "\n" + continuationNote
+		}
+
+		opts := []slack.MsgOption{slack.MsgOptionText(part, false)}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+		if i == 0 && broadcast {
+			opts = append(opts, slack.MsgOptionBroadcast())
+		}
+
+		_, ts, err := client.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			if rooted && i > 0 {
+				return threadTS, fmt.Errorf("posting message part %d/%d: %w", i+1, len(parts), err)
+			}
+			return "", fmt.Errorf("posting message part %d/%d: %w", i+1, len(parts), err)
+		}
+
+		if threadTS == "" {
+			threadTS = ts
+		}
+	}
+
+	return threadTS, nil
+}
+
+// UploadFile uploads content as a file named filename into the thread at threadTS.
+func UploadFile(ctx context.Context, client *slack.Client, channelID, threadTS, filename, content string) error {
+	if _, err := client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+		Filename:        filename,
+		Title:           filename,
+		Content:         content,
+		FileSize:        len(content),
+	}); err != nil {
+		return fmt.Errorf("uploading file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// SplitMessage splits text into parts of at most limit bytes, preferring line boundaries.
+// Code blocks that span parts are closed and reopened so each part renders on its own.
+func SplitMessage(text string, limit int) []string {
+	if len(text) <= limit {
+		return []string{text}
+	}
+
+	// Leave room to close and reopen a code fence.
+	limit -= 2 * (len(codeFence) + 1)
+
+	var parts []string
+	var current strings.Builder
+	inCode := false
+	header := 0 // length of the reopened code fence at the start of current, if any
+	flush := func() {
+		part := current.String()
+		if inCode {
+			part += "\n" + codeFence
+		}
+		parts = append(parts, strings.TrimRight(part, "\n"))
+		current.Reset()
+		header = 0
+		if inCode {
+			current.WriteString(codeFence + "\n")
+			header = current.Len()
+		}
+	}
+
+	for line := range strings.Lines(text) {
+		for len(line) > 0 {
+			room := limit - current.Len()
+			if len(line) <= room {
+				current.WriteString(line)
+				if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+					inCode = !inCode
+				}
+				break
+			}
+
+			// Line does not fit. Start a new part, unless the line is longer than a part itself.
+			if current.Len() > header && len(line) <= limit {
+				flush()
+				continue
+			}
+
+			cut := room
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = room
+			}
+
+			current.WriteString(line[:cut])
+			line = line[cut:]
+			flush()
+		}
+	}
+
+	if current.Len() > header {
+		parts = append(parts, strings.TrimRight(current.String(), "\n"))
+	}
+
+	return parts
+}
@@ -0,0 +1,100 @@
+package slack_integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostMessageSplitsLongText(t *testing.T) {
+	var posts []http.Header
+	var threads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.LessOrEqual(t, len(r.Form.Get("text")), 200)
+		posts = append(posts, r.Header)
+		threads = append(threads, r.Form.Get("thread_ts"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+	text := strings.Repeat("a line of report output\n", 30) + "```\n" + strings.Repeat("code\n", 40) + "```\n"
+
+	ts, err := PostMessage(t.Context(), client, "C1", "", text, 200, true)
+	require.NoError(t, err)
+	require.Equal(t, "1700000000.000100", ts)
+	require.Greater(t, len(posts), 1)
+	require.Empty(t, threads[0])
+	for _, threadTS := range threads[1:] {
+		require.Equal(t, "1700000000.000100", threadTS)
+	}
+}
+
+func TestPostMessageReturnsRootWhenContinuationFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("thread_ts") != "" {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"internal_error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+	ts, err := PostMessage(t.Context(), client, "C1", "", strings.Repeat("a line of report output\n", 30), 200, false)
+	require.Error(t, err)
+	require.Equal(t, "1700000000.000100", ts)
+
+	// A reply into an existing thread that fails posted nothing.
+	ts, err = PostMessage(t.Context(), client, "C1", "1700000000.000001", "reply", 200, false)
+	require.Error(t, err)
+	require.Empty(t, ts)
+}
+
+func TestPostMessageBroadcastsFirstThreadReply(t *testing.T) {
+	var broadcasts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "1700000000.000001", r.Form.Get("thread_ts"))
+		broadcasts = append(broadcasts, r.Form.Get("reply_broadcast"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1700000000.000100"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+	text := strings.Repeat("a line of runbook output\n", 30)
+
+	_, err := PostMessage(t.Context(), client, "C1", "1700000000.000001", text, 200, true)
+	require.NoError(t, err)
+	require.Greater(t, len(broadcasts), 1)
+	require.Equal(t, "true", broadcasts[0])
+	for _, broadcast := range broadcasts[1:] {
+		require.Empty(t, broadcast)
+	}
+
+	broadcasts = nil
+	_, err = PostMessage(t.Context(), client, "C1", "1700000000.000001", "short", 200, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{""}, broadcasts)
+}
+
+func TestSplitMessageKeepsCodeBlocksBalanced(t *testing.T) {
+	text := "header\n```\n" + strings.Repeat("0123456789\n", 50) + "```\nfooter"
+
+	parts := SplitMessage(text, 100)
+	require.Greater(t, len(parts), 1)
+	for _, part := range parts {
+		require.LessOrEqual(t, len(part), 100)
+		require.Zero(t, strings.Count(part, "```")%2, part)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/dynoinc/ratchet/internal"
 	"github.com/slack-go/slack"
@@ -14,11 +16,17 @@ import (
 type integration struct {
 	BotUserID string
 	client    *socketmode.Client
+	// Workspace URL from auth.test, e.g. https://example.slack.com/, for building permalinks.
+	workspaceURL string
 
-	bot *internal.Bot
+	bot  *internal.Bot
+	seen *seenEvents
+	// Onboard channels the bot is added to, including ones it was in before.
+	autoOnboard bool
 }
 
-func New(ctx context.Context, appToken, botToken string, bot *internal.Bot) (*integration, error) {
+// New connects to Slack. Events redelivered within eventDedupTTL of the first delivery are dropped.
+func New(ctx context.Context, appToken, botToken string, bot *internal.Bot, eventDedupTTL time.Duration, autoOnboard bool) (*integration, error) {
 	api := slack.New(botToken, slack.OptionAppLevelToken(appToken))
 
 	authTest, err := api.AuthTestContext(ctx)
@@ -29,9 +37,12 @@ func New(ctx context.Context, appToken, botToken string, bot *internal.Bot) (*in
 	socketClient := socketmode.New(api)
 
 	return &integration{
-		BotUserID: authTest.UserID,
-		client:    socketClient,
-		bot:       bot,
+		BotUserID:    authTest.UserID,
+		client:       socketClient,
+		workspaceURL: authTest.URL,
+		bot:          bot,
+		seen:         newSeenEvents(eventDedupTTL),
+		autoOnboard:  autoOnboard,
 	}, nil
 }
 
@@ -49,11 +60,12 @@ func (b *integration) Run(ctx context.Context) error {
 						continue
 					}
 
+					// Ack before handling so a slow handler doesn't make Slack redeliver the event.
+					b.client.AckCtx(ctx, evt.Request.EnvelopeID, nil)
+
 					if err := b.handleEventAPI(ctx, eventsAPI); err != nil {
 						slog.ErrorContext(ctx, "error handling event", "error", err)
 					}
-
-					b.client.AckCtx(ctx, evt.Request.EnvelopeID, nil)
 				}
 			}
 		}
@@ -65,12 +77,29 @@ func (b *integration) Run(ctx context.Context) error {
 func (b *integration) handleEventAPI(ctx context.Context, event slackevents.EventsAPIEvent) error {
 	switch event.Type {
 	case slackevents.CallbackEvent:
+		if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && !b.seen.firstSeen(callback.EventID) {
+			slog.DebugContext(ctx, "dropping redelivered event", "event_id", callback.EventID)
+			return nil
+		}
+
 		switch ev := event.InnerEvent.Data.(type) {
 		case *slackevents.MessageEvent:
 			err := b.bot.Notify(ctx, ev)
 			if err != nil {
 				return fmt.Errorf("notifying update for channel: %w", err)
 			}
+
+			if b.autoOnboard && ev.SubType == slack.MsgSubTypeChannelJoin && ev.User == b.BotUserID {
+				onboarded, err := b.bot.OnboardChannel(ctx, ev.Channel)
+				if err != nil {
+					return fmt.Errorf("onboarding joined channel: %w", err)
+				}
+				slog.InfoContext(ctx, "bot added to channel", "channel_id", ev.Channel, "onboarding", onboarded)
+			}
+		case *slackevents.ChannelArchiveEvent:
+			return b.setArchived(ctx, ev.Channel, true)
+		case *slackevents.ChannelUnarchiveEvent:
+			return b.setArchived(ctx, ev.Channel, false)
 		default:
 			return fmt.Errorf("unhandled event: %T", ev)
 		}
@@ -81,6 +110,50 @@ func (b *integration) handleEventAPI(ctx context.Context, event slackevents.Even
 	return nil
 }
 
+func (b *integration) setArchived(ctx context.Context, channelID string, archived bool) error {
+	if err := b.bot.SetChannelArchived(ctx, channelID, archived); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "channel archive state changed", "channel_id", channelID, "archived", archived)
+	return nil
+}
+
 func (b *integration) Client() *slack.Client {
 	return &b.client.Client
 }
+
+// BotChannels lists the unarchived channels the bot is a member of.
+func (b *integration) BotChannels(ctx context.Context) ([]slack.Channel, error) {
+	params := &slack.GetConversationsForUserParameters{
+		UserID:          b.BotUserID,
+		Types:           []string{"public_channel", "private_channel"},
+		ExcludeArchived: true,
+		Limit:           200,
+	}
+
+	var channels []slack.Channel
+	for {
+		page, cursor, err := b.client.GetConversationsForUserContext(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("listing channels for user %s: %w", b.BotUserID, err)
+		}
+
+		channels = append(channels, page...)
+		if cursor == "" {
+			return channels, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// Permalink links to the message at ts in channelID of the bot's workspace.
+func (b *integration) Permalink(channelID, ts string) string {
+	return Permalink(b.workspaceURL, channelID, ts)
+}
+
+// Permalink builds the link Slack's chat.getPermalink would return for the message at ts in
+// channelID, without an API call per message. workspaceURL is as returned by auth.test.
+func Permalink(workspaceURL, channelID, ts string) string {
+	return strings.TrimSuffix(workspaceURL, "/") + "/archives/" + channelID + "/p" + strings.ReplaceAll(ts, ".", "")
+}
@@ -0,0 +1,107 @@
+package slack_integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+// setupBot returns a bot backed by a fresh database in which channel C1 has finished onboarding.
+func setupBot(t *testing.T) (*pgxpool.Pool, *river.Client[pgx.Tx], *internal.Bot) {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	_, err := schema.New(db).AddChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.NoError(t, schema.New(db).UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
+		ID:    "C1",
+		Attrs: dto.ChannelAttrs{OnboardingStatus: dto.OnboardingStatusFinished},
+	}))
+
+	riverClient, err := river.NewClient(riverpgxv5.New(db), &river.Config{})
+	require.NoError(t, err)
+	bot := internal.New(db, nil, nil, false, false)
+	require.NoError(t, bot.Init(riverClient))
+
+	return db, riverClient, bot
+}
+
+func jobCount(t *testing.T, riverClient *river.Client[pgx.Tx], kind string) int {
+	t.Helper()
+
+	res, err := riverClient.JobList(context.Background(), river.NewJobListParams().Kinds(kind))
+	require.NoError(t, err)
+	return len(res.Jobs)
+}
+
+func TestBotJoinOnboardsChannel(t *testing.T) {
+	ctx := context.Background()
+	// The channel was onboarded before the bot was removed from it.
+	_, riverClient, bot := setupBot(t)
+
+	onboardJobs := func() int { return jobCount(t, riverClient, "channel_board") }
+	join := func(ts string) slackevents.EventsAPIEvent {
+		return slackevents.EventsAPIEvent{
+			Type: slackevents.CallbackEvent,
+			Data: &slackevents.EventsAPICallbackEvent{EventID: "Ev" + ts},
+			InnerEvent: slackevents.EventsAPIInnerEvent{Data: &slackevents.MessageEvent{
+				Channel:   "C1",
+				TimeStamp: ts,
+				User:      "UBOT",
+				SubType:   slack.MsgSubTypeChannelJoin,
+			}},
+		}
+	}
+
+	b := &integration{BotUserID: "UBOT", bot: bot, seen: newSeenEvents(0)}
+	require.NoError(t, b.handleEventAPI(ctx, join("1700000000.000100")))
+	require.Zero(t, onboardJobs())
+
+	b.autoOnboard = true
+	require.NoError(t, b.handleEventAPI(ctx, join("1700000000.000200")))
+	require.Equal(t, 1, onboardJobs())
+}
+
+func TestRedeliveredEventIsProcessedOnce(t *testing.T) {
+	ctx := context.Background()
+	db, riverClient, bot := setupBot(t)
+
+	event := slackevents.EventsAPIEvent{
+		Type: slackevents.CallbackEvent,
+		Data: &slackevents.EventsAPICallbackEvent{EventID: "Ev1"},
+		InnerEvent: slackevents.EventsAPIInnerEvent{Data: &slackevents.MessageEvent{
+			Channel:   "C1",
+			TimeStamp: "1700000000.000100",
+			User:      "U1",
+			Text:      "is anyone else seeing checkout errors?",
+		}},
+	}
+
+	b := &integration{BotUserID: "UBOT", bot: bot, seen: newSeenEvents(time.Minute)}
+	require.NoError(t, b.handleEventAPI(ctx, event))
+	require.NoError(t, b.handleEventAPI(ctx, event))
+
+	messages, err := schema.New(db).GetAllMessages(ctx, "C1")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, 1, jobCount(t, riverClient, "classifier"))
+}
+
+func TestPermalink(t *testing.T) {
+	require.Equal(t, "https://example.slack.com/archives/C1/p1700000000000100", Permalink("https://example.slack.com/", "C1", "1700000000.000100"))
+}
@@ -0,0 +1,18 @@
+package slack_integration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// GetUserIDByEmail returns the ID of the Slack user with email.
+func GetUserIDByEmail(ctx context.Context, client *slack.Client, email string) (string, error) {
+	user, err := client.GetUserByEmailContext(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("looking up Slack user %s: %w", email, err)
+	}
+
+	return user.ID, nil
+}
@@ -4,16 +4,623 @@ import (
 	"context"
 	"testing"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
 )
 
-func TestDBSetup(t *testing.T) {
+func setupTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
 	ctx := context.Background()
-	postgresContainer, err := postgres.Run(ctx, postgresImage, postgres.BasicWaitStrategies())
+	postgresContainer, err := postgres.Run(ctx, PostgresImage, postgres.BasicWaitStrategies())
 	require.NoError(t, err)
 	t.Cleanup(func() { _ = postgresContainer.Stop(ctx, nil) })
 
-	_, err = New(ctx, postgresContainer.MustConnectionString(ctx, "sslmode=disable"))
+	db, err := New(ctx, postgresContainer.MustConnectionString(ctx, "sslmode=disable"))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+func TestDBSetup(t *testing.T) {
+	setupTestDB(t)
+}
+
+func TestAlertRunbookURL(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	for _, url := range []string{"https://wiki.example.com/old", "https://wiki.example.com/new"} {
+		require.NoError(t, q.SetAlertRunbookURL(t.Context(), schema.SetAlertRunbookURLParams{
+			Service: "payments",
+			Alert:   "HighLatency",
+			Url:     url,
+		}))
+	}
+
+	got, err := q.GetAlertRunbookURL(t.Context(), schema.GetAlertRunbookURLParams{
+		Service: "payments",
+		Alert:   "HighLatency",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://wiki.example.com/new", got)
+}
+
+func TestGetThreadMessagesLimit(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	_, err = q.AddMessage(t.Context(), schema.AddMessageParams{ChannelID: "C1", Ts: "1.000000"})
+	require.NoError(t, err)
+	for _, ts := range []string{"2.000000", "3.000000", "4.000000"} {
+		require.NoError(t, q.AddThreadMessage(t.Context(), schema.AddThreadMessageParams{
+			ChannelID: "C1",
+			ParentTs:  "1.000000",
+			Ts:        ts,
+		}))
+	}
+
+	msgs, err := q.GetThreadMessages(t.Context(), schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1.000000", MaxMessages: 2})
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, "3.000000", msgs[0].Ts)
+	require.Equal(t, "4.000000", msgs[1].Ts)
+
+	msgs, err = q.GetThreadMessages(t.Context(), schema.GetThreadMessagesParams{ChannelID: "C1", ParentTs: "1.000000"})
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+}
+
+func TestTimeToAckByService(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for _, ts := range []string{"1000.000000", "2000.000000"} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:   dto.ActionOpenIncident,
+				Service:  "payments",
+				Alert:    "HighLatency",
+				Priority: dto.PriorityHigh,
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	// Replies arrive out of order during backfill; the earliest one wins.
+	for _, ackTs := range []string{"1300.000000", "1120.000000"} {
+		require.NoError(t, q.SetIncidentAcknowledged(t.Context(), schema.SetIncidentAcknowledgedParams{
+			AckTs:     ackTs,
+			ChannelID: "C1",
+			Ts:        "1000.000000",
+		}))
+	}
+
+	rows, err := q.GetTimeToAckByService(t.Context(), schema.GetTimeToAckByServiceParams{
+		ChannelID: "C1",
+		StartTs:   "0000.000000",
+		EndTs:     "9999.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetTimeToAckByServiceRow{
+		{Service: "payments", Acked: 1, Unacked: 1, AvgSeconds: 120},
+	}, rows)
+}
+
+func TestIncidentsByPriority(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	incident := func(channelID, ts, service, alert string, high bool) schema.AddMessageParams {
+		action := dto.IncidentAction{Action: dto.ActionOpenIncident, Service: service, Alert: alert, Priority: dto.PriorityLow}
+		if high {
+			action.Priority = dto.PriorityHigh
+		}
+		return schema.AddMessageParams{ChannelID: channelID, Ts: ts, Attrs: dto.MessageAttrs{IncidentAction: action}}
+	}
+
+	for _, channelID := range []string{"C1", "C2"} {
+		_, err := q.AddChannel(t.Context(), channelID)
+		require.NoError(t, err)
+	}
+	for _, msg := range []schema.AddMessageParams{
+		incident("C1", "1000.000000", "payments", "HighLatency", true),
+		incident("C1", "1100.000000", "payments", "HighLatency", true),
+		incident("C1", "1200.000000", "payments", "DiskFull", false),
+		incident("C2", "1300.000000", "search", "IndexLag", true),
+		incident("C2", "9000.000000", "search", "IndexLag", true),
+	} {
+		_, err := q.AddMessage(t.Context(), msg)
+		require.NoError(t, err)
+	}
+
+	rows, err := q.GetIncidentsByPriority(t.Context(), schema.GetIncidentsByPriorityParams{
+		Priority: string(dto.PriorityHigh),
+		StartTs:  "0000.000000",
+		EndTs:    "5000.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetIncidentsByPriorityRow{
+		{ChannelID: "C1", Service: "payments", Alert: "HighLatency", Count: 2},
+		{ChannelID: "C2", Service: "search", Alert: "IndexLag", Count: 1},
+	}, rows)
+}
+
+func TestMessageVolumeSeries(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, msg := range map[string]dto.SlackMessage{
+		"1704067200.000000": {User: "U1"},  // 2024-01-01 00:00 UTC
+		"1704153599.000000": {User: "U2"},  // 2024-01-01 23:59:59 UTC
+		"1704110000.000000": {BotID: "B1"}, // 2024-01-01 UTC
+		"1704240000.000000": {User: "U1"},  // 2024-01-03 UTC
+		"1706745600.000000": {User: "U1"},  // 2024-02-01 UTC
+	} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs:     dto.MessageAttrs{Message: msg},
+		})
+		require.NoError(t, err)
+	}
+
+	params := schema.GetMessageVolumeSeriesParams{
+		Bucket:    "day",
+		ChannelID: "C1",
+		StartTs:   "1700000000.000000",
+		EndTs:     "1710000000.000000",
+	}
+	series, err := q.GetMessageVolumeSeries(t.Context(), params)
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetMessageVolumeSeriesRow{
+		{Bucket: "2024-01-01", Messages: 3},
+		{Bucket: "2024-01-03", Messages: 1},
+		{Bucket: "2024-02-01", Messages: 1},
+	}, series)
+
+	params.Bucket, params.ExcludeBots = "month", true
+	series, err = q.GetMessageVolumeSeries(t.Context(), params)
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetMessageVolumeSeriesRow{
+		{Bucket: "2024-01-01", Messages: 3},
+		{Bucket: "2024-02-01", Messages: 1},
+	}, series)
+}
+
+func TestTopRespondersByService(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, service := range map[string]string{"1000.000000": "payments", "2000.000000": "payments", "3000.000000": "search"} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: service,
+				Alert:   "HighLatency",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	replies := []struct {
+		parentTs, ts string
+		message      dto.SlackMessage
+	}{
+		{"1000.000000", "1001.000000", dto.SlackMessage{User: "U1"}},
+		{"1000.000000", "1002.000000", dto.SlackMessage{User: "U2"}},
+		{"1000.000000", "1003.000000", dto.SlackMessage{User: "U1"}},
+		{"1000.000000", "1004.000000", dto.SlackMessage{BotID: "B1", User: "U9"}},
+		{"2000.000000", "2001.000000", dto.SlackMessage{User: "U1"}},
+		{"3000.000000", "3001.000000", dto.SlackMessage{User: "U3"}},
+	}
+	for _, reply := range replies {
+		require.NoError(t, q.AddThreadMessage(t.Context(), schema.AddThreadMessageParams{
+			ChannelID: "C1",
+			ParentTs:  reply.parentTs,
+			Ts:        reply.ts,
+			Attrs:     dto.ThreadMessageAttrs{Message: reply.message},
+		}))
+	}
+
+	rows, err := q.GetTopRespondersByService(t.Context(), schema.GetTopRespondersByServiceParams{
+		Service: "payments",
+		StartTs: "0000.000000",
+		EndTs:   "9999.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetTopRespondersByServiceRow{
+		{UserID: "U1", Replies: 3, Incidents: 2},
+		{UserID: "U2", Replies: 1, Incidents: 1},
+	}, rows)
+}
+
+func TestUpsertMessageKeepsEnrichments(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	_, err = q.UpsertMessage(t.Context(), schema.UpsertMessageParams{
+		ChannelID: "C1",
+		Ts:        "1000.000000",
+		Attrs:     dto.MessageAttrs{Message: dto.SlackMessage{Text: "payments are down", User: "U1"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, q.UpdateMessageAttrs(t.Context(), schema.UpdateMessageAttrsParams{
+		ChannelID: "C1",
+		Ts:        "1000.000000",
+		Attrs:     dto.MessageAttrs{AIClassification: dto.AIClassification{Service: "payments"}},
+	}))
+
+	// Redelivered with edited text, then the original again, then an empty payload.
+	for _, msg := range []dto.SlackMessage{
+		{Text: "payments are down in us-east", User: "U1", EditedTs: "1010.000000"},
+		{Text: "payments are down", User: "U1"},
+		{User: "U1", EditedTs: "1020.000000"},
+	} {
+		_, err = q.UpsertMessage(t.Context(), schema.UpsertMessageParams{
+			ChannelID: "C1",
+			Ts:        "1000.000000",
+			Attrs:     dto.MessageAttrs{Message: msg},
+		})
+		require.NoError(t, err)
+	}
+
+	msg, err := q.GetMessage(t.Context(), schema.GetMessageParams{ChannelID: "C1", Ts: "1000.000000"})
+	require.NoError(t, err)
+	require.Equal(t, "payments are down in us-east", msg.Attrs.Message.Text)
+	require.Equal(t, "payments", msg.Attrs.AIClassification.Service)
+}
+
+func TestDisappearedAlerts(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, alert := range map[string]string{
+		"1000.000000": "DiskFull",
+		"1100.000000": "DiskFull",
+		"1200.000000": "HighLatency",
+		"5000.000000": "HighLatency",
+	} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: "payments",
+				Alert:   alert,
+			}},
+		})
+		require.NoError(t, err)
+	}
+	// An incident recorded without service or alert keys is left out.
+	_, err = db.Exec(t.Context(), `INSERT INTO messages_v2 (channel_id, ts, attrs) VALUES ('C1', '1300.000000', '{"incident_action": {"action": "open_incident"}}')`)
+	require.NoError(t, err)
+
+	rows, err := q.GetDisappearedAlerts(t.Context(), schema.GetDisappearedAlertsParams{
+		ChannelID:       "C1",
+		BaselineStartTs: "0000.000000",
+		EndTs:           "9999.000000",
+		RecentStartTs:   "4000.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetDisappearedAlertsRow{
+		{Service: "payments", Alert: "DiskFull", BaselineCount: 2, LastSeenTs: "1100.000000"},
+	}, rows)
+}
+
+func TestIncidentsByOwner(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for _, ts := range []string{"1000.000000", "2000.000000", "3000.000000"} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: "payments",
+				Alert:   "HighLatency",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	// 3000 is assigned to U1, then handed over to U2.
+	for _, ts := range []string{"1000.000000", "2000.000000", "3000.000000"} {
+		require.NoError(t, q.UpdateMessageAttrs(t.Context(), schema.UpdateMessageAttrsParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs:     dto.MessageAttrs{OwnerID: "U1"},
+		}))
+	}
+	require.NoError(t, q.UpdateMessageAttrs(t.Context(), schema.UpdateMessageAttrsParams{
+		ChannelID: "C1",
+		Ts:        "3000.000000",
+		Attrs:     dto.MessageAttrs{OwnerID: "U2"},
+	}))
+
+	// U1 also owned an incident that has since closed.
+	_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "500.000000",
+		Attrs: dto.MessageAttrs{
+			IncidentAction: dto.IncidentAction{Action: dto.ActionOpenIncident, Service: "payments", Alert: "DiskFull"},
+			OwnerID:        "U1",
+		},
+	})
+	require.NoError(t, err)
+	_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+		ChannelID: "C1",
+		Ts:        "600.000000",
+		Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+			Action:  dto.ActionCloseIncident,
+			Service: "payments",
+			Alert:   "DiskFull",
+		}},
+	})
+	require.NoError(t, err)
+
+	incidents, err := q.GetIncidentsByOwner(t.Context(), schema.GetIncidentsByOwnerParams{
+		OwnerID: "U1",
+		StartTs: "0000.000000",
+		EndTs:   "9999.000000",
+	})
+	require.NoError(t, err)
+	require.Len(t, incidents, 2)
+	require.Equal(t, "2000.000000", incidents[0].Ts)
+	require.Equal(t, "1000.000000", incidents[1].Ts)
+	require.Equal(t, "payments", incidents[0].Attrs.IncidentAction.Service)
+}
+
+func TestLatestRunbooks(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	for _, runbook := range []dto.RunbookAttrs{
+		{ServiceName: "search", AlertName: "IndexLag", Runbook: "reindex"},
+		{ServiceName: "payments", AlertName: "HighLatency", Runbook: "old"},
+		{ServiceName: "payments", AlertName: "HighLatency", Runbook: "new"},
+		{ServiceName: "payments", AlertName: "HighLatency", Runbook: "新しい", Locale: "ja"},
+	} {
+		_, err := q.CreateRunbook(t.Context(), runbook)
+		require.NoError(t, err)
+	}
+
+	runbooks, err := q.GetLatestRunbooks(t.Context())
+	require.NoError(t, err)
+	require.Len(t, runbooks, 3)
+	require.Equal(t, dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Runbook: "new"}, runbooks[0].Attrs)
+	require.Equal(t, dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Runbook: "新しい", Locale: "ja"}, runbooks[1].Attrs)
+	require.Equal(t, dto.RunbookAttrs{ServiceName: "search", AlertName: "IndexLag", Runbook: "reindex"}, runbooks[2].Attrs)
+
+	runbook, err := q.GetRunbook(t.Context(), schema.GetRunbookParams{ServiceName: "payments", AlertName: "HighLatency"})
+	require.NoError(t, err)
+	require.Equal(t, "new", runbook.Attrs.Runbook)
+
+	runbook, err = q.GetRunbook(t.Context(), schema.GetRunbookParams{ServiceName: "payments", AlertName: "HighLatency", Locale: "ja"})
+	require.NoError(t, err)
+	require.Equal(t, "新しい", runbook.Attrs.Runbook)
+
+	_, err = q.GetRunbook(t.Context(), schema.GetRunbookParams{ServiceName: "search", AlertName: "IndexLag", Locale: "ja"})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestImpactByService(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, service := range map[string]string{
+		"1000.000000": "payments",
+		"2000.000000": "payments",
+		"3000.000000": "search",
+		"4000.000000": "search",
+	} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: service,
+				Alert:   "HighLatency",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	// 4000 has no impact recorded and is left out.
+	for ts, impact := range map[string]dto.IncidentImpact{
+		"1000.000000": {DowntimeMinutes: 30, AffectedUsers: 1000},
+		"2000.000000": {DowntimeMinutes: 15, Notes: "checkout only"},
+		"3000.000000": {AffectedUsers: 50},
+	} {
+		require.NoError(t, q.UpdateMessageAttrs(t.Context(), schema.UpdateMessageAttrsParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs:     dto.MessageAttrs{Impact: impact},
+		}))
+	}
+	// An incident recorded without a service key is left out.
+	_, err = db.Exec(t.Context(), `INSERT INTO messages_v2 (channel_id, ts, attrs) VALUES ('C1', '5000.000000', '{"incident_action": {"action": "open_incident"}, "impact": {"downtime_minutes": 5}}')`)
+	require.NoError(t, err)
+
+	rows, err := q.GetImpactByService(t.Context(), schema.GetImpactByServiceParams{
+		ChannelID: "C1",
+		StartTs:   "0000.000000",
+		EndTs:     "9999.000000",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []schema.GetImpactByServiceRow{
+		{Service: "payments", Incidents: 2, DowntimeMinutes: 45, AffectedUsers: 1000},
+		{Service: "search", Incidents: 1, DowntimeMinutes: 0, AffectedUsers: 50},
+	}, rows)
+}
+
+func TestSearchMessagesWithHighlights(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, text := range map[string]string{
+		"1000.000000": "payments latency is back to normal after the deploy",
+		"2000.000000": "payments latency alert firing again, payments p99 doubled",
+		"3000.000000": "search index lag recovered",
+	} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs:     dto.MessageAttrs{Message: dto.SlackMessage{Text: text}},
+		})
+		require.NoError(t, err)
+	}
+
+	results, err := q.SearchMessagesWithHighlights(t.Context(), schema.SearchMessagesWithHighlightsParams{
+		Query:      "payments",
+		ChannelID:  "C1",
+		LimitCount: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "2000.000000", results[0].Ts)
+	require.GreaterOrEqual(t, results[0].Rank, results[1].Rank)
+	for _, result := range results {
+		require.Contains(t, result.Highlight, "<b>payments</b>")
+	}
+}
+
+func TestArchivedChannelsAreExcluded(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	for _, id := range []string{"C1", "C2"} {
+		_, err := q.AddChannel(t.Context(), id)
+		require.NoError(t, err)
+	}
+	require.NoError(t, q.UpdateChannelAttrs(t.Context(), schema.UpdateChannelAttrsParams{
+		ID:    "C2",
+		Attrs: dto.ChannelAttrs{Name: "old-incidents"},
+	}))
+	require.NoError(t, q.SetChannelArchived(t.Context(), schema.SetChannelArchivedParams{Archived: true, ID: "C2"}))
+
+	active, err := q.GetActiveChannels(t.Context())
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	require.Equal(t, "C1", active[0].ID)
+
+	archived, err := q.GetChannel(t.Context(), "C2")
+	require.NoError(t, err)
+	require.True(t, archived.Attrs.Archived)
+	require.Equal(t, "old-incidents", archived.Attrs.Name)
+
+	require.NoError(t, q.SetChannelArchived(t.Context(), schema.SetChannelArchivedParams{Archived: false, ID: "C2"}))
+	active, err = q.GetActiveChannels(t.Context())
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+}
+
+func TestRelatedIncidents(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	for _, id := range []string{"C1", "C2", "C3"} {
+		_, err := q.AddChannel(t.Context(), id)
+		require.NoError(t, err)
+	}
+	for _, m := range []struct {
+		channelID, ts, service string
+	}{
+		{"C1", "10000.000000", "payments"},
+		{"C2", "10600.000000", "payments"}, // same service, 10 minutes later
+		{"C3", "10300.000000", "search"},   // different service
+		{"C3", "20000.000000", "payments"}, // same service, outside the window
+		{"C1", "10100.000000", "payments"}, // same channel
+	} {
+		_, err := q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: m.channelID,
+			Ts:        m.ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: m.service,
+				Alert:   "HighLatency",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	related, err := q.GetRelatedIncidents(t.Context(), schema.GetRelatedIncidentsParams{
+		WindowSeconds: 3600,
+		ChannelID:     "C1",
+		Ts:            "10000.000000",
+	})
+	require.NoError(t, err)
+	require.Len(t, related, 1)
+	require.Equal(t, "C2", related[0].ChannelID)
+	require.Equal(t, "10600.000000", related[0].Ts)
+}
+
+func TestAlertsNormalizedService(t *testing.T) {
+	db := setupTestDB(t)
+	q := schema.New(db)
+
+	_, err := q.AddChannel(t.Context(), "C1")
+	require.NoError(t, err)
+	for ts, service := range map[string]string{
+		"1000.000000": "payment-svc",
+		"2000.000000": "Payment_Svc",
+		"3000.000000": "search",
+	} {
+		_, err = q.AddMessage(t.Context(), schema.AddMessageParams{
+			ChannelID: "C1",
+			Ts:        ts,
+			Attrs: dto.MessageAttrs{IncidentAction: dto.IncidentAction{
+				Action:  dto.ActionOpenIncident,
+				Service: service,
+				Alert:   "HighLatency",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	alerts, err := q.GetAlerts(t.Context(), schema.GetAlertsParams{ChannelID: "C1", Service: "*"})
+	require.NoError(t, err)
+	require.Len(t, alerts, 3)
+
+	alerts, err = q.GetAlerts(t.Context(), schema.GetAlertsParams{ChannelID: "C1", Service: "payment-svc"})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+
+	alerts, err = q.GetAlerts(t.Context(), schema.GetAlertsParams{ChannelID: "C1", Service: "payment-svc", Normalize: true})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Contains(t, []string{"payment-svc", "Payment_Svc"}, alerts[0].Service)
+
+	alerts, err = q.GetAlerts(t.Context(), schema.GetAlertsParams{ChannelID: "C1", Service: "*", Normalize: true})
 	require.NoError(t, err)
+	require.Len(t, alerts, 2)
 }
@@ -16,10 +16,10 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const (
-	postgresImage = "postgres:16.6"
-	containerName = "ratchet-db"
-)
+// PostgresImage is the PostgreSQL image the dev database and tests run.
+const PostgresImage = "postgres:16.6"
+
+const containerName = "ratchet-db"
 
 // StartPostgresContainer starts a PostgreSQL container with persistent storage
 // and checks for readiness with a PING using exponential backoff.
@@ -36,14 +36,14 @@ func StartPostgresContainer(ctx context.Context, c DatabaseConfig) error {
 	}
 
 	// Pull PostgreSQL image if not available
-	_, err = cli.ImagePull(ctx, postgresImage, image.PullOptions{All: true})
+	_, err = cli.ImagePull(ctx, PostgresImage, image.PullOptions{All: true})
 	if err != nil {
 		return fmt.Errorf("failed to pull Docker image: %w", err)
 	}
 
 	// Define container configurations
 	containerConfig := &container.Config{
-		Image: postgresImage,
+		Image: PostgresImage,
 		Env: []string{
 			"POSTGRES_USER=" + c.User,
 			"POSTGRES_PASSWORD=" + c.Pass,
@@ -23,6 +23,15 @@ SELECT
 FROM
     channels_v2;
 
+-- name: GetChannel :one
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    id = @id;
+
 -- name: GetChannelByName :one
 SELECT
     id,
@@ -30,4 +39,46 @@ SELECT
 FROM
     channels_v2
 WHERE
-    attrs ->> 'name' = @name :: text;
\ No newline at end of file
+    attrs ->> 'name' = @name :: text;
+
+-- name: GetActiveChannels :many
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    NOT COALESCE(CAST(attrs ->> 'archived' AS boolean), false);
+
+-- name: SetChannelArchived :exec
+UPDATE
+    channels_v2
+SET
+    attrs = COALESCE(attrs, '{}' :: jsonb) || jsonb_build_object('archived', @archived :: boolean)
+WHERE
+    id = @id;
+
+-- name: GetChannelForUpdate :one
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    id = @id FOR
+UPDATE;
+
+-- name: SetReportClaim :exec
+UPDATE
+    channels_v2
+SET
+    attrs = COALESCE(attrs, '{}' :: jsonb) || jsonb_build_object(
+        'report_posted_ts',
+        @report_posted_ts :: text,
+        'report_job_id',
+        @report_job_id :: bigint,
+        'report_delivered_to',
+        to_jsonb(@report_delivered_to :: text [])
+    )
+WHERE
+    id = @id;
@@ -29,6 +29,36 @@ func (q *Queries) AddChannel(ctx context.Context, id string) (ChannelsV2, error)
 	return i, err
 }
 
+const getActiveChannels = `-- name: GetActiveChannels :many
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    NOT COALESCE(CAST(attrs ->> 'archived' AS boolean), false)
+`
+
+func (q *Queries) GetActiveChannels(ctx context.Context) ([]ChannelsV2, error) {
+	rows, err := q.db.Query(ctx, getActiveChannels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChannelsV2
+	for rows.Next() {
+		var i ChannelsV2
+		if err := rows.Scan(&i.ID, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllChannels = `-- name: GetAllChannels :many
 SELECT
     id,
@@ -57,6 +87,23 @@ func (q *Queries) GetAllChannels(ctx context.Context) ([]ChannelsV2, error) {
 	return items, nil
 }
 
+const getChannel = `-- name: GetChannel :one
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    id = $1
+`
+
+func (q *Queries) GetChannel(ctx context.Context, id string) (ChannelsV2, error) {
+	row := q.db.QueryRow(ctx, getChannel, id)
+	var i ChannelsV2
+	err := row.Scan(&i.ID, &i.Attrs)
+	return i, err
+}
+
 const getChannelByName = `-- name: GetChannelByName :one
 SELECT
     id,
@@ -74,6 +121,76 @@ func (q *Queries) GetChannelByName(ctx context.Context, name string) (ChannelsV2
 	return i, err
 }
 
+const getChannelForUpdate = `-- name: GetChannelForUpdate :one
+SELECT
+    id,
+    attrs
+FROM
+    channels_v2
+WHERE
+    id = $1 FOR
+UPDATE
+`
+
+func (q *Queries) GetChannelForUpdate(ctx context.Context, id string) (ChannelsV2, error) {
+	row := q.db.QueryRow(ctx, getChannelForUpdate, id)
+	var i ChannelsV2
+	err := row.Scan(&i.ID, &i.Attrs)
+	return i, err
+}
+
+const setChannelArchived = `-- name: SetChannelArchived :exec
+UPDATE
+    channels_v2
+SET
+    attrs = COALESCE(attrs, '{}' :: jsonb) || jsonb_build_object('archived', $1 :: boolean)
+WHERE
+    id = $2
+`
+
+type SetChannelArchivedParams struct {
+	Archived bool
+	ID       string
+}
+
+func (q *Queries) SetChannelArchived(ctx context.Context, arg SetChannelArchivedParams) error {
+	_, err := q.db.Exec(ctx, setChannelArchived, arg.Archived, arg.ID)
+	return err
+}
+
+const setReportClaim = `-- name: SetReportClaim :exec
+UPDATE
+    channels_v2
+SET
+    attrs = COALESCE(attrs, '{}' :: jsonb) || jsonb_build_object(
+        'report_posted_ts',
+        $1 :: text,
+        'report_job_id',
+        $2 :: bigint,
+        'report_delivered_to',
+        to_jsonb($3 :: text [])
+    )
+WHERE
+    id = $4
+`
+
+type SetReportClaimParams struct {
+	ReportPostedTs    string
+	ReportJobID       int64
+	ReportDeliveredTo []string
+	ID                string
+}
+
+func (q *Queries) SetReportClaim(ctx context.Context, arg SetReportClaimParams) error {
+	_, err := q.db.Exec(ctx, setReportClaim,
+		arg.ReportPostedTs,
+		arg.ReportJobID,
+		arg.ReportDeliveredTo,
+		arg.ID,
+	)
+	return err
+}
+
 const updateChannelAttrs = `-- name: UpdateChannelAttrs :exec
 UPDATE
     channels_v2
@@ -1,5 +1,7 @@
 package dto
 
+import "reflect"
+
 type OnboardingStatus string
 
 const (
@@ -10,4 +12,22 @@ const (
 type ChannelAttrs struct {
 	OnboardingStatus OnboardingStatus `json:"onboarding_status,omitzero"`
 	Name             string           `json:"name,omitzero"`
+
+	// When the last weekly report for the channel was claimed for posting, and by which job.
+	ReportPostedTs string `json:"report_posted_ts,omitzero"`
+	// Destinations the report job ReportJobID has posted to, so a retry of the job skips them.
+	ReportJobID       int64    `json:"report_job_id,omitzero"`
+	ReportDeliveredTo []string `json:"report_delivered_to,omitzero"`
+	// Sections of the weekly report, in order. Empty means the default sections.
+	ReportSections []string `json:"report_sections,omitzero"`
+	// The channel is archived in Slack. Archived channels are not posted in or reported on.
+	Archived bool `json:"archived,omitzero"`
+	// BCP 47 locale runbooks are written in for incidents in the channel, like "ja". Empty
+	// means English.
+	Locale string `json:"locale,omitzero"`
+}
+
+// IsZero reports whether no attrs are set, as for a channel seen for the first time.
+func (a ChannelAttrs) IsZero() bool {
+	return reflect.ValueOf(a).IsZero()
 }
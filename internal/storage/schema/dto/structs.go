@@ -6,6 +6,11 @@ type SlackMessage struct {
 	User        string `json:"user,omitzero"`
 	BotID       string `json:"bot_id,omitzero"`
 	BotUsername string `json:"bot_usernames,omitzero"`
+	// Ts of the message's latest edit, if it was edited.
+	EditedTs string `json:"edited_ts,omitzero"`
+
+	// Set when secrets were redacted from Text before it was stored.
+	Redacted bool `json:"redacted,omitzero"`
 }
 
 type AIClassification struct {
@@ -16,14 +21,58 @@ type MessageAttrs struct {
 	Message          SlackMessage     `json:"message,omitzero"`
 	IncidentAction   IncidentAction   `json:"incident_action,omitzero"`
 	AIClassification AIClassification `json:"ai_classification,omitzero"`
+
+	// First human reply in the thread of an open incident.
+	AcknowledgedTs string `json:"acknowledged_ts,omitzero"`
+
+	// Slack user who owns an open incident, set by assigning it.
+	OwnerID string `json:"owner_id,omitzero"`
+
+	// Business impact of an open incident, recorded for postmortems.
+	Impact IncidentImpact `json:"impact,omitzero"`
+
+	// Latest thread message checked for resolution language, so unchanged threads are not re-checked.
+	ResolutionCheckedTs string `json:"resolution_checked_ts,omitzero"`
+
+	// Recorded by ratchet itself (ingested alerts, detected resolutions) rather than posted in
+	// Slack, so never reclassified.
+	Synthetic bool `json:"synthetic,omitzero"`
+}
+
+type IncidentImpact struct {
+	DowntimeMinutes int    `json:"downtime_minutes,omitzero"`
+	AffectedUsers   int    `json:"affected_users,omitzero"`
+	Notes           string `json:"notes,omitzero"`
 }
 
 type ThreadMessageAttrs struct {
 	Message SlackMessage `json:"message,omitzero"`
+
+	// Set on structured incident status updates posted by ratchet.
+	StatusUpdate StatusUpdate `json:"status_update,omitzero"`
+}
+
+// Incident statuses a StatusUpdate can report.
+const (
+	IncidentStatusInvestigating = "investigating"
+	IncidentStatusIdentified    = "identified"
+	IncidentStatusMonitoring    = "monitoring"
+	IncidentStatusResolved      = "resolved"
+)
+
+var IncidentStatuses = []string{IncidentStatusInvestigating, IncidentStatusIdentified, IncidentStatusMonitoring, IncidentStatusResolved}
+
+type StatusUpdate struct {
+	Status string `json:"status"`
+	Impact string `json:"impact,omitzero"`
+	// When responders expect to post the next update, if they committed to one.
+	NextUpdateTs string `json:"next_update_ts,omitzero"`
 }
 
 type RunbookAttrs struct {
 	ServiceName string `json:"service_name"`
 	AlertName   string `json:"alert_name"`
 	Runbook     string `json:"runbook"`
+	// Locale the runbook is written in, empty for English. See llm.RunbookLocale.
+	Locale string `json:"locale,omitzero"`
 }
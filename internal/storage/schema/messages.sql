@@ -1,4 +1,4 @@
--- name: AddMessage :exec
+-- name: AddMessage :execrows
 INSERT INTO
     messages_v2 (channel_id, ts, attrs)
 VALUES
@@ -49,6 +49,21 @@ WHERE
 ORDER BY
     CAST(ts AS numeric) ASC;
 
+-- name: GetMessagesPage :many
+SELECT
+    channel_id,
+    ts,
+    attrs
+FROM
+    messages_v2
+WHERE
+    channel_id = @channel_id
+    AND CAST(ts AS numeric) > CAST(@after_ts :: text AS numeric)
+ORDER BY
+    CAST(ts AS numeric) ASC
+LIMIT
+    @page_size :: int;
+
 -- name: GetMessagesWithinTS :many
 SELECT
     channel_id,
@@ -76,21 +91,39 @@ FROM
 
 -- name: GetAlerts :many
 SELECT
-    alert :: text,
-    service :: text,
-    priority :: text
+    subq.alert :: text,
+    subq.service :: text,
+    subq.priority :: text,
+    COALESCE(u.url, '') :: text AS runbook_url
 FROM
     (
         SELECT
-            DISTINCT attrs -> 'incident_action' ->> 'alert' as alert,
-            attrs -> 'incident_action' ->> 'service' as service,
-            attrs -> 'incident_action' ->> 'priority' as priority
+            MIN(attrs -> 'incident_action' ->> 'service') AS service,
+            attrs -> 'incident_action' ->> 'alert' AS alert,
+            attrs -> 'incident_action' ->> 'priority' AS priority
         FROM
             messages_v2
         WHERE
             channel_id = @channel_id
             AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
-    ) subq;
+            AND (
+                @service :: text = '*'
+                OR attrs -> 'incident_action' ->> 'service' = @service :: text
+                OR (
+                    @normalize :: bool
+                    AND regexp_replace(lower(attrs -> 'incident_action' ->> 'service'), '[-_. ]', '', 'g') = regexp_replace(lower(@service :: text), '[-_. ]', '', 'g')
+                )
+            )
+        GROUP BY
+            CASE
+                WHEN @normalize :: bool THEN regexp_replace(lower(attrs -> 'incident_action' ->> 'service'), '[-_. ]', '', 'g')
+                ELSE attrs -> 'incident_action' ->> 'service'
+            END,
+            attrs -> 'incident_action' ->> 'alert',
+            attrs -> 'incident_action' ->> 'priority'
+    ) subq
+    LEFT JOIN alert_runbook_urls u ON u.service = subq.service
+    AND u.alert = subq.alert;
 
 -- name: GetLatestServiceUpdates :many
 SELECT
@@ -109,4 +142,291 @@ WHERE
 ORDER BY
     CAST(ts AS numeric) DESC
 LIMIT
-    5;
\ No newline at end of file
+    5;
+
+-- name: GetUnresolvedIncidents :many
+SELECT
+    o.channel_id,
+    o.ts,
+    o.attrs
+FROM
+    messages_v2 o
+WHERE
+    o.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND CAST(o.ts AS numeric) BETWEEN CAST(@start_ts :: text AS numeric)
+    AND CAST(@end_ts :: text AS numeric)
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            messages_v2 c
+        WHERE
+            c.channel_id = o.channel_id
+            AND c.attrs -> 'incident_action' ->> 'action' = 'close_incident'
+            AND c.attrs -> 'incident_action' ->> 'service' = o.attrs -> 'incident_action' ->> 'service'
+            AND c.attrs -> 'incident_action' ->> 'alert' = o.attrs -> 'incident_action' ->> 'alert'
+            AND CAST(c.ts AS numeric) > CAST(o.ts AS numeric)
+    )
+ORDER BY
+    CAST(o.ts AS numeric) ASC;
+
+-- name: SetIncidentAcknowledged :exec
+UPDATE
+    messages_v2
+SET
+    attrs = attrs || jsonb_build_object('acknowledged_ts', @ack_ts :: text)
+WHERE
+    channel_id = @channel_id
+    AND ts = @ts
+    AND ts <> @ack_ts :: text
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND (
+        attrs ->> 'acknowledged_ts' IS NULL
+        OR CAST(attrs ->> 'acknowledged_ts' AS numeric) > CAST(@ack_ts :: text AS numeric)
+    );
+
+-- name: GetTimeToAckByService :many
+SELECT
+    service :: text,
+    COUNT(*) FILTER (
+        WHERE
+            acknowledged_ts IS NOT NULL
+    ) :: int AS acked,
+    COUNT(*) FILTER (
+        WHERE
+            acknowledged_ts IS NULL
+    ) :: int AS unacked,
+    COALESCE(
+        AVG(
+            CAST(acknowledged_ts AS numeric) - CAST(ts AS numeric)
+        ),
+        0
+    ) :: float8 AS avg_seconds
+FROM
+    (
+        SELECT
+            attrs -> 'incident_action' ->> 'service' AS service,
+            attrs ->> 'acknowledged_ts' AS acknowledged_ts,
+            ts
+        FROM
+            messages_v2
+        WHERE
+            channel_id = @channel_id
+            AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+            AND ts BETWEEN @start_ts
+            AND @end_ts
+    ) s
+GROUP BY
+    service;
+
+-- name: UpsertMessage :execrows
+INSERT INTO
+    messages_v2 (channel_id, ts, attrs)
+VALUES
+    (@channel_id, @ts, @attrs) ON CONFLICT (channel_id, ts) DO
+UPDATE
+SET
+    attrs = messages_v2.attrs || jsonb_build_object('message', EXCLUDED.attrs -> 'message')
+WHERE
+    COALESCE(EXCLUDED.attrs -> 'message' ->> 'text', '') <> ''
+    AND CAST(COALESCE(EXCLUDED.attrs -> 'message' ->> 'edited_ts', '0') AS numeric) > CAST(COALESCE(messages_v2.attrs -> 'message' ->> 'edited_ts', '0') AS numeric);
+
+-- name: GetIncidentsByPriority :many
+SELECT
+    channel_id,
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    (attrs -> 'incident_action' ->> 'alert') :: text AS alert,
+    COUNT(*) :: int AS count
+FROM
+    messages_v2
+WHERE
+    attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'priority' = @priority :: text
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs -> 'incident_action' ->> 'alert' IS NOT NULL
+    AND ts BETWEEN @start_ts
+    AND @end_ts
+GROUP BY
+    channel_id,
+    service,
+    alert
+ORDER BY
+    count DESC,
+    service,
+    alert,
+    channel_id;
+
+-- name: GetMessageVolumeSeries :many
+SELECT
+    to_char(
+        date_trunc(@bucket :: text, to_timestamp(CAST(ts AS float8)), 'UTC'),
+        'YYYY-MM-DD'
+    ) :: text AS bucket,
+    COUNT(*) :: int AS messages
+FROM
+    messages_v2
+WHERE
+    channel_id = @channel_id
+    AND ts BETWEEN @start_ts
+    AND @end_ts
+    AND (
+        NOT @exclude_bots :: boolean
+        OR COALESCE(attrs -> 'message' ->> 'bot_id', '') = ''
+    )
+GROUP BY
+    bucket
+ORDER BY
+    bucket;
+
+-- name: GetDisappearedAlerts :many
+SELECT
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    (attrs -> 'incident_action' ->> 'alert') :: text AS alert,
+    COUNT(*) :: int AS baseline_count,
+    MAX(ts) :: text AS last_seen_ts
+FROM
+    messages_v2
+WHERE
+    channel_id = @channel_id
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs -> 'incident_action' ->> 'alert' IS NOT NULL
+    AND ts BETWEEN @baseline_start_ts
+    AND @end_ts
+GROUP BY
+    service,
+    alert
+HAVING
+    MAX(ts) < @recent_start_ts :: text
+ORDER BY
+    baseline_count DESC,
+    service,
+    alert;
+
+-- name: GetIncidentsByOwner :many
+SELECT
+    o.channel_id,
+    o.ts,
+    o.attrs
+FROM
+    messages_v2 o
+WHERE
+    o.attrs ->> 'owner_id' = @owner_id :: text
+    AND o.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND o.ts BETWEEN @start_ts
+    AND @end_ts
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            messages_v2 c
+        WHERE
+            c.channel_id = o.channel_id
+            AND c.attrs -> 'incident_action' ->> 'action' = 'close_incident'
+            AND c.attrs -> 'incident_action' ->> 'service' = o.attrs -> 'incident_action' ->> 'service'
+            AND c.attrs -> 'incident_action' ->> 'alert' = o.attrs -> 'incident_action' ->> 'alert'
+            AND CAST(c.ts AS numeric) > CAST(o.ts AS numeric)
+    )
+ORDER BY
+    CAST(o.ts AS numeric) DESC;
+
+-- name: GetImpactByService :many
+SELECT
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    COUNT(*) :: int AS incidents,
+    COALESCE(
+        SUM(CAST(attrs -> 'impact' ->> 'downtime_minutes' AS int)),
+        0
+    ) :: int AS downtime_minutes,
+    COALESCE(
+        SUM(CAST(attrs -> 'impact' ->> 'affected_users' AS int)),
+        0
+    ) :: int AS affected_users
+FROM
+    messages_v2
+WHERE
+    channel_id = @channel_id
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs ? 'impact'
+    AND ts BETWEEN @start_ts
+    AND @end_ts
+GROUP BY
+    service
+ORDER BY
+    downtime_minutes DESC,
+    service;
+
+-- name: SearchMessagesWithHighlights :many
+SELECT
+    ts,
+    ts_headline(
+        'english',
+        attrs -> 'message' ->> 'text',
+        websearch_to_tsquery('english', @query :: text),
+        'MaxFragments=2, MinWords=5, MaxWords=20'
+    ) :: text AS highlight,
+    ts_rank(
+        to_tsvector('english', COALESCE(attrs -> 'message' ->> 'text', '')),
+        websearch_to_tsquery('english', @query :: text)
+    ) :: real AS rank
+FROM
+    messages_v2
+WHERE
+    channel_id = @channel_id
+    AND to_tsvector('english', COALESCE(attrs -> 'message' ->> 'text', '')) @@ websearch_to_tsquery('english', @query :: text)
+ORDER BY
+    rank DESC,
+    CAST(ts AS numeric) DESC
+LIMIT
+    @limit_count :: int;
+
+-- name: GetRelatedIncidents :many
+SELECT
+    r.channel_id,
+    r.ts,
+    r.attrs
+FROM
+    messages_v2 i
+    JOIN messages_v2 r ON r.channel_id <> i.channel_id
+    AND r.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND r.attrs -> 'incident_action' ->> 'service' = i.attrs -> 'incident_action' ->> 'service'
+    AND ABS(CAST(r.ts AS numeric) - CAST(i.ts AS numeric)) <= @window_seconds :: int
+WHERE
+    i.channel_id = @channel_id
+    AND i.ts = @ts
+    AND i.attrs -> 'incident_action' ->> 'service' <> ''
+ORDER BY
+    ABS(CAST(r.ts AS numeric) - CAST(i.ts AS numeric)) ASC;
+
+-- name: AcknowledgeIncidentFromThread :exec
+UPDATE
+    messages_v2 m
+SET
+    attrs = m.attrs || jsonb_build_object('acknowledged_ts', r.ts)
+FROM
+    (
+        SELECT
+            ts
+        FROM
+            thread_messages_v2
+        WHERE
+            channel_id = @channel_id
+            AND parent_ts = @ts
+            AND ts <> @ts
+            AND COALESCE(attrs -> 'message' ->> 'bot_id', '') = ''
+            AND COALESCE(attrs -> 'message' ->> 'user', '') <> ''
+            AND COALESCE(attrs -> 'message' ->> 'subtype', '') = ''
+        ORDER BY
+            CAST(ts AS numeric) ASC
+        LIMIT
+            1
+    ) r
+WHERE
+    m.channel_id = @channel_id
+    AND m.ts = @ts
+    AND m.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND (
+        m.attrs ->> 'acknowledged_ts' IS NULL
+        OR CAST(m.attrs ->> 'acknowledged_ts' AS numeric) > CAST(r.ts AS numeric)
+    );
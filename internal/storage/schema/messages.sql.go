@@ -11,7 +11,50 @@ import (
 	dto "github.com/dynoinc/ratchet/internal/storage/schema/dto"
 )
 
-const addMessage = `-- name: AddMessage :exec
+const acknowledgeIncidentFromThread = `-- name: AcknowledgeIncidentFromThread :exec
+UPDATE
+    messages_v2 m
+SET
+    attrs = m.attrs || jsonb_build_object('acknowledged_ts', r.ts)
+FROM
+    (
+        SELECT
+            ts
+        FROM
+            thread_messages_v2
+        WHERE
+            channel_id = $1
+            AND parent_ts = $2
+            AND ts <> $2
+            AND COALESCE(attrs -> 'message' ->> 'bot_id', '') = ''
+            AND COALESCE(attrs -> 'message' ->> 'user', '') <> ''
+            AND COALESCE(attrs -> 'message' ->> 'subtype', '') = ''
+        ORDER BY
+            CAST(ts AS numeric) ASC
+        LIMIT
+            1
+    ) r
+WHERE
+    m.channel_id = $1
+    AND m.ts = $2
+    AND m.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND (
+        m.attrs ->> 'acknowledged_ts' IS NULL
+        OR CAST(m.attrs ->> 'acknowledged_ts' AS numeric) > CAST(r.ts AS numeric)
+    )
+`
+
+type AcknowledgeIncidentFromThreadParams struct {
+	ChannelID string
+	Ts        string
+}
+
+func (q *Queries) AcknowledgeIncidentFromThread(ctx context.Context, arg AcknowledgeIncidentFromThreadParams) error {
+	_, err := q.db.Exec(ctx, acknowledgeIncidentFromThread, arg.ChannelID, arg.Ts)
+	return err
+}
+
+const addMessage = `-- name: AddMessage :execrows
 INSERT INTO
     messages_v2 (channel_id, ts, attrs)
 VALUES
@@ -24,38 +67,66 @@ type AddMessageParams struct {
 	Attrs     dto.MessageAttrs
 }
 
-func (q *Queries) AddMessage(ctx context.Context, arg AddMessageParams) error {
-	_, err := q.db.Exec(ctx, addMessage, arg.ChannelID, arg.Ts, arg.Attrs)
-	return err
+func (q *Queries) AddMessage(ctx context.Context, arg AddMessageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addMessage, arg.ChannelID, arg.Ts, arg.Attrs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getAlerts = `-- name: GetAlerts :many
 SELECT
-    alert :: text,
-    service :: text,
-    priority :: text
+    subq.alert :: text,
+    subq.service :: text,
+    subq.priority :: text,
+    COALESCE(u.url, '') :: text AS runbook_url
 FROM
     (
         SELECT
-            DISTINCT attrs -> 'incident_action' ->> 'alert' as alert,
-            attrs -> 'incident_action' ->> 'service' as service,
-            attrs -> 'incident_action' ->> 'priority' as priority
+            MIN(attrs -> 'incident_action' ->> 'service') AS service,
+            attrs -> 'incident_action' ->> 'alert' AS alert,
+            attrs -> 'incident_action' ->> 'priority' AS priority
         FROM
             messages_v2
         WHERE
             channel_id = $1
             AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+            AND (
+                $2 :: text = '*'
+                OR attrs -> 'incident_action' ->> 'service' = $2 :: text
+                OR (
+                    $3 :: bool
+                    AND regexp_replace(lower(attrs -> 'incident_action' ->> 'service'), '[-_. ]', '', 'g') = regexp_replace(lower($2 :: text), '[-_. ]', '', 'g')
+                )
+            )
+        GROUP BY
+            CASE
+                WHEN $3 :: bool THEN regexp_replace(lower(attrs -> 'incident_action' ->> 'service'), '[-_. ]', '', 'g')
+                ELSE attrs -> 'incident_action' ->> 'service'
+            END,
+            attrs -> 'incident_action' ->> 'alert',
+            attrs -> 'incident_action' ->> 'priority'
     ) subq
+    LEFT JOIN alert_runbook_urls u ON u.service = subq.service
+    AND u.alert = subq.alert
 `
 
+type GetAlertsParams struct {
+	ChannelID string
+	Service   string
+	Normalize bool
+}
+
 type GetAlertsRow struct {
-	Alert    string
-	Service  string
-	Priority string
+	Alert      string
+	Service    string
+	Priority   string
+	RunbookUrl string
 }
 
-func (q *Queries) GetAlerts(ctx context.Context, channelID string) ([]GetAlertsRow, error) {
-	rows, err := q.db.Query(ctx, getAlerts, channelID)
+func (q *Queries) GetAlerts(ctx context.Context, arg GetAlertsParams) ([]GetAlertsRow, error) {
+	rows, err := q.db.Query(ctx, getAlerts, arg.ChannelID, arg.Service, arg.Normalize)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +134,12 @@ func (q *Queries) GetAlerts(ctx context.Context, channelID string) ([]GetAlertsR
 	var items []GetAlertsRow
 	for rows.Next() {
 		var i GetAlertsRow
-		if err := rows.Scan(&i.Alert, &i.Service, &i.Priority); err != nil {
+		if err := rows.Scan(
+			&i.Alert,
+			&i.Service,
+			&i.Priority,
+			&i.RunbookUrl,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -147,6 +223,260 @@ func (q *Queries) GetAllOpenIncidentMessages(ctx context.Context, arg GetAllOpen
 	return items, nil
 }
 
+const getDisappearedAlerts = `-- name: GetDisappearedAlerts :many
+SELECT
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    (attrs -> 'incident_action' ->> 'alert') :: text AS alert,
+    COUNT(*) :: int AS baseline_count,
+    MAX(ts) :: text AS last_seen_ts
+FROM
+    messages_v2
+WHERE
+    channel_id = $1
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs -> 'incident_action' ->> 'alert' IS NOT NULL
+    AND ts BETWEEN $2
+    AND $3
+GROUP BY
+    service,
+    alert
+HAVING
+    MAX(ts) < $4 :: text
+ORDER BY
+    baseline_count DESC,
+    service,
+    alert
+`
+
+type GetDisappearedAlertsParams struct {
+	ChannelID       string
+	BaselineStartTs string
+	EndTs           string
+	RecentStartTs   string
+}
+
+type GetDisappearedAlertsRow struct {
+	Service       string
+	Alert         string
+	BaselineCount int32
+	LastSeenTs    string
+}
+
+func (q *Queries) GetDisappearedAlerts(ctx context.Context, arg GetDisappearedAlertsParams) ([]GetDisappearedAlertsRow, error) {
+	rows, err := q.db.Query(ctx, getDisappearedAlerts,
+		arg.ChannelID,
+		arg.BaselineStartTs,
+		arg.EndTs,
+		arg.RecentStartTs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDisappearedAlertsRow
+	for rows.Next() {
+		var i GetDisappearedAlertsRow
+		if err := rows.Scan(
+			&i.Service,
+			&i.Alert,
+			&i.BaselineCount,
+			&i.LastSeenTs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getImpactByService = `-- name: GetImpactByService :many
+SELECT
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    COUNT(*) :: int AS incidents,
+    COALESCE(
+        SUM(CAST(attrs -> 'impact' ->> 'downtime_minutes' AS int)),
+        0
+    ) :: int AS downtime_minutes,
+    COALESCE(
+        SUM(CAST(attrs -> 'impact' ->> 'affected_users' AS int)),
+        0
+    ) :: int AS affected_users
+FROM
+    messages_v2
+WHERE
+    channel_id = $1
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs ? 'impact'
+    AND ts BETWEEN $2
+    AND $3
+GROUP BY
+    service
+ORDER BY
+    downtime_minutes DESC,
+    service
+`
+
+type GetImpactByServiceParams struct {
+	ChannelID string
+	StartTs   string
+	EndTs     string
+}
+
+type GetImpactByServiceRow struct {
+	Service         string
+	Incidents       int32
+	DowntimeMinutes int32
+	AffectedUsers   int32
+}
+
+func (q *Queries) GetImpactByService(ctx context.Context, arg GetImpactByServiceParams) ([]GetImpactByServiceRow, error) {
+	rows, err := q.db.Query(ctx, getImpactByService, arg.ChannelID, arg.StartTs, arg.EndTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetImpactByServiceRow
+	for rows.Next() {
+		var i GetImpactByServiceRow
+		if err := rows.Scan(
+			&i.Service,
+			&i.Incidents,
+			&i.DowntimeMinutes,
+			&i.AffectedUsers,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIncidentsByOwner = `-- name: GetIncidentsByOwner :many
+SELECT
+    o.channel_id,
+    o.ts,
+    o.attrs
+FROM
+    messages_v2 o
+WHERE
+    o.attrs ->> 'owner_id' = $1 :: text
+    AND o.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND o.ts BETWEEN $2
+    AND $3
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            messages_v2 c
+        WHERE
+            c.channel_id = o.channel_id
+            AND c.attrs -> 'incident_action' ->> 'action' = 'close_incident'
+            AND c.attrs -> 'incident_action' ->> 'service' = o.attrs -> 'incident_action' ->> 'service'
+            AND c.attrs -> 'incident_action' ->> 'alert' = o.attrs -> 'incident_action' ->> 'alert'
+            AND CAST(c.ts AS numeric) > CAST(o.ts AS numeric)
+    )
+ORDER BY
+    CAST(o.ts AS numeric) DESC
+`
+
+type GetIncidentsByOwnerParams struct {
+	OwnerID string
+	StartTs string
+	EndTs   string
+}
+
+func (q *Queries) GetIncidentsByOwner(ctx context.Context, arg GetIncidentsByOwnerParams) ([]MessagesV2, error) {
+	rows, err := q.db.Query(ctx, getIncidentsByOwner, arg.OwnerID, arg.StartTs, arg.EndTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessagesV2
+	for rows.Next() {
+		var i MessagesV2
+		if err := rows.Scan(&i.ChannelID, &i.Ts, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIncidentsByPriority = `-- name: GetIncidentsByPriority :many
+SELECT
+    channel_id,
+    (attrs -> 'incident_action' ->> 'service') :: text AS service,
+    (attrs -> 'incident_action' ->> 'alert') :: text AS alert,
+    COUNT(*) :: int AS count
+FROM
+    messages_v2
+WHERE
+    attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND attrs -> 'incident_action' ->> 'priority' = $1 :: text
+    AND attrs -> 'incident_action' ->> 'service' IS NOT NULL
+    AND attrs -> 'incident_action' ->> 'alert' IS NOT NULL
+    AND ts BETWEEN $2
+    AND $3
+GROUP BY
+    channel_id,
+    service,
+    alert
+ORDER BY
+    count DESC,
+    service,
+    alert,
+    channel_id
+`
+
+type GetIncidentsByPriorityParams struct {
+	Priority string
+	StartTs  string
+	EndTs    string
+}
+
+type GetIncidentsByPriorityRow struct {
+	ChannelID string
+	Service   string
+	Alert     string
+	Count     int32
+}
+
+func (q *Queries) GetIncidentsByPriority(ctx context.Context, arg GetIncidentsByPriorityParams) ([]GetIncidentsByPriorityRow, error) {
+	rows, err := q.db.Query(ctx, getIncidentsByPriority, arg.Priority, arg.StartTs, arg.EndTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetIncidentsByPriorityRow
+	for rows.Next() {
+		var i GetIncidentsByPriorityRow
+		if err := rows.Scan(
+			&i.ChannelID,
+			&i.Service,
+			&i.Alert,
+			&i.Count,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLatestServiceUpdates = `-- name: GetLatestServiceUpdates :many
 SELECT
     channel_id,
@@ -211,6 +541,110 @@ func (q *Queries) GetMessage(ctx context.Context, arg GetMessageParams) (Message
 	return i, err
 }
 
+const getMessageVolumeSeries = `-- name: GetMessageVolumeSeries :many
+SELECT
+    to_char(
+        date_trunc($1 :: text, to_timestamp(CAST(ts AS float8)), 'UTC'),
+        'YYYY-MM-DD'
+    ) :: text AS bucket,
+    COUNT(*) :: int AS messages
+FROM
+    messages_v2
+WHERE
+    channel_id = $2
+    AND ts BETWEEN $3
+    AND $4
+    AND (
+        NOT $5 :: boolean
+        OR COALESCE(attrs -> 'message' ->> 'bot_id', '') = ''
+    )
+GROUP BY
+    bucket
+ORDER BY
+    bucket
+`
+
+type GetMessageVolumeSeriesParams struct {
+	Bucket      string
+	ChannelID   string
+	StartTs     string
+	EndTs       string
+	ExcludeBots bool
+}
+
+type GetMessageVolumeSeriesRow struct {
+	Bucket   string
+	Messages int32
+}
+
+func (q *Queries) GetMessageVolumeSeries(ctx context.Context, arg GetMessageVolumeSeriesParams) ([]GetMessageVolumeSeriesRow, error) {
+	rows, err := q.db.Query(ctx, getMessageVolumeSeries,
+		arg.Bucket,
+		arg.ChannelID,
+		arg.StartTs,
+		arg.EndTs,
+		arg.ExcludeBots,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessageVolumeSeriesRow
+	for rows.Next() {
+		var i GetMessageVolumeSeriesRow
+		if err := rows.Scan(&i.Bucket, &i.Messages); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesPage = `-- name: GetMessagesPage :many
+SELECT
+    channel_id,
+    ts,
+    attrs
+FROM
+    messages_v2
+WHERE
+    channel_id = $1
+    AND CAST(ts AS numeric) > CAST($2 :: text AS numeric)
+ORDER BY
+    CAST(ts AS numeric) ASC
+LIMIT
+    $3 :: int
+`
+
+type GetMessagesPageParams struct {
+	ChannelID string
+	AfterTs   string
+	PageSize  int32
+}
+
+func (q *Queries) GetMessagesPage(ctx context.Context, arg GetMessagesPageParams) ([]MessagesV2, error) {
+	rows, err := q.db.Query(ctx, getMessagesPage, arg.ChannelID, arg.AfterTs, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessagesV2
+	for rows.Next() {
+		var i MessagesV2
+		if err := rows.Scan(&i.ChannelID, &i.Ts, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMessagesWithinTS = `-- name: GetMessagesWithinTS :many
 SELECT
     channel_id,
@@ -250,6 +684,51 @@ func (q *Queries) GetMessagesWithinTS(ctx context.Context, arg GetMessagesWithin
 	return items, nil
 }
 
+const getRelatedIncidents = `-- name: GetRelatedIncidents :many
+SELECT
+    r.channel_id,
+    r.ts,
+    r.attrs
+FROM
+    messages_v2 i
+    JOIN messages_v2 r ON r.channel_id <> i.channel_id
+    AND r.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND r.attrs -> 'incident_action' ->> 'service' = i.attrs -> 'incident_action' ->> 'service'
+    AND ABS(CAST(r.ts AS numeric) - CAST(i.ts AS numeric)) <= $1 :: int
+WHERE
+    i.channel_id = $2
+    AND i.ts = $3
+    AND i.attrs -> 'incident_action' ->> 'service' <> ''
+ORDER BY
+    ABS(CAST(r.ts AS numeric) - CAST(i.ts AS numeric)) ASC
+`
+
+type GetRelatedIncidentsParams struct {
+	WindowSeconds int32
+	ChannelID     string
+	Ts            string
+}
+
+func (q *Queries) GetRelatedIncidents(ctx context.Context, arg GetRelatedIncidentsParams) ([]MessagesV2, error) {
+	rows, err := q.db.Query(ctx, getRelatedIncidents, arg.WindowSeconds, arg.ChannelID, arg.Ts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessagesV2
+	for rows.Next() {
+		var i MessagesV2
+		if err := rows.Scan(&i.ChannelID, &i.Ts, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getServices = `-- name: GetServices :many
 SELECT
     service :: text
@@ -284,6 +763,215 @@ func (q *Queries) GetServices(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
+const getTimeToAckByService = `-- name: GetTimeToAckByService :many
+SELECT
+    service :: text,
+    COUNT(*) FILTER (
+        WHERE
+            acknowledged_ts IS NOT NULL
+    ) :: int AS acked,
+    COUNT(*) FILTER (
+        WHERE
+            acknowledged_ts IS NULL
+    ) :: int AS unacked,
+    COALESCE(
+        AVG(
+            CAST(acknowledged_ts AS numeric) - CAST(ts AS numeric)
+        ),
+        0
+    ) :: float8 AS avg_seconds
+FROM
+    (
+        SELECT
+            attrs -> 'incident_action' ->> 'service' AS service,
+            attrs ->> 'acknowledged_ts' AS acknowledged_ts,
+            ts
+        FROM
+            messages_v2
+        WHERE
+            channel_id = $1
+            AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+            AND ts BETWEEN $2
+            AND $3
+    ) s
+GROUP BY
+    service
+`
+
+type GetTimeToAckByServiceParams struct {
+	ChannelID string
+	StartTs   string
+	EndTs     string
+}
+
+type GetTimeToAckByServiceRow struct {
+	Service    string
+	Acked      int32
+	Unacked    int32
+	AvgSeconds float64
+}
+
+func (q *Queries) GetTimeToAckByService(ctx context.Context, arg GetTimeToAckByServiceParams) ([]GetTimeToAckByServiceRow, error) {
+	rows, err := q.db.Query(ctx, getTimeToAckByService, arg.ChannelID, arg.StartTs, arg.EndTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTimeToAckByServiceRow
+	for rows.Next() {
+		var i GetTimeToAckByServiceRow
+		if err := rows.Scan(
+			&i.Service,
+			&i.Acked,
+			&i.Unacked,
+			&i.AvgSeconds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnresolvedIncidents = `-- name: GetUnresolvedIncidents :many
+SELECT
+    o.channel_id,
+    o.ts,
+    o.attrs
+FROM
+    messages_v2 o
+WHERE
+    o.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND CAST(o.ts AS numeric) BETWEEN CAST($1 :: text AS numeric)
+    AND CAST($2 :: text AS numeric)
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            messages_v2 c
+        WHERE
+            c.channel_id = o.channel_id
+            AND c.attrs -> 'incident_action' ->> 'action' = 'close_incident'
+            AND c.attrs -> 'incident_action' ->> 'service' = o.attrs -> 'incident_action' ->> 'service'
+            AND c.attrs -> 'incident_action' ->> 'alert' = o.attrs -> 'incident_action' ->> 'alert'
+            AND CAST(c.ts AS numeric) > CAST(o.ts AS numeric)
+    )
+ORDER BY
+    CAST(o.ts AS numeric) ASC
+`
+
+type GetUnresolvedIncidentsParams struct {
+	StartTs string
+	EndTs   string
+}
+
+func (q *Queries) GetUnresolvedIncidents(ctx context.Context, arg GetUnresolvedIncidentsParams) ([]MessagesV2, error) {
+	rows, err := q.db.Query(ctx, getUnresolvedIncidents, arg.StartTs, arg.EndTs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessagesV2
+	for rows.Next() {
+		var i MessagesV2
+		if err := rows.Scan(&i.ChannelID, &i.Ts, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchMessagesWithHighlights = `-- name: SearchMessagesWithHighlights :many
+SELECT
+    ts,
+    ts_headline(
+        'english',
+        attrs -> 'message' ->> 'text',
+        websearch_to_tsquery('english', $1 :: text),
+        'MaxFragments=2, MinWords=5, MaxWords=20'
+    ) :: text AS highlight,
+    ts_rank(
+        to_tsvector('english', COALESCE(attrs -> 'message' ->> 'text', '')),
+        websearch_to_tsquery('english', $1 :: text)
+    ) :: real AS rank
+FROM
+    messages_v2
+WHERE
+    channel_id = $2
+    AND to_tsvector('english', COALESCE(attrs -> 'message' ->> 'text', '')) @@ websearch_to_tsquery('english', $1 :: text)
+ORDER BY
+    rank DESC,
+    CAST(ts AS numeric) DESC
+LIMIT
+    $3 :: int
+`
+
+type SearchMessagesWithHighlightsParams struct {
+	Query      string
+	ChannelID  string
+	LimitCount int32
+}
+
+type SearchMessagesWithHighlightsRow struct {
+	Ts        string
+	Highlight string
+	Rank      float32
+}
+
+func (q *Queries) SearchMessagesWithHighlights(ctx context.Context, arg SearchMessagesWithHighlightsParams) ([]SearchMessagesWithHighlightsRow, error) {
+	rows, err := q.db.Query(ctx, searchMessagesWithHighlights, arg.Query, arg.ChannelID, arg.LimitCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchMessagesWithHighlightsRow
+	for rows.Next() {
+		var i SearchMessagesWithHighlightsRow
+		if err := rows.Scan(&i.Ts, &i.Highlight, &i.Rank); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setIncidentAcknowledged = `-- name: SetIncidentAcknowledged :exec
+UPDATE
+    messages_v2
+SET
+    attrs = attrs || jsonb_build_object('acknowledged_ts', $1 :: text)
+WHERE
+    channel_id = $2
+    AND ts = $3
+    AND ts <> $1 :: text
+    AND attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND (
+        attrs ->> 'acknowledged_ts' IS NULL
+        OR CAST(attrs ->> 'acknowledged_ts' AS numeric) > CAST($1 :: text AS numeric)
+    )
+`
+
+type SetIncidentAcknowledgedParams struct {
+	AckTs     string
+	ChannelID string
+	Ts        string
+}
+
+func (q *Queries) SetIncidentAcknowledged(ctx context.Context, arg SetIncidentAcknowledgedParams) error {
+	_, err := q.db.Exec(ctx, setIncidentAcknowledged, arg.AckTs, arg.ChannelID, arg.Ts)
+	return err
+}
+
 const updateMessageAttrs = `-- name: UpdateMessageAttrs :exec
 UPDATE
     messages_v2
@@ -304,3 +992,30 @@ func (q *Queries) UpdateMessageAttrs(ctx context.Context, arg UpdateMessageAttrs
 	_, err := q.db.Exec(ctx, updateMessageAttrs, arg.Attrs, arg.ChannelID, arg.Ts)
 	return err
 }
+
+const upsertMessage = `-- name: UpsertMessage :execrows
+INSERT INTO
+    messages_v2 (channel_id, ts, attrs)
+VALUES
+    ($1, $2, $3) ON CONFLICT (channel_id, ts) DO
+UPDATE
+SET
+    attrs = messages_v2.attrs || jsonb_build_object('message', EXCLUDED.attrs -> 'message')
+WHERE
+    COALESCE(EXCLUDED.attrs -> 'message' ->> 'text', '') <> ''
+    AND CAST(COALESCE(EXCLUDED.attrs -> 'message' ->> 'edited_ts', '0') AS numeric) > CAST(COALESCE(messages_v2.attrs -> 'message' ->> 'edited_ts', '0') AS numeric)
+`
+
+type UpsertMessageParams struct {
+	ChannelID string
+	Ts        string
+	Attrs     dto.MessageAttrs
+}
+
+func (q *Queries) UpsertMessage(ctx context.Context, arg UpsertMessageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, upsertMessage, arg.ChannelID, arg.Ts, arg.Attrs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
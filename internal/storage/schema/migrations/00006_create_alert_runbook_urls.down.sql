@@ -0,0 +1 @@
+DROP TABLE IF EXISTS alert_runbook_urls;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS alert_runbook_urls (
+    service TEXT NOT NULL,
+    alert TEXT NOT NULL,
+    url TEXT NOT NULL,
+    PRIMARY KEY (service, alert)
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS messages_v2_tsvec_idx;
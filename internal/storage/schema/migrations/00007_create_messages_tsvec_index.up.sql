@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS messages_v2_tsvec_idx ON messages_v2 USING GIN (
+    to_tsvector('english', COALESCE(attrs -> 'message' ->> 'text', ''))
+);
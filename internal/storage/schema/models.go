@@ -8,6 +8,12 @@ import (
 	dto "github.com/dynoinc/ratchet/internal/storage/schema/dto"
 )
 
+type AlertRunbookUrl struct {
+	Service string
+	Alert   string
+	Url     string
+}
+
 type ChannelsV2 struct {
 	ID    string
 	Attrs dto.ChannelAttrs
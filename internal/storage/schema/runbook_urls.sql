@@ -0,0 +1,17 @@
+-- name: SetAlertRunbookURL :exec
+INSERT INTO
+    alert_runbook_urls (service, alert, url)
+VALUES
+    (@service, @alert, @url) ON CONFLICT (service, alert) DO
+UPDATE
+SET
+    url = EXCLUDED.url;
+
+-- name: GetAlertRunbookURL :one
+SELECT
+    url
+FROM
+    alert_runbook_urls
+WHERE
+    service = @service
+    AND alert = @alert;
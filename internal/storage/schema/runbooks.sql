@@ -13,7 +13,24 @@ FROM
 WHERE
     attrs ->> 'service_name' = @service_name :: text
     AND attrs ->> 'alert_name' = @alert_name :: text
+    AND COALESCE(attrs ->> 'locale', '') = @locale :: text
 ORDER BY
     id DESC
 LIMIT
-    1;
\ No newline at end of file
+    1;
+
+-- name: GetLatestRunbooks :many
+SELECT
+    DISTINCT ON (
+        attrs ->> 'service_name',
+        attrs ->> 'alert_name',
+        COALESCE(attrs ->> 'locale', '')
+    ) id,
+    attrs
+FROM
+    incident_runbooks
+ORDER BY
+    attrs ->> 'service_name',
+    attrs ->> 'alert_name',
+    COALESCE(attrs ->> 'locale', ''),
+    id DESC;
@@ -25,6 +25,43 @@ func (q *Queries) CreateRunbook(ctx context.Context, attrs dto.RunbookAttrs) (in
 	return id, err
 }
 
+const getLatestRunbooks = `-- name: GetLatestRunbooks :many
+SELECT
+    DISTINCT ON (
+        attrs ->> 'service_name',
+        attrs ->> 'alert_name',
+        COALESCE(attrs ->> 'locale', '')
+    ) id,
+    attrs
+FROM
+    incident_runbooks
+ORDER BY
+    attrs ->> 'service_name',
+    attrs ->> 'alert_name',
+    COALESCE(attrs ->> 'locale', ''),
+    id DESC
+`
+
+func (q *Queries) GetLatestRunbooks(ctx context.Context) ([]IncidentRunbook, error) {
+	rows, err := q.db.Query(ctx, getLatestRunbooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IncidentRunbook
+	for rows.Next() {
+		var i IncidentRunbook
+		if err := rows.Scan(&i.ID, &i.Attrs); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRunbook = `-- name: GetRunbook :one
 SELECT
     id,
@@ -34,6 +71,7 @@ FROM
 WHERE
     attrs ->> 'service_name' = $1 :: text
     AND attrs ->> 'alert_name' = $2 :: text
+    AND COALESCE(attrs ->> 'locale', '') = $3 :: text
 ORDER BY
     id DESC
 LIMIT
@@ -43,10 +81,11 @@ LIMIT
 type GetRunbookParams struct {
 	ServiceName string
 	AlertName   string
+	Locale      string
 }
 
 func (q *Queries) GetRunbook(ctx context.Context, arg GetRunbookParams) (IncidentRunbook, error) {
-	row := q.db.QueryRow(ctx, getRunbook, arg.ServiceName, arg.AlertName)
+	row := q.db.QueryRow(ctx, getRunbook, arg.ServiceName, arg.AlertName, arg.Locale)
 	var i IncidentRunbook
 	err := row.Scan(&i.ID, &i.Attrs)
 	return i, err
@@ -11,7 +11,55 @@ SELECT
     ts,
     attrs
 FROM
-    thread_messages_v2
+    (
+        SELECT
+            channel_id,
+            parent_ts,
+            ts,
+            attrs
+        FROM
+            thread_messages_v2
+        WHERE
+            channel_id = @channel_id
+            AND parent_ts = @parent_ts
+        ORDER BY
+            CAST(ts AS numeric) DESC
+        LIMIT
+            NULLIF(@max_messages :: int, 0)
+    ) AS latest
+ORDER BY
+    CAST(ts AS numeric) ASC;
+
+-- name: GetTopRespondersByService :many
+SELECT
+    (t.attrs -> 'message' ->> 'user') :: text AS user_id,
+    COUNT(*) :: int AS replies,
+    COUNT(DISTINCT (t.channel_id, t.parent_ts)) :: int AS incidents
+FROM
+    thread_messages_v2 t
+    JOIN messages_v2 m ON m.channel_id = t.channel_id
+    AND m.ts = t.parent_ts
 WHERE
-    channel_id = @channel_id
-    AND parent_ts = @parent_ts;
\ No newline at end of file
+    m.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND m.attrs -> 'incident_action' ->> 'service' = @service :: text
+    AND CAST(m.ts AS numeric) BETWEEN CAST(@start_ts :: text AS numeric)
+    AND CAST(@end_ts :: text AS numeric)
+    AND COALESCE(t.attrs -> 'message' ->> 'bot_id', '') = ''
+    AND COALESCE(t.attrs -> 'message' ->> 'subtype', '') = ''
+    AND COALESCE(t.attrs -> 'message' ->> 'user', '') <> ''
+GROUP BY
+    user_id
+ORDER BY
+    replies DESC,
+    user_id ASC
+LIMIT
+    NULLIF(@max_responders :: int, 0);
+
+-- name: UpsertStatusUpdate :exec
+INSERT INTO
+    thread_messages_v2 (channel_id, parent_ts, ts, attrs)
+VALUES
+    (@channel_id, @parent_ts, @ts, @attrs) ON CONFLICT (channel_id, parent_ts, ts) DO
+UPDATE
+SET
+    attrs = thread_messages_v2.attrs || jsonb_build_object('status_update', EXCLUDED.attrs -> 'status_update');
@@ -42,19 +42,34 @@ SELECT
     ts,
     attrs
 FROM
-    thread_messages_v2
-WHERE
-    channel_id = $1
-    AND parent_ts = $2
+    (
+        SELECT
+            channel_id,
+            parent_ts,
+            ts,
+            attrs
+        FROM
+            thread_messages_v2
+        WHERE
+            channel_id = $1
+            AND parent_ts = $2
+        ORDER BY
+            CAST(ts AS numeric) DESC
+        LIMIT
+            NULLIF($3 :: int, 0)
+    ) AS latest
+ORDER BY
+    CAST(ts AS numeric) ASC
 `
 
 type GetThreadMessagesParams struct {
-	ChannelID string
-	ParentTs  string
+	ChannelID   string
+	ParentTs    string
+	MaxMessages int32
 }
 
 func (q *Queries) GetThreadMessages(ctx context.Context, arg GetThreadMessagesParams) ([]ThreadMessagesV2, error) {
-	rows, err := q.db.Query(ctx, getThreadMessages, arg.ChannelID, arg.ParentTs)
+	rows, err := q.db.Query(ctx, getThreadMessages, arg.ChannelID, arg.ParentTs, arg.MaxMessages)
 	if err != nil {
 		return nil, err
 	}
@@ -77,3 +92,94 @@ func (q *Queries) GetThreadMessages(ctx context.Context, arg GetThreadMessagesPa
 	}
 	return items, nil
 }
+
+const getTopRespondersByService = `-- name: GetTopRespondersByService :many
+SELECT
+    (t.attrs -> 'message' ->> 'user') :: text AS user_id,
+    COUNT(*) :: int AS replies,
+    COUNT(DISTINCT (t.channel_id, t.parent_ts)) :: int AS incidents
+FROM
+    thread_messages_v2 t
+    JOIN messages_v2 m ON m.channel_id = t.channel_id
+    AND m.ts = t.parent_ts
+WHERE
+    m.attrs -> 'incident_action' ->> 'action' = 'open_incident'
+    AND m.attrs -> 'incident_action' ->> 'service' = $1 :: text
+    AND CAST(m.ts AS numeric) BETWEEN CAST($2 :: text AS numeric)
+    AND CAST($3 :: text AS numeric)
+    AND COALESCE(t.attrs -> 'message' ->> 'bot_id', '') = ''
+    AND COALESCE(t.attrs -> 'message' ->> 'subtype', '') = ''
+    AND COALESCE(t.attrs -> 'message' ->> 'user', '') <> ''
+GROUP BY
+    user_id
+ORDER BY
+    replies DESC,
+    user_id ASC
+LIMIT
+    NULLIF($4 :: int, 0)
+`
+
+type GetTopRespondersByServiceParams struct {
+	Service       string
+	StartTs       string
+	EndTs         string
+	MaxResponders int32
+}
+
+type GetTopRespondersByServiceRow struct {
+	UserID    string
+	Replies   int32
+	Incidents int32
+}
+
+func (q *Queries) GetTopRespondersByService(ctx context.Context, arg GetTopRespondersByServiceParams) ([]GetTopRespondersByServiceRow, error) {
+	rows, err := q.db.Query(ctx, getTopRespondersByService,
+		arg.Service,
+		arg.StartTs,
+		arg.EndTs,
+		arg.MaxResponders,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopRespondersByServiceRow
+	for rows.Next() {
+		var i GetTopRespondersByServiceRow
+		if err := rows.Scan(&i.UserID, &i.Replies, &i.Incidents); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertStatusUpdate = `-- name: UpsertStatusUpdate :exec
+INSERT INTO
+    thread_messages_v2 (channel_id, parent_ts, ts, attrs)
+VALUES
+    ($1, $2, $3, $4) ON CONFLICT (channel_id, parent_ts, ts) DO
+UPDATE
+SET
+    attrs = thread_messages_v2.attrs || jsonb_build_object('status_update', EXCLUDED.attrs -> 'status_update')
+`
+
+type UpsertStatusUpdateParams struct {
+	ChannelID string
+	ParentTs  string
+	Ts        string
+	Attrs     dto.ThreadMessageAttrs
+}
+
+func (q *Queries) UpsertStatusUpdate(ctx context.Context, arg UpsertStatusUpdateParams) error {
+	_, err := q.db.Exec(ctx, upsertStatusUpdate,
+		arg.ChannelID,
+		arg.ParentTs,
+		arg.Ts,
+		arg.Attrs,
+	)
+	return err
+}
@@ -0,0 +1,29 @@
+// Package storagetest starts throwaway databases for tests.
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/dynoinc/ratchet/internal/storage"
+)
+
+// NewDB starts a PostgreSQL container with the schema migrated, and stops it when the test ends.
+func NewDB(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	postgresContainer, err := postgres.Run(ctx, storage.PostgresImage, postgres.BasicWaitStrategies())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = postgresContainer.Stop(ctx, nil) })
+
+	db, err := storage.New(ctx, postgresContainer.MustConnectionString(ctx, "sslmode=disable"))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+
+	return db
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+)
+
+// parseSince accepts a Slack ts or an RFC 3339 time.
+func parseSince(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	return internal.TsToTime(v)
+}
+
+// catchUp summarizes what happened in the channel since the given time, for someone who was away.
+func (h *httpHandlers) catchUp(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	v := r.URL.Query().Get("since")
+	since, err := parseSince(v)
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid since: %q, expected a Slack ts or RFC 3339 time", v)}
+	}
+
+	end := time.Now()
+	msgs, err := schema.New(h.db).GetMessagesWithinTS(r.Context(), schema.GetMessagesWithinTSParams{
+		ChannelID: channel.ID,
+		StartTs:   internal.TimeToTs(since),
+		EndTs:     internal.TimeToTs(end),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting messages for channel %s: %w", channel.ID, err)
+	}
+
+	var permalink func(ts string) string
+	if h.permalink != nil {
+		permalink = func(ts string) string { return h.permalink(channel.ID, ts) }
+	}
+
+	summary, err := h.summarizer.SummarizeChannel(r.Context(), msgs, permalink)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		Messages int    `json:"messages"`
+		Summary  string `json:"summary"`
+	}{
+		Messages: len(msgs),
+		Summary:  summary,
+	}, nil
+}
@@ -7,29 +7,119 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/carlmjohnson/versioninfo"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/riverqueue/river"
+	"github.com/slack-go/slack"
 	"riverqueue.com/riverui"
 
+	"github.com/dynoinc/ratchet/internal"
 	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/background/report_worker"
+	"github.com/dynoinc/ratchet/internal/llm"
 	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
 )
 
+// ReportPreviewer renders a channel's report without posting it.
+type ReportPreviewer interface {
+	Preview(ctx context.Context, channelID string) ([]slack.Block, error)
+}
+
+// ChannelSummarizer writes a digest of a channel's messages.
+type ChannelSummarizer interface {
+	SummarizeChannel(ctx context.Context, msgs []schema.MessagesV2, permalink func(ts string) string) (string, error)
+}
+
+// ChannelLister lists the Slack channels the bot is a member of.
+type ChannelLister interface {
+	BotChannels(ctx context.Context) ([]slack.Channel, error)
+}
+
+// ChannelSettings is the configuration in effect for a channel.
+type ChannelSettings struct {
+	ChannelID        string               `json:"channel_id"`
+	Name             string               `json:"name"`
+	OnboardingStatus dto.OnboardingStatus `json:"onboarding_status"`
+	Archived         bool                 `json:"archived"`
+	// BCP 47 locale runbooks are written in. Empty means English.
+	Locale string `json:"locale"`
+	// Whether the bot posts in the channel, per RATCHET_SLACK_ALLOWED_CHANNELS. Never for
+	// archived channels.
+	Allowed bool `json:"allowed"`
+	// Sections of the channel's weekly report, in order.
+	ReportSections []string `json:"report_sections"`
+
+	SlackMaxMessageLength      int    `json:"slack_max_message_length"`
+	SlackBroadcastRunbook      bool   `json:"slack_broadcast_runbook"`
+	SlackBlocks                bool   `json:"slack_blocks"`
+	ReportAttachment           string `json:"report_attachment"`
+	ReportDedupWindow          string `json:"report_dedup_window"`
+	ReportMessagesLimit        int    `json:"report_messages_limit"`
+	ReportThreadMessagesLimit  int    `json:"report_thread_messages_limit"`
+	RunbookThreadMessagesLimit int    `json:"runbook_thread_messages_limit"`
+}
+
 type httpHandlers struct {
 	db          *pgxpool.Pool
 	riverClient *river.Client[pgx.Tx]
+	bot         *internal.Bot
+	reports     ReportPreviewer
+	summarizer  ChannelSummarizer
+	channels    ChannelLister
+	// permalink links to a Slack message. Nil leaves summaries unlinked.
+	permalink func(channelID, ts string) string
+	// Settings every channel starts from.
+	defaults ChannelSettings
+
+	ingestSecret string
+}
+
+// httpError is an error carrying the HTTP status code to respond with.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+// parseDays returns the ?days query parameter, or def if it is not set.
+func parseDays(r *http.Request, def int) (int, error) {
+	v := r.URL.Query().Get("days")
+	if v == "" {
+		return def, nil
+	}
+
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return 0, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid days: %q", v)}
+	}
+	return days, nil
 }
 
 func handleJSON(handler func(*http.Request) (any, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		result, err := handler(r)
 		if err != nil {
+			var httpErr httpError
+			if errors.As(err, &httpErr) {
+				http.Error(w, httpErr.Error(), httpErr.code)
+				return
+			}
+
 			if errors.Is(err, pgx.ErrNoRows) {
 				http.Error(w, err.Error(), http.StatusNotFound)
 				return
@@ -56,10 +146,24 @@ func New(
 	ctx context.Context,
 	db *pgxpool.Pool,
 	riverClient *river.Client[pgx.Tx],
+	bot *internal.Bot,
+	reports ReportPreviewer,
+	summarizer ChannelSummarizer,
+	channels ChannelLister,
+	permalink func(channelID, ts string) string,
+	defaults ChannelSettings,
+	ingestSecret string,
 ) (http.Handler, error) {
 	handlers := &httpHandlers{
-		db:          db,
-		riverClient: riverClient,
+		db:           db,
+		riverClient:  riverClient,
+		bot:          bot,
+		reports:      reports,
+		summarizer:   summarizer,
+		channels:     channels,
+		permalink:    permalink,
+		defaults:     defaults,
+		ingestSecret: ingestSecret,
 	}
 
 	// River UI
@@ -80,12 +184,33 @@ func New(
 	// API
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("GET /channels", handleJSON(handlers.listChannels))
+	apiMux.HandleFunc("POST /channels/onboard-bulk", handleJSON(handlers.onboardChannels))
 	apiMux.HandleFunc("GET /channels/{channel_name}/alerts", handleJSON(handlers.listAlerts))
-	apiMux.HandleFunc("GET /channels/{channel_name}/messages", handleJSON(handlers.listMessages))
+	apiMux.HandleFunc("GET /channels/{channel_name}/catch-up", handleJSON(handlers.catchUp))
+	apiMux.HandleFunc("GET /channels/{channel_name}/messages", handlers.messages)
 	apiMux.HandleFunc("GET /channels/{channel_name}/report", handleJSON(handlers.generateReport))
+	apiMux.HandleFunc("GET /channels/{channel_name}/report/preview", handleJSON(handlers.previewReport))
+	apiMux.HandleFunc("PUT /channels/{channel_name}/report/sections", handleJSON(handlers.setReportSections))
+	apiMux.HandleFunc("PUT /channels/{channel_name}/locale", handleJSON(handlers.setLocale))
 	apiMux.HandleFunc("GET /channels/{channel_name}/runbook", handleJSON(handlers.runbook))
+	apiMux.HandleFunc("GET /channels/{channel_name}/search", handleJSON(handlers.searchMessages))
+	apiMux.HandleFunc("GET /channels/{channel_name}/settings", handleJSON(handlers.channelSettings))
+	apiMux.HandleFunc("GET /channels/{channel_name}/volume", handleJSON(handlers.messageVolume))
+	apiMux.HandleFunc("POST /channels/{channel_name}/backfill-durations", handleJSON(handlers.backfillDurations))
+	apiMux.HandleFunc("POST /channels/{channel_name}/incidents/{ts}/status", handleJSON(handlers.postStatusUpdate))
+	apiMux.HandleFunc("PUT /channels/{channel_name}/incidents/{ts}/impact", handleJSON(handlers.setImpact))
+	apiMux.HandleFunc("PUT /channels/{channel_name}/incidents/{ts}/owner", handleJSON(handlers.assignOwner))
+	apiMux.HandleFunc("GET /channels/{channel_name}/incidents/{ts}/related", handleJSON(handlers.listRelatedIncidents))
 	apiMux.HandleFunc("POST /channels/{channel_name}/onboard", handleJSON(handlers.onboardChannel))
+	apiMux.HandleFunc("POST /channels/{channel_name}/reclassify", handleJSON(handlers.reclassifyChannel))
 	apiMux.HandleFunc("POST /channels/{channel_name}/runbook", handleJSON(handlers.createRunbook))
+	apiMux.HandleFunc("POST /channels/{channel_name}/verify-backfill", handleJSON(handlers.verifyBackfill))
+	apiMux.HandleFunc("GET /incidents", handleJSON(handlers.listIncidentsByPriority))
+	apiMux.HandleFunc("GET /runbooks/export", handlers.exportRunbooks)
+	apiMux.HandleFunc("GET /owners/{user_id}/incidents", handleJSON(handlers.listOwnerIncidents))
+	apiMux.HandleFunc("GET /services/{service}/responders", handleJSON(handlers.listResponders))
+	apiMux.HandleFunc("PUT /services/{service}/alerts/{alert}/runbook-url", handleJSON(handlers.setRunbookURL))
+	apiMux.HandleFunc("POST /ingest/alert", handleJSON(handlers.ingestAlert))
 
 	mux := http.NewServeMux()
 	mux.Handle("/riverui/", riverServer)
@@ -94,11 +219,19 @@ func New(
 	mux.Handle("GET /version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(versioninfo.Short()))
 	}))
-	return mux, nil
+	return accessLog(slog.Default(), mux), nil
 }
 
+// listChannels lists the channels the bot knows about. Channels archived in Slack are left out
+// unless ?include_archived=true.
 func (h *httpHandlers) listChannels(r *http.Request) (any, error) {
-	channels, err := schema.New(h.db).GetAllChannels(r.Context())
+	q := schema.New(h.db)
+	list := q.GetActiveChannels
+	if r.URL.Query().Get("include_archived") == "true" {
+		list = q.GetAllChannels
+	}
+
+	channels, err := list(r.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +243,9 @@ func (h *httpHandlers) listChannels(r *http.Request) (any, error) {
 	return channels, nil
 }
 
+// listAlerts lists the alerts seen in the channel, optionally only those of ?service. With
+// ?normalize=true, service names also match ignoring case and separators, so payment-svc
+// matches Payment_Svc.
 func (h *httpHandlers) listAlerts(r *http.Request) (any, error) {
 	channelName := r.PathValue("channel_name")
 	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
@@ -117,7 +253,11 @@ func (h *httpHandlers) listAlerts(r *http.Request) (any, error) {
 		return nil, err
 	}
 
-	alerts, err := schema.New(h.db).GetAlerts(r.Context(), channel.ID)
+	alerts, err := schema.New(h.db).GetAlerts(r.Context(), schema.GetAlertsParams{
+		ChannelID: channel.ID,
+		Service:   cmp.Or(r.URL.Query().Get("service"), "*"),
+		Normalize: r.URL.Query().Get("normalize") == "true",
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -133,6 +273,69 @@ func (h *httpHandlers) listAlerts(r *http.Request) (any, error) {
 	return alerts, nil
 }
 
+// messages serves the channel's messages as one JSON array, or streamed as NDJSON with
+// ?format=ndjson for exports too large to buffer.
+func (h *httpHandlers) messages(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") != "ndjson" {
+		handleJSON(h.listMessages)(w, r)
+		return
+	}
+
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeNDJSON(w, func(afterTs string) ([]schema.MessagesV2, error) {
+		return schema.New(h.db).GetMessagesPage(r.Context(), schema.GetMessagesPageParams{
+			ChannelID: channel.ID,
+			AfterTs:   afterTs,
+			PageSize:  ndjsonPageSize,
+		})
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "streaming messages", "channel_id", channel.ID, "error", err)
+	}
+}
+
+const ndjsonPageSize = 1000
+
+// writeNDJSON writes one message per line, fetching pages after the last ts written until a
+// page comes back short. Each page is flushed to the client as soon as it is written.
+func writeNDJSON(w http.ResponseWriter, nextPage func(afterTs string) ([]schema.MessagesV2, error)) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+
+	afterTs := "0"
+	for {
+		page, err := nextPage(afterTs)
+		if err != nil {
+			return fmt.Errorf("getting messages after %s: %w", afterTs, err)
+		}
+
+		for _, msg := range page {
+			if err := encoder.Encode(msg); err != nil {
+				return err
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+
+		if len(page) < ndjsonPageSize {
+			return nil
+		}
+		afterTs = page[len(page)-1].Ts
+	}
+}
+
 func (h *httpHandlers) listMessages(r *http.Request) (any, error) {
 	channelName := r.PathValue("channel_name")
 	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
@@ -160,25 +363,423 @@ func (h *httpHandlers) onboardChannel(r *http.Request) (any, error) {
 	return nil, nil
 }
 
-func (h *httpHandlers) generateReport(r *http.Request) (any, error) {
+// Each backfill verification window is a job paging through Slack's history, so windows can't
+// be arbitrarily small or many.
+const (
+	minBackfillWindow  = time.Hour
+	maxBackfillWindows = 1000
+)
+
+// parseBackfillWindow returns the ?window query parameter (default 24h), rejecting windows that
+// would split days into too many jobs.
+func parseBackfillWindow(r *http.Request, days int) (time.Duration, error) {
+	size := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		size, err = time.ParseDuration(v)
+		if err != nil || size < minBackfillWindow {
+			return 0, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid window: %q, expected at least %s", v, minBackfillWindow)}
+		}
+	}
+
+	if windows := time.Duration(days) * 24 * time.Hour / size; windows > maxBackfillWindows {
+		return 0, httpError{code: http.StatusBadRequest, err: fmt.Errorf("%d days in %s windows is more than %d windows", days, size, maxBackfillWindows)}
+	}
+
+	return size, nil
+}
+
+// verifyBackfill checks the last days (default 14) against Slack, one window (default 24h, at
+// least 1h) at a time. Each window is a job that compares Slack's history with the stored
+// messages and adds the ones that are missing.
+func (h *httpHandlers) verifyBackfill(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := parseDays(r, 14)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := parseBackfillWindow(r, days)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	windows := internal.SplitWindows(end.AddDate(0, 0, -days), end, size)
+	jobs := make([]river.InsertManyParams, len(windows))
+	for i, window := range windows {
+		jobs[i] = river.InsertManyParams{Args: background.BackfillRepairWorkerArgs{
+			ChannelID: channel.ID,
+			Windows:   []background.BackfillWindow{window},
+		}}
+	}
+	if _, err := h.riverClient.InsertMany(r.Context(), jobs); err != nil {
+		return nil, fmt.Errorf("scheduling backfill verification for channel %s: %w", channel.ID, err)
+	}
+
+	return struct {
+		Windows int `json:"windows"`
+	}{
+		Windows: len(windows),
+	}, nil
+}
+
+type bulkOnboardResult struct {
+	Channel string `json:"channel"`
+	ID      string `json:"id,omitempty"`
+	Status  string `json:"status"`
+}
+
+// onboardChannels onboards a list of channel names, or every channel the bot is a member of
+// when "all" is set, through the same allowlist and archived checks as a single channel.
+// Channels that are already onboarded are skipped.
+func (h *httpHandlers) onboardChannels(r *http.Request) (any, error) {
+	var req struct {
+		Channels []string `json:"channels"`
+		All      bool     `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding request: %w", err)}
+	}
+	if len(req.Channels) == 0 && !req.All {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("channels or all is required")}
+	}
+
+	joined, err := h.channels.BotChannels(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("listing bot channels: %w", err)
+	}
+
+	stored, err := schema.New(h.db).GetAllChannels(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	results := planBulkOnboarding(joined, stored, req.Channels, req.All)
+	for i, result := range results {
+		if result.Status != "enqueued" {
+			continue
+		}
+
+		scheduled, err := h.bot.OnboardChannel(r.Context(), result.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !scheduled {
+			results[i].Status = "not_allowed"
+		}
+	}
+
+	return results, nil
+}
+
+// planBulkOnboarding resolves channel names against the channels the bot is a member of, and
+// marks the ones to onboard. Every joined channel is planned when all is set.
+func planBulkOnboarding(joined []slack.Channel, stored []schema.ChannelsV2, names []string, all bool) []bulkOnboardResult {
+	byName := make(map[string]string, len(joined))
+	for _, channel := range joined {
+		byName[channel.Name] = channel.ID
+	}
+
+	finished := make(map[string]bool, len(stored))
+	for _, channel := range stored {
+		finished[channel.ID] = channel.Attrs.OnboardingStatus == dto.OnboardingStatusFinished
+	}
+
+	if all {
+		names = slices.Sorted(maps.Keys(byName))
+	}
+
+	var results []bulkOnboardResult
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		id, ok := byName[name]
+		switch {
+		case !ok:
+			results = append(results, bulkOnboardResult{Channel: name, Status: "not_found"})
+		case finished[id]:
+			results = append(results, bulkOnboardResult{Channel: name, ID: id, Status: "already_onboarded"})
+		default:
+			results = append(results, bulkOnboardResult{Channel: name, ID: id, Status: "enqueued"})
+		}
+	}
+
+	return results
+}
+
+// channelSettings returns the configuration in effect for the channel.
+func (h *httpHandlers) channelSettings(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.resolveSettings(r.Context(), channel)
+}
+
+// messageVolume returns the channel's message counts per day, week or month over the last
+// ?days (default 90), optionally without bot messages.
+func (h *httpHandlers) messageVolume(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := cmp.Or(r.URL.Query().Get("bucket"), "day")
+	if !slices.Contains([]string{"day", "week", "month"}, bucket) {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid bucket %q, expected day, week or month", bucket)}
+	}
+
+	days, err := parseDays(r, 90)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	series, err := schema.New(h.db).GetMessageVolumeSeries(r.Context(), schema.GetMessageVolumeSeriesParams{
+		Bucket:      bucket,
+		ChannelID:   channel.ID,
+		StartTs:     internal.TimeToTs(end.AddDate(0, 0, -days)),
+		EndTs:       internal.TimeToTs(end),
+		ExcludeBots: r.URL.Query().Get("exclude_bots") == "true",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting message volume for channel %s: %w", channel.ID, err)
+	}
+
+	return series, nil
+}
+
+// resolveSettings applies the channel's own state on top of the defaults.
+func (h *httpHandlers) resolveSettings(ctx context.Context, channel schema.ChannelsV2) (ChannelSettings, error) {
+	settings := h.defaults
+	settings.ChannelID = channel.ID
+	settings.Name = channel.Attrs.Name
+	settings.OnboardingStatus = channel.Attrs.OnboardingStatus
+	settings.Archived = channel.Attrs.Archived
+	settings.Locale = channel.Attrs.Locale
+	settings.ReportSections = channel.Attrs.ReportSections
+	if len(settings.ReportSections) == 0 {
+		settings.ReportSections = report_worker.DefaultSections
+	}
+
+	settings.Allowed = h.bot.ChannelAllowed(channel)
+
+	return settings, nil
+}
+
+// listIncidentsByPriority counts incidents of one priority across every channel and service.
+func (h *httpHandlers) listIncidentsByPriority(r *http.Request) (any, error) {
+	priority := strings.ToUpper(r.URL.Query().Get("priority"))
+	if priority != string(dto.PriorityHigh) && priority != string(dto.PriorityLow) {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid priority %q, expected %s or %s", priority, dto.PriorityHigh, dto.PriorityLow)}
+	}
+
+	days, err := parseDays(r, 7)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	return schema.New(h.db).GetIncidentsByPriority(r.Context(), schema.GetIncidentsByPriorityParams{
+		Priority: priority,
+		StartTs:  internal.TimeToTs(end.AddDate(0, 0, -days)),
+		EndTs:    internal.TimeToTs(end),
+	})
+}
+
+// backfillDurations enqueues a job that pairs the channel's closed incidents with their opens to
+// record how long each one lasted.
+func (h *httpHandlers) backfillDurations(r *http.Request) (any, error) {
 	channelName := r.PathValue("channel_name")
 	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := h.riverClient.Insert(r.Context(), background.ReportWorkerArgs{
+	if _, err := h.riverClient.Insert(r.Context(), background.IncidentDurationWorkerArgs{ChannelID: channel.ID}, nil); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// reclassifyChannel re-runs incident classification on messages from the last days (default 7).
+// Jobs go through the single-worker reclassify queue so a large backlog doesn't starve live
+// classification.
+func (h *httpHandlers) reclassifyChannel(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := parseDays(r, 7)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	msgs, err := schema.New(h.db).GetMessagesWithinTS(r.Context(), schema.GetMessagesWithinTSParams{
 		ChannelID: channel.ID,
-	}, nil); err != nil {
+		StartTs:   internal.TimeToTs(end.AddDate(0, 0, -days)),
+		EndTs:     internal.TimeToTs(end),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting messages for channel %s: %w", channel.ID, err)
+	}
+
+	var jobs []river.InsertManyParams
+	for _, msg := range msgs {
+		if msg.Attrs.Synthetic {
+			continue
+		}
+
+		jobs = append(jobs, river.InsertManyParams{
+			Args: background.ClassifierArgs{
+				ChannelID:  msg.ChannelID,
+				SlackTS:    msg.Ts,
+				Reclassify: true,
+			},
+			InsertOpts: &river.InsertOpts{Queue: "reclassify", Priority: 4},
+		})
+	}
+
+	if len(jobs) > 0 {
+		if _, err := h.riverClient.InsertMany(r.Context(), jobs); err != nil {
+			return nil, fmt.Errorf("enqueueing reclassification jobs: %w", err)
+		}
+	}
+
+	return struct {
+		Enqueued int `json:"enqueued"`
+	}{
+		Enqueued: len(jobs),
+	}, nil
+}
+
+func (h *httpHandlers) generateReport(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	args := background.ReportWorkerArgs{ChannelID: channel.ID}
+	for destination := range strings.SplitSeq(r.URL.Query().Get("destinations"), ",") {
+		if destination = strings.TrimSpace(destination); destination != "" {
+			args.Destinations = append(args.Destinations, destination)
+		}
+	}
+
+	if _, err := h.riverClient.Insert(r.Context(), args, nil); err != nil {
 		return nil, err
 	}
 
 	return nil, nil
 }
 
+// previewReport returns the channel's report as Slack blocks, in the shape Block Kit Builder accepts.
+func (h *httpHandlers) previewReport(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := h.reports.Preview(r.Context(), channel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]slack.Block{"blocks": blocks}, nil
+}
+
+// setReportSections picks which sections the channel's report has, in order. An empty list
+// restores the default sections.
+func (h *httpHandlers) setReportSections(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Sections []string `json:"sections"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding sections: %w", err)}
+	}
+
+	sections := []string{}
+	if len(body.Sections) > 0 {
+		if err := report_worker.ValidateSections(body.Sections); err != nil {
+			return nil, httpError{code: http.StatusBadRequest, err: err}
+		}
+		sections = body.Sections
+	}
+
+	if err := schema.New(h.db).UpdateChannelAttrs(r.Context(), schema.UpdateChannelAttrsParams{
+		ID:    channel.ID,
+		Attrs: dto.ChannelAttrs{ReportSections: sections},
+	}); err != nil {
+		return nil, fmt.Errorf("updating report sections for channel %s: %w", channel.ID, err)
+	}
+
+	if len(sections) == 0 {
+		return report_worker.DefaultSections, nil
+	}
+	return sections, nil
+}
+
+// setLocale sets the language runbooks are written in for the channel's incidents, as a BCP 47
+// locale like "ja". "en" switches back to English. Runbooks are kept per locale, so channels in
+// different languages don't overwrite each other's runbook for the same alert.
+func (h *httpHandlers) setLocale(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Locale string `json:"locale"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding locale: %w", err)}
+	}
+	if body.Locale == "" {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("locale is required")}
+	}
+	if err := llm.ValidateLocale(body.Locale); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	if err := schema.New(h.db).UpdateChannelAttrs(r.Context(), schema.UpdateChannelAttrsParams{
+		ID:    channel.ID,
+		Attrs: dto.ChannelAttrs{Locale: body.Locale},
+	}); err != nil {
+		return nil, fmt.Errorf("updating locale for channel %s: %w", channel.ID, err)
+	}
+
+	return body, nil
+}
+
 func (h *httpHandlers) runbook(r *http.Request) (any, error) {
 	channelName := r.PathValue("channel_name")
-	_, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +793,7 @@ func (h *httpHandlers) runbook(r *http.Request) (any, error) {
 	runbook, err := schema.New(h.db).GetRunbook(r.Context(), schema.GetRunbookParams{
 		ServiceName: serviceName,
 		AlertName:   alertName,
+		Locale:      llm.RunbookLocale(channel.Attrs.Locale),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("getting runbook (%s/%s): %w", serviceName, alertName, err)
@@ -200,6 +802,55 @@ func (h *httpHandlers) runbook(r *http.Request) (any, error) {
 	return runbook, nil
 }
 
+// exportRunbooks returns the latest stored runbook of every service and alert as one markdown
+// document. Nothing is regenerated.
+func (h *httpHandlers) exportRunbooks(w http.ResponseWriter, r *http.Request) {
+	runbooks, err := schema.New(h.db).GetLatestRunbooks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="runbooks-%s.md"`, time.Now().Format("2006-01-02")))
+	_, _ = w.Write([]byte(renderRunbookExport(runbooks)))
+}
+
+// renderRunbookExport lays runbooks out as one markdown section per service, alert and locale.
+func renderRunbookExport(runbooks []schema.IncidentRunbook) string {
+	var doc strings.Builder
+	doc.WriteString("# Runbooks\n")
+	for _, runbook := range runbooks {
+		heading := fmt.Sprintf("%s / %s", runbook.Attrs.ServiceName, runbook.Attrs.AlertName)
+		if runbook.Attrs.Locale != "" {
+			heading += fmt.Sprintf(" (%s)", runbook.Attrs.Locale)
+		}
+		doc.WriteString(fmt.Sprintf("\n## %s\n\n", heading))
+		doc.WriteString(demoteHeadings(strings.TrimSpace(runbook.Attrs.Runbook)) + "\n")
+	}
+
+	return doc.String()
+}
+
+// demoteHeadings nests markdown's headings one level deeper, so a runbook's own sections sit
+// under its heading in the export. Code blocks are left alone.
+func demoteHeadings(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	inCode := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+			continue
+		}
+		if !inCode && strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "######") {
+			lines[i] = "#" + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func (h *httpHandlers) createRunbook(r *http.Request) (any, error) {
 	channelName := r.PathValue("channel_name")
 	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
@@ -235,3 +886,51 @@ func (h *httpHandlers) createRunbook(r *http.Request) (any, error) {
 
 	return msgs, nil
 }
+
+func (h *httpHandlers) setRunbookURL(r *http.Request) (any, error) {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding request: %w", err)}
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid runbook url: %q", req.URL)}
+	}
+
+	params := schema.SetAlertRunbookURLParams{
+		Service: r.PathValue("service"),
+		Alert:   r.PathValue("alert"),
+		Url:     u.String(),
+	}
+	if err := schema.New(h.db).SetAlertRunbookURL(r.Context(), params); err != nil {
+		return nil, fmt.Errorf("setting runbook url (%s/%s): %w", params.Service, params.Alert, err)
+	}
+
+	return params, nil
+}
+
+// listResponders returns the users who replied most in threads of the service's incidents
+// opened in the last days (default 30).
+func (h *httpHandlers) listResponders(r *http.Request) (any, error) {
+	days, err := parseDays(r, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	service := r.PathValue("service")
+	responders, err := schema.New(h.db).GetTopRespondersByService(r.Context(), schema.GetTopRespondersByServiceParams{
+		Service:       service,
+		StartTs:       internal.TimeToTs(end.AddDate(0, 0, -days)),
+		EndTs:         internal.TimeToTs(end),
+		MaxResponders: 10,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting responders for service %s: %w", service, err)
+	}
+
+	return responders, nil
+}
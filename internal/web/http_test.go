@@ -0,0 +1,305 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/riverdriver/riverpgxv5"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background/report_worker"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+	"github.com/dynoinc/ratchet/internal/storage/storagetest"
+)
+
+// fakeChannels lists a fixed set of channels as the bot's.
+type fakeChannels []slack.Channel
+
+func (f fakeChannels) BotChannels(context.Context) ([]slack.Channel, error) {
+	return f, nil
+}
+
+func joinedChannel(id, name string) slack.Channel {
+	var channel slack.Channel
+	channel.ID = id
+	channel.Name = name
+	return channel
+}
+
+func TestPlanBulkOnboarding(t *testing.T) {
+	joined := []slack.Channel{
+		joinedChannel("C1", "alerts"),
+		joinedChannel("C2", "incidents"),
+		joinedChannel("C3", "payments"),
+		joinedChannel("C5", "general"),
+	}
+	stored := []schema.ChannelsV2{
+		{ID: "C1", Attrs: dto.ChannelAttrs{Name: "alerts", OnboardingStatus: dto.OnboardingStatusFinished}},
+		{ID: "C2", Attrs: dto.ChannelAttrs{Name: "incidents", OnboardingStatus: dto.OnboardingStatusStarted}},
+		{ID: "C3", Attrs: dto.ChannelAttrs{Name: "payments"}},
+		{ID: "C4", Attrs: dto.ChannelAttrs{Name: "left"}},
+	}
+
+	results := planBulkOnboarding(joined, stored, []string{"incidents", "alerts", "missing", "incidents", "left", "payments"}, false)
+	require.Equal(t, []bulkOnboardResult{
+		{Channel: "incidents", ID: "C2", Status: "enqueued"},
+		{Channel: "alerts", ID: "C1", Status: "already_onboarded"},
+		{Channel: "missing", Status: "not_found"},
+		{Channel: "left", Status: "not_found"},
+		{Channel: "payments", ID: "C3", Status: "enqueued"},
+	}, results)
+
+	results = planBulkOnboarding(joined, stored, nil, true)
+	require.Equal(t, []bulkOnboardResult{
+		{Channel: "alerts", ID: "C1", Status: "already_onboarded"},
+		{Channel: "general", ID: "C5", Status: "enqueued"},
+		{Channel: "incidents", ID: "C2", Status: "enqueued"},
+		{Channel: "payments", ID: "C3", Status: "enqueued"},
+	}, results)
+}
+
+func TestOnboardChannels(t *testing.T) {
+	ctx := t.Context()
+	h := setupHandlers(t)
+	for id, name := range map[string]string{"C2": "incidents", "C3": "payments"} {
+		_, err := schema.New(h.db).AddChannel(ctx, id)
+		require.NoError(t, err)
+		require.NoError(t, schema.New(h.db).UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
+			ID:    id,
+			Attrs: dto.ChannelAttrs{Name: name},
+		}))
+	}
+
+	// The bot was added to general but hasn't seen a message there, and payments isn't allowed.
+	h.channels = fakeChannels{
+		joinedChannel("C1", "alerts"),
+		joinedChannel("C2", "incidents"),
+		joinedChannel("C3", "payments"),
+		joinedChannel("C4", "general"),
+	}
+	h.bot = internal.New(h.db, []string{"C1", "C2", "C4"}, nil, false, false)
+	require.NoError(t, h.bot.Init(h.riverClient))
+
+	onboard := func(body string) []bulkOnboardResult {
+		rec := httptest.NewRecorder()
+		handleJSON(h.onboardChannels)(rec, httptest.NewRequest(http.MethodPost, "/api/channels/onboard-bulk", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var results []bulkOnboardResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		return results
+	}
+
+	require.Equal(t, []bulkOnboardResult{
+		{Channel: "alerts", ID: "C1", Status: "already_onboarded"},
+		{Channel: "incidents", ID: "C2", Status: "enqueued"},
+		{Channel: "payments", ID: "C3", Status: "not_allowed"},
+		{Channel: "missing", Status: "not_found"},
+	}, onboard(`{"channels": ["alerts", "incidents", "payments", "incidents", "missing"]}`))
+	require.Equal(t, 1, jobCount(t, h.riverClient, "channel_board"))
+
+	require.Equal(t, []bulkOnboardResult{
+		{Channel: "alerts", ID: "C1", Status: "already_onboarded"},
+		{Channel: "general", ID: "C4", Status: "enqueued"},
+		{Channel: "incidents", ID: "C2", Status: "enqueued"},
+		{Channel: "payments", ID: "C3", Status: "not_allowed"},
+	}, onboard(`{"all": true}`))
+	// incidents is still pending from the first request, so only general adds a job.
+	require.Equal(t, 2, jobCount(t, h.riverClient, "channel_board"))
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var stored []schema.MessagesV2
+	for i := range 2*ndjsonPageSize + 10 {
+		stored = append(stored, schema.MessagesV2{ChannelID: "C1", Ts: fmt.Sprintf("%d.000000", 1000+i)})
+	}
+
+	var cursors []string
+	rec := httptest.NewRecorder()
+	err := writeNDJSON(rec, func(afterTs string) ([]schema.MessagesV2, error) {
+		cursors = append(cursors, afterTs)
+		i := 0
+		for i < len(stored) && stored[i].Ts <= afterTs {
+			i++
+		}
+		return stored[i:min(i+ndjsonPageSize, len(stored))], nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	require.Equal(t, []string{"0", "1999.000000", "2999.000000"}, cursors)
+
+	count := 0
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var msg schema.MessagesV2
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		require.Equal(t, stored[count].Ts, msg.Ts)
+		count++
+	}
+	require.Equal(t, len(stored), count)
+}
+
+func TestResolveSettings(t *testing.T) {
+	defaults := ChannelSettings{SlackMaxMessageLength: 3000, ReportDedupWindow: "1h0m0s"}
+
+	h := &httpHandlers{bot: internal.New(nil, nil, nil, false, false), defaults: defaults}
+	settings, err := h.resolveSettings(t.Context(), schema.ChannelsV2{ID: "C1"})
+	require.NoError(t, err)
+	require.Equal(t, ChannelSettings{
+		ChannelID:             "C1",
+		Allowed:               true,
+		ReportSections:        report_worker.DefaultSections,
+		SlackMaxMessageLength: 3000,
+		ReportDedupWindow:     "1h0m0s",
+	}, settings)
+
+	h.bot = internal.New(nil, []string{"C2"}, nil, false, false)
+	settings, err = h.resolveSettings(t.Context(), schema.ChannelsV2{
+		ID: "C2",
+		Attrs: dto.ChannelAttrs{
+			Name:             "payments",
+			OnboardingStatus: dto.OnboardingStatusFinished,
+			ReportSections:   []string{report_worker.SectionAlerts, report_worker.SectionMTTR},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, ChannelSettings{
+		ChannelID:             "C2",
+		Name:                  "payments",
+		OnboardingStatus:      dto.OnboardingStatusFinished,
+		Allowed:               true,
+		ReportSections:        []string{report_worker.SectionAlerts, report_worker.SectionMTTR},
+		SlackMaxMessageLength: 3000,
+		ReportDedupWindow:     "1h0m0s",
+	}, settings)
+}
+
+func TestParseSince(t *testing.T) {
+	for _, v := range []string{"1704067200.000000", "2024-01-01T00:00:00Z"} {
+		since, err := parseSince(v)
+		require.NoError(t, err, v)
+		require.Equal(t, int64(1704067200), since.Unix(), v)
+	}
+
+	_, err := parseSince("last week")
+	require.Error(t, err)
+}
+
+func TestParseDays(t *testing.T) {
+	days, err := parseDays(httptest.NewRequest(http.MethodGet, "/incidents", nil), 7)
+	require.NoError(t, err)
+	require.Equal(t, 7, days)
+
+	days, err = parseDays(httptest.NewRequest(http.MethodGet, "/incidents?days=30", nil), 7)
+	require.NoError(t, err)
+	require.Equal(t, 30, days)
+
+	for _, v := range []string{"0", "-1", "week"} {
+		_, err := parseDays(httptest.NewRequest(http.MethodGet, "/incidents?days="+v, nil), 7)
+		var httpErr httpError
+		require.ErrorAs(t, err, &httpErr, v)
+		require.Equal(t, http.StatusBadRequest, httpErr.code, v)
+	}
+}
+
+func TestParseBackfillWindow(t *testing.T) {
+	size, err := parseBackfillWindow(httptest.NewRequest(http.MethodPost, "/verify-backfill", nil), 14)
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, size)
+
+	size, err = parseBackfillWindow(httptest.NewRequest(http.MethodPost, "/verify-backfill?window=1h", nil), 14)
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, size)
+
+	for _, tc := range []struct {
+		window string
+		days   int
+	}{
+		{"1s", 14},
+		{"0", 14},
+		{"day", 14},
+		{"1h", 90},
+	} {
+		_, err := parseBackfillWindow(httptest.NewRequest(http.MethodPost, "/verify-backfill?window="+tc.window, nil), tc.days)
+		var httpErr httpError
+		require.ErrorAs(t, err, &httpErr, tc.window)
+		require.Equal(t, http.StatusBadRequest, httpErr.code, tc.window)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	for _, v := range []string{"U024BE7LH", "<@U024BE7LH>", " U024BE7LH "} {
+		owner, err := parseOwner(v)
+		require.NoError(t, err, v)
+		require.Equal(t, "U024BE7LH", owner, v)
+	}
+
+	for _, v := range []string{"", "alice", "C024BE7LH"} {
+		_, err := parseOwner(v)
+		require.Error(t, err, v)
+	}
+}
+
+func TestRenderRunbookExport(t *testing.T) {
+	doc := renderRunbookExport([]schema.IncidentRunbook{
+		{ID: 3, Attrs: dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Runbook: "## Alert Description\nCheckout is slow.\n"}},
+		{ID: 4, Attrs: dto.RunbookAttrs{ServiceName: "payments", AlertName: "HighLatency", Locale: "de", Runbook: "## Beschreibung\nCheckout ist langsam.\n"}},
+		{ID: 1, Attrs: dto.RunbookAttrs{ServiceName: "search", AlertName: "IndexLag", Runbook: "Reindex:\n```\n# rebuild\nreindex --all\n```\n\n"}},
+	})
+
+	require.Equal(t, "# Runbooks\n"+
+		"\n## payments / HighLatency\n\n### Alert Description\nCheckout is slow.\n"+
+		"\n## payments / HighLatency (de)\n\n### Beschreibung\nCheckout ist langsam.\n"+
+		"\n## search / IndexLag\n\nReindex:\n```\n# rebuild\nreindex --all\n```\n", doc)
+}
+
+func TestValidateImpact(t *testing.T) {
+	require.NoError(t, validateImpact(dto.IncidentImpact{DowntimeMinutes: 30}))
+	require.NoError(t, validateImpact(dto.IncidentImpact{Notes: "checkout only"}))
+	require.Error(t, validateImpact(dto.IncidentImpact{}))
+	require.Error(t, validateImpact(dto.IncidentImpact{AffectedUsers: -1}))
+}
+
+// setupHandlers returns handlers backed by a fresh database holding channel C1, named alerts.
+// Jobs are inserted but not worked.
+func setupHandlers(t *testing.T) *httpHandlers {
+	t.Helper()
+
+	ctx := context.Background()
+	db := storagetest.NewDB(t)
+
+	_, err := schema.New(db).AddChannel(ctx, "C1")
+	require.NoError(t, err)
+	require.NoError(t, schema.New(db).UpdateChannelAttrs(ctx, schema.UpdateChannelAttrsParams{
+		ID:    "C1",
+		Attrs: dto.ChannelAttrs{Name: "alerts", OnboardingStatus: dto.OnboardingStatusFinished},
+	}))
+
+	riverClient, err := river.NewClient(riverpgxv5.New(db), &river.Config{})
+	require.NoError(t, err)
+	bot := internal.New(db, nil, nil, false, false)
+	require.NoError(t, bot.Init(riverClient))
+
+	return &httpHandlers{db: db, riverClient: riverClient, bot: bot}
+}
+
+// jobCount returns how many jobs of kind are queued.
+func jobCount(t *testing.T, riverClient *river.Client[pgx.Tx], kind string) int {
+	t.Helper()
+
+	jobs, err := riverClient.JobList(t.Context(), river.NewJobListParams().Kinds(kind))
+	require.NoError(t, err)
+	return len(jobs.Jobs)
+}
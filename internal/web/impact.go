@@ -0,0 +1,62 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+func validateImpact(impact dto.IncidentImpact) error {
+	if impact == (dto.IncidentImpact{}) {
+		return errors.New("impact must set downtime_minutes, affected_users or notes")
+	}
+	if impact.DowntimeMinutes < 0 {
+		return fmt.Errorf("downtime_minutes must not be negative, got %d", impact.DowntimeMinutes)
+	}
+	if impact.AffectedUsers < 0 {
+		return fmt.Errorf("affected_users must not be negative, got %d", impact.AffectedUsers)
+	}
+
+	return nil
+}
+
+// setImpact records the business impact of the incident opened at {ts}, replacing any
+// previously recorded impact.
+func (h *httpHandlers) setImpact(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := r.PathValue("ts")
+	msg, err := schema.New(h.db).GetMessage(r.Context(), schema.GetMessageParams{ChannelID: channel.ID, Ts: ts})
+	if err != nil {
+		return nil, err
+	}
+	if msg.Attrs.IncidentAction.Action != dto.ActionOpenIncident {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("message %s is not an open incident", ts)}
+	}
+
+	var impact dto.IncidentImpact
+	if err := json.NewDecoder(r.Body).Decode(&impact); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding impact: %w", err)}
+	}
+	if err := validateImpact(impact); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	if err := schema.New(h.db).UpdateMessageAttrs(r.Context(), schema.UpdateMessageAttrsParams{
+		ChannelID: channel.ID,
+		Ts:        ts,
+		Attrs:     dto.MessageAttrs{Impact: impact},
+	}); err != nil {
+		return nil, fmt.Errorf("recording impact: %w", err)
+	}
+
+	return impact, nil
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+const (
+	signatureHeader = "X-Ratchet-Signature"
+	signaturePrefix = "sha256="
+	timestampHeader = "X-Ratchet-Timestamp"
+
+	maxIngestBodySize = 1 << 20
+	// Signed requests older than this, or this far in the future, are rejected so a captured
+	// request can't be replayed later.
+	maxIngestRequestAge = 5 * time.Minute
+)
+
+// alertPayload is the JSON body accepted by /api/ingest/alert.
+type alertPayload struct {
+	Channel  string `json:"channel"`
+	Source   string `json:"source"`
+	Service  string `json:"service"`
+	Alert    string `json:"alert"`
+	Priority string `json:"priority"`
+	Action   string `json:"action"`
+	// When the alert fired. Required, since it identifies the alert: a sender retrying the same
+	// alert sends the same timestamp and the retry is ignored.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Only used for close, e.g. "1h30m".
+	Duration string `json:"duration"`
+}
+
+// verifySignature checks that signature is the hex encoded HMAC-SHA256 of the request timestamp,
+// a ".", and body, using secret.
+func verifySignature(secret, timestamp string, body []byte, signature string) bool {
+	hexSig, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return false
+	}
+
+	got, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// incidentAction validates the payload and converts it to the incident action we store.
+func (p alertPayload) incidentAction() (dto.IncidentAction, error) {
+	if p.Channel == "" || p.Service == "" || p.Alert == "" || p.Action == "" || p.Timestamp.IsZero() {
+		return dto.IncidentAction{}, errors.New("channel, service, alert, action and timestamp are required")
+	}
+
+	action := dto.IncidentAction{
+		Service: p.Service,
+		Alert:   p.Alert,
+	}
+
+	switch p.Action {
+	case "open":
+		action.Action = dto.ActionOpenIncident
+		switch strings.ToUpper(p.Priority) {
+		case "HIGH":
+			action.Priority = dto.PriorityHigh
+		case "LOW":
+			action.Priority = dto.PriorityLow
+		default:
+			return dto.IncidentAction{}, fmt.Errorf("unknown priority: %q", p.Priority)
+		}
+	case "close":
+		action.Action = dto.ActionCloseIncident
+		if p.Duration != "" {
+			d, err := time.ParseDuration(p.Duration)
+			if err != nil {
+				return dto.IncidentAction{}, fmt.Errorf("parsing duration: %w", err)
+			}
+			action.Duration.Duration = d
+		}
+	default:
+		return dto.IncidentAction{}, fmt.Errorf("unknown action: %q", p.Action)
+	}
+
+	return action, nil
+}
+
+func (h *httpHandlers) ingestAlert(r *http.Request) (any, error) {
+	if h.ingestSecret == "" {
+		return nil, httpError{code: http.StatusNotFound, err: errors.New("alert ingestion is not enabled")}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBodySize))
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("reading body: %w", err)}
+	}
+
+	timestamp := r.Header.Get(timestampHeader)
+	if !verifySignature(h.ingestSecret, timestamp, body, r.Header.Get(signatureHeader)) {
+		return nil, httpError{code: http.StatusUnauthorized, err: errors.New("invalid signature")}
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, httpError{code: http.StatusUnauthorized, err: fmt.Errorf("invalid %s: %q", timestampHeader, timestamp)}
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxIngestRequestAge || age < -maxIngestRequestAge {
+		return nil, httpError{code: http.StatusUnauthorized, err: fmt.Errorf("request timestamp is %s off", age.Round(time.Second))}
+	}
+
+	var payload alertPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding payload: %w", err)}
+	}
+
+	action, err := payload.incidentAction()
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), payload.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	source := payload.Source
+	if source == "" {
+		source = "webhook"
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(r.Context()) }()
+
+	msg := schema.AddMessageParams{
+		ChannelID: channel.ID,
+		Ts:        internal.TimeToTs(payload.Timestamp),
+		Attrs: dto.MessageAttrs{
+			Message: dto.SlackMessage{
+				Text:        fmt.Sprintf("%s %s/%s (via %s)", action.Action, action.Service, action.Alert, source),
+				BotID:       "ratchet_ingest",
+				BotUsername: source,
+			},
+			IncidentAction: action,
+			Synthetic:      true,
+		},
+	}
+	// A sender retrying an alert with the same timestamp stores it, and schedules its runbook,
+	// only once.
+	if err := h.bot.AddMessage(r.Context(), tx, []schema.AddMessageParams{msg}, nil); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"channel_id": msg.ChannelID, "ts": msg.Ts}, nil
+}
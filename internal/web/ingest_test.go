@@ -0,0 +1,104 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// signedIngestRequest returns an ingest request for body signed with secret at time at.
+func signedIngestRequest(secret, body string, at time.Time) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/alert", strings.NewReader(body))
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, signaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestIngestAlert(t *testing.T) {
+	secret := "test-secret"
+	body := `{"channel":"alerts","service":"payments","alert":"HighLatency","priority":"high","action":"open","timestamp":"2026-10-14T10:00:00Z"}`
+
+	t.Run("valid payload", func(t *testing.T) {
+		req := signedIngestRequest(secret, body, time.Now())
+		require.True(t, verifySignature(secret, req.Header.Get(timestampHeader), []byte(body), req.Header.Get(signatureHeader)))
+		require.False(t, verifySignature(secret, "0", []byte(body), req.Header.Get(signatureHeader)))
+
+		payload := alertPayload{Channel: "alerts", Service: "payments", Alert: "HighLatency", Priority: "high", Action: "open", Timestamp: time.Now()}
+		action, err := payload.incidentAction()
+		require.NoError(t, err)
+		require.Equal(t, dto.ActionOpenIncident, action.Action)
+		require.Equal(t, dto.PriorityHigh, action.Priority)
+
+		// Without a timestamp a retry couldn't be told apart from a new alert.
+		payload.Timestamp = time.Time{}
+		_, err = payload.incidentAction()
+		require.Error(t, err)
+	})
+
+	t.Run("unsigned payload", func(t *testing.T) {
+		h := &httpHandlers{ingestSecret: secret}
+		req := httptest.NewRequest(http.MethodPost, "/ingest/alert", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handleJSON(h.ingestAlert)(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("replayed payload", func(t *testing.T) {
+		h := &httpHandlers{ingestSecret: secret}
+		for _, at := range []time.Time{time.Now().Add(-10 * time.Minute), time.Now().Add(10 * time.Minute)} {
+			rec := httptest.NewRecorder()
+			handleJSON(h.ingestAlert)(rec, signedIngestRequest(secret, body, at))
+			require.Equal(t, http.StatusUnauthorized, rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestIngestAlertStoresIncident(t *testing.T) {
+	h := setupHandlers(t)
+	h.ingestSecret = "test-secret"
+
+	body := `{"channel":"alerts","source":"alertmanager","service":"payments","alert":"HighLatency","priority":"high","action":"open","timestamp":"2026-10-14T10:00:00Z"}`
+
+	// The sender retries; the incident is stored and its runbook scheduled once.
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handleJSON(h.ingestAlert)(rec, signedIngestRequest(h.ingestSecret, body, time.Now()))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, map[string]string{"channel_id": "C1", "ts": "1791972000.000000"}, resp)
+	}
+
+	msg, err := schema.New(h.db).GetMessage(t.Context(), schema.GetMessageParams{ChannelID: "C1", Ts: "1791972000.000000"})
+	require.NoError(t, err)
+	require.True(t, msg.Attrs.Synthetic)
+	require.Equal(t, dto.IncidentAction{
+		Action:   dto.ActionOpenIncident,
+		Service:  "payments",
+		Alert:    "HighLatency",
+		Priority: dto.PriorityHigh,
+	}, msg.Attrs.IncidentAction)
+
+	require.Equal(t, 1, jobCount(t, h.riverClient, background.PostRunbookWorkerArgs{}.Kind()))
+	require.Equal(t, 1, jobCount(t, h.riverClient, background.UpdateRunbookWorkerArgs{}.Kind()))
+	require.Zero(t, jobCount(t, h.riverClient, background.ClassifierArgs{}.Kind()))
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+var slackUserID = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+
+// parseOwner accepts a Slack user ID, bare or as a <@U123> mention.
+func parseOwner(v string) (string, error) {
+	owner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(v), "<@"), ">")
+	if !slackUserID.MatchString(owner) {
+		return "", fmt.Errorf("invalid owner %q, expected a Slack user ID", v)
+	}
+
+	return owner, nil
+}
+
+// assignOwner records the owner of the incident opened at {ts} and announces it in the thread.
+func (h *httpHandlers) assignOwner(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := r.PathValue("ts")
+	msg, err := schema.New(h.db).GetMessage(r.Context(), schema.GetMessageParams{ChannelID: channel.ID, Ts: ts})
+	if err != nil {
+		return nil, err
+	}
+	if msg.Attrs.IncidentAction.Action != dto.ActionOpenIncident {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("message %s is not an open incident", ts)}
+	}
+
+	var payload struct {
+		OwnerID string `json:"owner_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding owner: %w", err)}
+	}
+
+	owner, err := parseOwner(payload.OwnerID)
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(r.Context())
+
+	if err := schema.New(h.db).WithTx(tx).UpdateMessageAttrs(r.Context(), schema.UpdateMessageAttrsParams{
+		ChannelID: channel.ID,
+		Ts:        ts,
+		Attrs:     dto.MessageAttrs{OwnerID: owner},
+	}); err != nil {
+		return nil, fmt.Errorf("recording owner: %w", err)
+	}
+
+	if _, err := h.riverClient.InsertTx(r.Context(), tx, background.IncidentOwnerWorkerArgs{
+		ChannelID: channel.ID,
+		SlackTS:   ts,
+		OwnerID:   owner,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		return nil, err
+	}
+
+	return struct {
+		OwnerID string `json:"owner_id"`
+	}{
+		OwnerID: owner,
+	}, nil
+}
+
+// listOwnerIncidents returns the open incidents assigned to {user_id} in the last days
+// (default 30). Incidents that have since closed are left out.
+func (h *httpHandlers) listOwnerIncidents(r *http.Request) (any, error) {
+	owner, err := parseOwner(r.PathValue("user_id"))
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	days, err := parseDays(r, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	return schema.New(h.db).GetIncidentsByOwner(r.Context(), schema.GetIncidentsByOwnerParams{
+		OwnerID: owner,
+		StartTs: internal.TimeToTs(end.AddDate(0, 0, -days)),
+		EndTs:   internal.TimeToTs(end),
+	})
+}
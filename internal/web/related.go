@@ -0,0 +1,79 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// RelatedIncident is an incident opened in another channel that may share a root cause.
+type RelatedIncident struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Ts          string `json:"ts"`
+	Service     string `json:"service"`
+	Alert       string `json:"alert"`
+}
+
+// listRelatedIncidents lists incidents opened in other channels for the same service within
+// ?window (default 1h) of the incident opened at {ts}.
+func (h *httpHandlers) listRelatedIncidents(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := r.PathValue("ts")
+	msg, err := schema.New(h.db).GetMessage(r.Context(), schema.GetMessageParams{ChannelID: channel.ID, Ts: ts})
+	if err != nil {
+		return nil, err
+	}
+	if msg.Attrs.IncidentAction.Action != dto.ActionOpenIncident {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("message %s is not an open incident", ts)}
+	}
+
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		window, err = time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid window: %q", v)}
+		}
+	}
+
+	incidents, err := schema.New(h.db).GetRelatedIncidents(r.Context(), schema.GetRelatedIncidentsParams{
+		WindowSeconds: int32(window.Seconds()),
+		ChannelID:     channel.ID,
+		Ts:            ts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting related incidents: %w", err)
+	}
+
+	names := map[string]string{}
+	related := make([]RelatedIncident, 0, len(incidents))
+	for _, incident := range incidents {
+		name, ok := names[incident.ChannelID]
+		if !ok {
+			other, err := schema.New(h.db).GetChannel(r.Context(), incident.ChannelID)
+			if err != nil {
+				return nil, fmt.Errorf("getting channel %s: %w", incident.ChannelID, err)
+			}
+			name = other.Attrs.Name
+			names[incident.ChannelID] = name
+		}
+
+		related = append(related, RelatedIncident{
+			ChannelID:   incident.ChannelID,
+			ChannelName: name,
+			Ts:          incident.Ts,
+			Service:     incident.Attrs.IncidentAction.Service,
+			Alert:       incident.Attrs.IncidentAction.Alert,
+		})
+	}
+
+	return related, nil
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchMessages runs a keyword search over the channel's messages and returns highlighted
+// snippets ordered by rank. q accepts web search syntax ("quoted phrases", -excluded, or).
+func (h *httpHandlers) searchMessages(r *http.Request) (any, error) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("missing q")}
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("invalid limit: %q, expected 1-%d", v, maxSearchLimit)}
+		}
+	}
+
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	return schema.New(h.db).SearchMessagesWithHighlights(r.Context(), schema.SearchMessagesWithHighlightsParams{
+		Query:      query,
+		ChannelID:  channel.ID,
+		LimitCount: int32(limit),
+	})
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dynoinc/ratchet/internal"
+	"github.com/dynoinc/ratchet/internal/background"
+	"github.com/dynoinc/ratchet/internal/storage/schema"
+	"github.com/dynoinc/ratchet/internal/storage/schema/dto"
+)
+
+// statusUpdatePayload is the JSON body accepted by /api/channels/{channel_name}/incidents/{ts}/status.
+type statusUpdatePayload struct {
+	Status string `json:"status"`
+	Impact string `json:"impact"`
+	// How long until the next update, e.g. "30m". Empty if none is promised.
+	NextUpdateIn string `json:"next_update_in"`
+}
+
+// statusUpdate validates the payload and converts it to the status update we post and store.
+func (p statusUpdatePayload) statusUpdate(now time.Time) (dto.StatusUpdate, error) {
+	update := dto.StatusUpdate{
+		Status: strings.ToLower(p.Status),
+		Impact: p.Impact,
+	}
+	if !slices.Contains(dto.IncidentStatuses, update.Status) {
+		return dto.StatusUpdate{}, fmt.Errorf("unknown status %q, expected one of %s", p.Status, strings.Join(dto.IncidentStatuses, ", "))
+	}
+
+	if p.NextUpdateIn != "" {
+		in, err := time.ParseDuration(p.NextUpdateIn)
+		if err != nil || in <= 0 {
+			return dto.StatusUpdate{}, fmt.Errorf("invalid next_update_in: %q", p.NextUpdateIn)
+		}
+		update.NextUpdateTs = internal.TimeToTs(now.Add(in))
+	}
+
+	return update, nil
+}
+
+// postStatusUpdate queues a structured status update for the incident opened at {ts}.
+func (h *httpHandlers) postStatusUpdate(r *http.Request) (any, error) {
+	channelName := r.PathValue("channel_name")
+	channel, err := schema.New(h.db).GetChannelByName(r.Context(), channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := r.PathValue("ts")
+	msg, err := schema.New(h.db).GetMessage(r.Context(), schema.GetMessageParams{ChannelID: channel.ID, Ts: ts})
+	if err != nil {
+		return nil, err
+	}
+	if msg.Attrs.IncidentAction.Action != dto.ActionOpenIncident {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("message %s is not an open incident", ts)}
+	}
+
+	var payload statusUpdatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: fmt.Errorf("decoding status update: %w", err)}
+	}
+
+	update, err := payload.statusUpdate(time.Now())
+	if err != nil {
+		return nil, httpError{code: http.StatusBadRequest, err: err}
+	}
+
+	if _, err := h.riverClient.Insert(r.Context(), background.StatusUpdateWorkerArgs{
+		ChannelID: channel.ID,
+		SlackTS:   ts,
+		Update:    update,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}